@@ -1,22 +1,34 @@
 package app
 
 import (
-	"log"
+	"context"
 	"net/http"
 	"time"
 
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/auth"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
 )
 
 // Accumulator is the constructor for the accumulator application.
 type Accumulator struct {
-	server *web.Server
+	server      *web.Server
+	collector   *collector.Collector
+	broadcaster *store.Broadcaster
+	foundation  string
+	stream      bool
+	logger      *logging.Logger
 }
 
 // New configures and returns a new Accumulator
 func New(cfg Config) *Accumulator {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
 	client := &http.Client{
 		Timeout: 5 * time.Second,
 		Transport: &http.Transport{
@@ -26,22 +38,92 @@ func New(cfg Config) *Accumulator {
 
 	a := auth.NewAuthenticator(cfg.ClientID, cfg.ClientSecret, cfg.UAAAddr,
 		auth.WithHTTPClient(client),
+		auth.WithLogger(logger),
 	)
 
-	log.Printf("initializing collector with nozzles: %+v", cfg.NozzleAddrs)
+	logger.Info("initializing collector", "nozzles", cfg.NozzleAddrs)
 	c := collector.New(cfg.NozzleAddrs, a, cfg.NozzleAppGUID, nil,
 		collector.WithHTTPClient(client),
+		collector.WithStreamMergeTimeout(cfg.StreamMergeTimeout),
+		collector.WithLogger(logger),
 	)
-	s := web.NewServer(cfg.Port, a.CheckToken, c, cfg.RateInterval,
-		web.WithLogWriter(cfg.LogWriter),
-	)
+	b := store.NewBroadcaster()
+
+	var rs web.RateStore = c
+	opts := []web.ServerOption{
+		web.WithLogger(logger),
+		web.WithRateStream(b),
+	}
+
+	var foundation string
+	if len(cfg.Upstreams) > 0 {
+		var local collector.RateSource
+		if len(cfg.NozzleAddrs) > 0 {
+			local = c
+			foundation = cfg.Foundation
+		}
+
+		var upstreams []collector.Upstream
+		for _, u := range cfg.Upstreams {
+			logger.Info("federating accumulator", "foundation", u.Foundation, "addr", u.Addr)
+			upstreams = append(upstreams, collector.Upstream{
+				Foundation: u.Foundation,
+				Addr:       u.Addr,
+				Auth: auth.NewAuthenticator(u.ClientID, u.ClientSecret, u.UAAAddr,
+					auth.WithHTTPClient(client),
+					auth.WithLogger(logger),
+				),
+			})
+		}
+
+		f := collector.NewFederation(foundation, local, upstreams, client,
+			collector.WithFederationLogger(logger),
+		)
+		rs = f
+		opts = append(opts, web.WithFederationStatus(f))
+	}
+
+	s := web.NewServer(cfg.Port, a.CheckToken, rs, cfg.RateInterval, opts...)
 
 	return &Accumulator{
-		server: s,
+		server:      s,
+		collector:   c,
+		broadcaster: b,
+		foundation:  foundation,
+		stream:      len(cfg.NozzleAddrs) > 0,
+		logger:      logger,
 	}
 }
 
-// Run starts the accumulator. This is a blocking method call.
-func (a *Accumulator) Run() {
-	a.server.Serve()
+// Run starts the accumulator. This is a blocking method call that gracefully
+// stops the accumulator once the given context is done. It closes the rate
+// streams of the nozzles and completes any active HTTP requests before it
+// returns.
+func (a *Accumulator) Run(ctx context.Context) {
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+
+		// Only the rates of the nozzles of the accumulator are streamed. They
+		// are namespaced the same way as federated rates.
+		if a.stream {
+			a.collector.Stream(ctx, func(r store.Rate) {
+				a.broadcaster.Publish(collector.Namespace(r, a.foundation))
+			})
+		}
+	}()
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		a.server.Serve()
+	}()
+
+	<-ctx.Done()
+	a.logger.Info("shutting down")
+
+	<-streamed
+	a.server.Stop()
+	<-served
+	a.logger.Info("shut down")
 }
@@ -2,13 +2,13 @@ package app
 
 import (
 	"crypto/tls"
-	"io"
-	"io/ioutil"
-	"log"
+	"encoding/json"
+	"fmt"
 	"os"
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 )
 
 // Config stores configuration data for the accumulator.
@@ -16,7 +16,7 @@ type Config struct {
 	UAAAddr        string   `env:"UAA_ADDR,        required"`
 	ClientID       string   `env:"CLIENT_ID,       required"`
 	ClientSecret   string   `env:"CLIENT_SECRET,   required, noreport"`
-	NozzleAddrs    []string `env:"NOZZLE_ADDRS,    required"`
+	NozzleAddrs    []string `env:"NOZZLE_ADDRS"`
 	Port           uint16   `env:"PORT,            required"`
 	SkipCertVerify bool     `env:"SKIP_CERT_VERIFY"`
 
@@ -24,45 +24,92 @@ type Config struct {
 	// POLLING_INTERVAL of the nozzle.
 	RateInterval time.Duration `env:"RATE_INTERVAL"`
 
+	// StreamMergeTimeout is how long the accumulator will wait for every
+	// nozzle to stream a rate before streaming the partial sum to clients.
+	StreamMergeTimeout time.Duration `env:"STREAM_MERGE_TIMEOUT"`
+
 	// VCapApplication is used to detect whether or not the application is
 	// deployed as a CF application. If it is the NOZZLE_COUNT and
 	// NOZZLE_APP_GUID  are required.
 	VCapApplication string `env:"VCAP_APPLICATION"`
 	NozzleCount     int    `env:"NOZZLE_COUNT"`
 	NozzleAppGUID   string `env:"NOZZLE_APP_GUID"`
-	LogWriter       io.Writer
+
+	// LogLevel is the minimum level of the lines that are logged: debug,
+	// info, warn or error.
+	LogLevel string `env:"LOG_LEVEL"`
+	Logger   *logging.Logger
+
+	// Foundation is the name the rates of the nozzles are namespaced with
+	// when federating. FederationUpstreams is a JSON list of the
+	// accumulators of other foundations whose rates are federated, each in
+	// the format of Upstream. NOZZLE_ADDRS is optional when federating.
+	Foundation          string `env:"FOUNDATION"`
+	FederationUpstreams string `env:"FEDERATION_UPSTREAMS, noreport"`
+
+	// Upstreams are the parsed FederationUpstreams.
+	Upstreams []Upstream
 
 	TLSConfig *tls.Config
 }
 
+// Upstream is the configuration of a federated accumulator. Requests to it
+// are authenticated with a token of its own UAA.
+type Upstream struct {
+	Foundation   string `json:"foundation"`
+	Addr         string `json:"addr"`
+	UAAAddr      string `json:"uaa_addr"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
 // LoadConfig loads the configuration settings from the current environment.
 func LoadConfig() Config {
 	cfg := Config{
-		SkipCertVerify: false,
-		RateInterval:   time.Minute,
-		LogWriter:      os.Stdout,
+		SkipCertVerify:     false,
+		RateInterval:       time.Minute,
+		StreamMergeTimeout: 10 * time.Second,
+		LogLevel:           "info",
 	}
 
 	if err := envstruct.Load(&cfg); err != nil {
-		log.Fatalf("failed to load config: %s", err)
+		logging.Default().Fatal("failed to load config", "error", err)
+	}
+
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logging.Default().Fatal("failed to load config", "error", err)
+	}
+	cfg.Logger = logging.New(os.Stdout, level)
+
+	upstreams, err := parseUpstreams(cfg.FederationUpstreams)
+	if err != nil {
+		cfg.Logger.Fatal("failed to load config", "error", err)
+	}
+	cfg.Upstreams = upstreams
+
+	if len(cfg.Upstreams) == 0 && len(cfg.NozzleAddrs) == 0 {
+		cfg.Logger.Fatal("failed to load config", "error", "NOZZLE_ADDRS is required without FEDERATION_UPSTREAMS")
+	}
+
+	if len(cfg.Upstreams) > 0 && len(cfg.NozzleAddrs) > 0 && cfg.Foundation == "" {
+		cfg.Logger.Fatal("failed to load config", "error", "FOUNDATION is required to federate the rates of NOZZLE_ADDRS")
 	}
 
 	// If deployed as a CF application, validate additional required
 	// configuration and update NozzleAddrs to have same number of addresses as
-	// NozzleCount.
-	if cfg.VCapApplication != "" {
-		cfg.LogWriter = ioutil.Discard
-
+	// NozzleCount. A federating accumulator may not have nozzles of its own.
+	if cfg.VCapApplication != "" && len(cfg.NozzleAddrs) > 0 {
 		if cfg.NozzleCount == 0 {
-			log.Fatalf("failed to load config: NOZZLE_COUNT must not be 0 when deployed as CF application")
+			cfg.Logger.Fatal("failed to load config", "error", "NOZZLE_COUNT must not be 0 when deployed as CF application")
 		}
 
 		if len(cfg.NozzleAddrs) != 1 {
-			log.Fatalf("failed to load config: NOZZLE_ADDRS must contain only 1 address when deployed as a CF application")
+			cfg.Logger.Fatal("failed to load config", "error", "NOZZLE_ADDRS must contain only 1 address when deployed as a CF application")
 		}
 
 		if cfg.NozzleAppGUID == "" {
-			log.Fatalf("failed to load config: NOZZLE_APP_GUID cannot be empty when deployed as CF application")
+			cfg.Logger.Fatal("failed to load config", "error", "NOZZLE_APP_GUID cannot be empty when deployed as CF application")
 		}
 
 		addrs := make([]string, 0, cfg.NozzleCount)
@@ -77,3 +124,29 @@ func LoadConfig() Config {
 
 	return cfg
 }
+
+// parseUpstreams parses the FEDERATION_UPSTREAMS JSON list.
+func parseUpstreams(v string) ([]Upstream, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var upstreams []Upstream
+	if err := json.Unmarshal([]byte(v), &upstreams); err != nil {
+		return nil, fmt.Errorf("failed to parse FEDERATION_UPSTREAMS: %s", err)
+	}
+
+	foundations := make(map[string]bool)
+	for _, u := range upstreams {
+		if u.Foundation == "" || u.Addr == "" || u.UAAAddr == "" || u.ClientID == "" || u.ClientSecret == "" {
+			return nil, fmt.Errorf("upstream %q requires foundation, addr, uaa_addr, client_id and client_secret", u.Addr)
+		}
+
+		if foundations[u.Foundation] {
+			return nil, fmt.Errorf("foundation %q is configured more than once in FEDERATION_UPSTREAMS", u.Foundation)
+		}
+		foundations[u.Foundation] = true
+	}
+
+	return upstreams, nil
+}
@@ -1,10 +1,25 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/cmd/accumulator/app"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 )
 
 func main() {
 	cfg := app.LoadConfig()
-	app.New(cfg).Run()
+
+	logging.SetDefault(cfg.Logger)
+	log.SetFlags(0)
+	log.SetOutput(cfg.Logger.StdWriter())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	app.New(cfg).Run(ctx)
 }
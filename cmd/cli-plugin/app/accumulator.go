@@ -0,0 +1,238 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// internalDomainSuffix is the suffix of domains that are only routable from
+// within the platform via container to container networking.
+const internalDomainSuffix = ".internal"
+
+// pluginConfig is the configuration persisted between invocations of the
+// plugin.
+type pluginConfig struct {
+	AccumulatorURL   string `json:"accumulator_url,omitempty"`
+	AccumulatorApp   string `json:"accumulator_app,omitempty"`
+	AccumulatorRoute string `json:"accumulator_route,omitempty"`
+	InsecureTCPRoute bool   `json:"insecure_tcp_route,omitempty"`
+}
+
+// loadConfig reads the plugin config from the given path. A missing config
+// file or empty path results in an empty config.
+func loadConfig(path string) (pluginConfig, error) {
+	var c pluginConfig
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+
+	return c, nil
+}
+
+// saveConfig writes the plugin config to the given path, creating the parent
+// directory if needed.
+func saveConfig(path string, c pluginConfig) error {
+	if path == "" {
+		return fmt.Errorf("no config path is configured")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// configure persists the accumulator URL or app name and route given on the
+// command line. When neither is given the current config is written instead.
+func configure(c pluginConfig, f flags, path string, w io.Writer) error {
+	switch {
+	case f.accumulatorURL != "":
+		c = pluginConfig{AccumulatorURL: f.accumulatorURL}
+	case len(f.args) == 1 || f.route != "":
+		c = pluginConfig{
+			AccumulatorRoute: f.route,
+			InsecureTCPRoute: f.insecureTCPRoute,
+		}
+		if len(f.args) == 1 {
+			c.AccumulatorApp = f.args[0]
+		}
+	default:
+		switch {
+		case c.AccumulatorURL != "":
+			fmt.Fprintf(w, "Accumulator URL: %s\n", c.AccumulatorURL)
+		case c.AccumulatorApp != "" || c.AccumulatorRoute != "":
+			app := c.AccumulatorApp
+			if app == "" {
+				app = "nn-accumulator"
+			}
+			fmt.Fprintf(w, "Accumulator app: %s\n", app)
+			if c.AccumulatorRoute != "" {
+				fmt.Fprintf(w, "Accumulator route: %s\n", c.AccumulatorRoute)
+			}
+		default:
+			fmt.Fprint(w, "No accumulator configured, using the nn-accumulator app\n")
+		}
+		return nil
+	}
+
+	if err := saveConfig(path, c); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Saved accumulator to %s\n", path)
+	return nil
+}
+
+// accumulatorAddr returns the base URL of the accumulator from the routes of
+// the given app. When a route is given, only that route is used. Otherwise
+// HTTP routes are preferred over TCP routes and routes without a path are
+// preferred over routes with a path. Routes on internal domains are ignored as
+// they are not reachable from the CLI. TCP routes are only used when allowTCP
+// is set as the token is sent to them in plain text.
+func accumulatorAddr(
+	app plugin_models.GetAppModel,
+	route string,
+	allowTCP bool,
+) (string, error) {
+	if len(app.Routes) < 1 {
+		return "", fmt.Errorf(
+			"No routes found for %s, use --accumulator-url to set the accumulator URL",
+			app.Name,
+		)
+	}
+
+	var (
+		best     string
+		bestRank = -1
+		names    []string
+		internal []string
+		tcp      []string
+	)
+	for _, r := range app.Routes {
+		names = append(names, routeName(r))
+		if route != "" && routeName(r) != route {
+			continue
+		}
+
+		if strings.HasSuffix(r.Domain.Name, internalDomainSuffix) {
+			internal = append(internal, routeURL(r))
+			continue
+		}
+
+		if r.Port != 0 && !allowTCP {
+			tcp = append(tcp, routeName(r))
+			continue
+		}
+
+		rank := routeRank(r)
+		if rank > bestRank {
+			best, bestRank = routeURL(r), rank
+		}
+	}
+
+	if bestRank >= 0 {
+		return best, nil
+	}
+
+	switch {
+	case len(internal) == 0 && len(tcp) == 0:
+		return "", fmt.Errorf(
+			"Route %s not found for %s, expected one of %s",
+			route,
+			app.Name,
+			strings.Join(names, ", "),
+		)
+	case len(tcp) > 0:
+		return "", fmt.Errorf(
+			"%s is only reachable on TCP routes (%s) which would receive the token in plain text, use --insecure-tcp-route to use them anyway",
+			app.Name,
+			strings.Join(tcp, ", "),
+		)
+	default:
+		return "", fmt.Errorf(
+			"%s is only reachable on internal routes (%s), use --accumulator-url to set an externally reachable URL",
+			app.Name,
+			strings.Join(internal, ", "),
+		)
+	}
+}
+
+// routeRank ranks routes by preference, higher is better.
+func routeRank(r plugin_models.GetApp_RouteSummary) int {
+	rank := 0
+	if r.Port == 0 {
+		rank += 2
+	}
+
+	if strings.Trim(r.Path, "/") == "" {
+		rank++
+	}
+
+	return rank
+}
+
+// routeName returns the name of the given route as given to --route, e.g.
+// nn.example.com/accumulator or tcp.example.com:1024.
+func routeName(r plugin_models.GetApp_RouteSummary) string {
+	if r.Port != 0 {
+		return fmt.Sprintf("%s:%d", r.Domain.Name, r.Port)
+	}
+
+	name := r.Domain.Name
+	if r.Host != "" {
+		name = r.Host + "." + name
+	}
+
+	path := strings.Trim(r.Path, "/")
+	if path != "" {
+		name += "/" + path
+	}
+
+	return name
+}
+
+// routeURL returns the URL for the given route. HTTP routes are served by the
+// gorouter over HTTPS. TCP routes are forwarded directly to the accumulator
+// which serves plain HTTP.
+func routeURL(r plugin_models.GetApp_RouteSummary) string {
+	if r.Port != 0 {
+		return fmt.Sprintf("http://%s:%d", r.Domain.Name, r.Port)
+	}
+
+	host := r.Domain.Name
+	if r.Host != "" {
+		host = r.Host + "." + host
+	}
+
+	path := strings.TrimRight(r.Path, "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return fmt.Sprintf("https://%s%s", host, path)
+}
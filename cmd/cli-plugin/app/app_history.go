@@ -0,0 +1,162 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+)
+
+// appHistory is the history of a single app's log volume over the window
+// retained by the accumulator.
+type appHistory struct {
+	App           string          `json:"app"`
+	AppGUID       string          `json:"app_guid"`
+	Rank          int             `json:"rank"`
+	Apps          int             `json:"apps"`
+	Count         uint64          `json:"count"`
+	PlatformCount uint64          `json:"platform_count"`
+	Share         float64         `json:"share"`
+	Buckets       []appHistoryRow `json:"buckets"`
+}
+
+// appHistoryRow is the count of every instance of an app in a single bucket.
+type appHistoryRow struct {
+	Timestamp int64          `json:"timestamp"`
+	Count     uint64         `json:"count"`
+	Instances map[int]uint64 `json:"instances"`
+}
+
+// newAppHistory builds the history of the app with the given GUID from the
+// given rates. The rank of the app is its position amongst every app by total
+// volume over all of the rates, starting at 1, with apps of equal volume
+// sharing a rank. The rank is 0 if the app did not produce any logs.
+func newAppHistory(name, guid string, rates []store.Rate) appHistory {
+	h := appHistory{
+		App:     name,
+		AppGUID: guid,
+		Buckets: make([]appHistoryRow, 0, len(rates)),
+	}
+
+	totals := make(map[string]uint64)
+	for _, r := range rates {
+		row := appHistoryRow{
+			Timestamp: r.Timestamp,
+			Instances: make(map[int]uint64),
+		}
+
+		for k, v := range r.Counts {
+			gi := collector.GUIDIndex(k)
+			totals[gi.GUID()] += v
+			h.PlatformCount += v
+
+			if gi.GUID() != guid {
+				continue
+			}
+
+			index, _ := strconv.Atoi(gi.Index())
+			row.Instances[index] += v
+			row.Count += v
+		}
+
+		h.Count += row.Count
+		h.Buckets = append(h.Buckets, row)
+	}
+
+	h.Apps = len(totals)
+	if h.Count > 0 {
+		h.Rank = 1
+		for _, v := range totals {
+			if v > h.Count {
+				h.Rank++
+			}
+		}
+	}
+
+	if h.PlatformCount > 0 {
+		h.Share = float64(h.Count) / float64(h.PlatformCount) * 100
+	}
+
+	return h
+}
+
+// instances returns the sorted instance indexes seen in any bucket.
+func (h appHistory) instances() []int {
+	seen := make(map[int]bool)
+	var indexes []int
+	for _, b := range h.Buckets {
+		for i := range b.Instances {
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+func writeAppHistoryTable(w io.Writer, h appHistory) error {
+	fmt.Fprintf(w, "App %s (%s)\n", h.App, h.AppGUID)
+	if h.Rank == 0 {
+		fmt.Fprintf(w, "Rank: no logs in the last %d buckets\n", len(h.Buckets))
+	} else {
+		fmt.Fprintf(w, "Rank: %d of %d apps\n", h.Rank, h.Apps)
+	}
+	fmt.Fprintf(w, "Share: %.2f%% of %s logs\n\n", h.Share, plainNumber(h.PlatformCount))
+
+	indexes := h.instances()
+
+	tw := tabwriter.NewWriter(w, 4, 2, 2, ' ', 0)
+	fmt.Fprint(tw, "Time\tTotal")
+	for _, i := range indexes {
+		fmt.Fprintf(tw, "\t/%d", i)
+	}
+	fmt.Fprint(tw, "\n")
+
+	for _, b := range h.Buckets {
+		fmt.Fprintf(tw, "%s\t%s",
+			time.Unix(b.Timestamp, 0).Format("15:04:05"),
+			plainNumber(b.Count),
+		)
+		for _, i := range indexes {
+			fmt.Fprintf(tw, "\t%s", plainNumber(b.Instances[i]))
+		}
+		fmt.Fprint(tw, "\n")
+	}
+
+	return tw.Flush()
+}
+
+func writeAppHistoryCSV(w io.Writer, h appHistory) error {
+	indexes := h.instances()
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"timestamp", "app", "app_guid", "instance_index", "count"})
+	for _, b := range h.Buckets {
+		for _, i := range indexes {
+			count, ok := b.Instances[i]
+			if !ok {
+				continue
+			}
+
+			cw.Write([]string{
+				strconv.FormatInt(b.Timestamp, 10),
+				h.App,
+				h.AppGUID,
+				strconv.Itoa(i),
+				strconv.FormatUint(count, 10),
+			})
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+)
+
+// diffResult is the change in log volume of each app between two windows as
+// returned by the accumulator.
+type diffResult struct {
+	Before diffWindow           `json:"before"`
+	After  diffWindow           `json:"after"`
+	Apps   []collector.AppDelta `json:"apps"`
+}
+
+type diffWindow struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+func (w diffWindow) String() string {
+	return fmt.Sprintf("%s-%s",
+		time.Unix(w.Start, 0).Format("15:04:05"),
+		time.Unix(w.End, 0).Format("15:04:05"),
+	)
+}
+
+// diffRow is a single app in the machine readable diff output formats.
+type diffRow struct {
+	Org            string  `json:"org"`
+	Space          string  `json:"space"`
+	App            string  `json:"app"`
+	AppGUID        string  `json:"app_guid"`
+	Before         uint64  `json:"before"`
+	After          uint64  `json:"after"`
+	Change         int64   `json:"change"`
+	RelativeChange float64 `json:"relative_change"`
+	New            bool    `json:"new"`
+}
+
+func fetchDiff(addr, authToken string, f flags, httpClient HTTPClient) (diffResult, error) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("%s/rates/diff?from=%d&to=%d&window=%d&order=%s",
+			addr,
+			f.from.Unix(),
+			f.to.Unix(),
+			int64(f.window/time.Second),
+			f.order,
+		),
+		nil,
+	)
+	if err != nil {
+		return diffResult{}, fmt.Errorf("Failed to build request to accumulator: %s", err)
+	}
+	req.Header.Set("Authorization", authToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return diffResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return diffResult{}, fmt.Errorf(
+			"Failed to get diff from accumulator, expected 200, got %d.",
+			resp.StatusCode,
+		)
+	}
+
+	var d diffResult
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return diffResult{}, fmt.Errorf("Failed to decode accumulator response: %s", err)
+	}
+
+	return d, nil
+}
+
+// filterDiff applies the name filter and limit to the given deltas and
+// returns the remaining deltas with the app info of each.
+func filterDiff(
+	deltas []collector.AppDelta,
+	f flags,
+	appInfoStore AppInfoStore,
+	log Logger,
+) ([]collector.AppDelta, map[collector.AppGUID]collector.AppInfo) {
+	guids := func(deltas []collector.AppDelta) []string {
+		res := make([]string, 0, len(deltas))
+		for _, d := range deltas {
+			res = append(res, d.AppGUID)
+		}
+		return res
+	}
+
+	var appInfos map[collector.AppGUID]collector.AppInfo
+	if f.filter.byName() {
+		appInfos = lookupAll(guids(deltas), appInfoStore, log)
+
+		var res []collector.AppDelta
+		for _, d := range deltas {
+			info, ok := appInfos[collector.AppGUID(d.AppGUID)]
+			if f.filter.matches(info, ok) {
+				res = append(res, d)
+			}
+		}
+		deltas = res
+	}
+
+	if limit := f.limitOr(10); len(deltas) > limit {
+		deltas = deltas[:limit]
+	}
+
+	if !f.filter.byName() {
+		appInfos = lookupAll(guids(deltas), appInfoStore, log)
+	}
+
+	return deltas, appInfos
+}
+
+func newDiffRows(
+	deltas []collector.AppDelta,
+	appInfos map[collector.AppGUID]collector.AppInfo,
+) []diffRow {
+	rows := make([]diffRow, 0, len(deltas))
+	for _, d := range deltas {
+		info := appInfos[collector.AppGUID(d.AppGUID)]
+		rows = append(rows, diffRow{
+			Org:            info.Org,
+			Space:          info.Space,
+			App:            info.Name,
+			AppGUID:        d.AppGUID,
+			Before:         d.Before,
+			After:          d.After,
+			Change:         d.Change,
+			RelativeChange: d.RelativeChange,
+			New:            d.New,
+		})
+	}
+
+	return rows
+}
+
+func writeDiffCSV(w io.Writer, rows []diffRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"org", "space", "app", "app_guid", "before", "after", "change", "relative_change", "new"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.Org,
+			r.Space,
+			r.App,
+			r.AppGUID,
+			strconv.FormatUint(r.Before, 10),
+			strconv.FormatUint(r.After, 10),
+			strconv.FormatInt(r.Change, 10),
+			strconv.FormatFloat(r.RelativeChange, 'f', -1, 64),
+			strconv.FormatBool(r.New),
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func writeDiffTable(
+	w io.Writer,
+	d diffResult,
+	deltas []collector.AppDelta,
+	appInfos map[collector.AppGUID]collector.AppInfo,
+	color bool,
+) error {
+	fmt.Fprintf(w, "Change from %s to %s\n\n", d.Before, d.After)
+
+	tw := tabwriter.NewWriter(w, 4, 2, 2, ' ', 0)
+	fmt.Fprint(tw, "Change\tRelative\tBefore\tAfter\tApp\n")
+	for _, delta := range deltas {
+		label := delta.AppGUID
+		if info, ok := appInfos[collector.AppGUID(delta.AppGUID)]; ok {
+			label = info.String()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			formattedChange(delta.Change),
+			formattedRelativeChange(delta, color),
+			plainNumber(delta.Before),
+			plainNumber(delta.After),
+			label,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// formattedRelativeChange returns the relative change as a percentage or
+// "new" for new producers. New producers are highlighted when color is
+// enabled.
+func formattedRelativeChange(d collector.AppDelta, color bool) string {
+	s := "new"
+	if !d.New {
+		s = fmt.Sprintf("%+.0f%%", d.RelativeChange*100)
+	}
+
+	if !color {
+		return s
+	}
+
+	// Every value in the column must contain color codes because the
+	// tabwriter does not ignore the escape sequences when calculating column
+	// width.
+	if d.New {
+		return fmt.Sprintf("\x1b[91;1m%s\x1b[0m", strings.ToUpper(s))
+	}
+	return fmt.Sprintf("\x1b[91;0m%s\x1b[0m", s)
+}
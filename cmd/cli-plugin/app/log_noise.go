@@ -2,15 +2,17 @@ package app
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"sort"
-	"text/tabwriter"
+	"strconv"
+	"strings"
 	"time"
 
-	"code.cloudfoundry.org/cli/plugin/models"
-
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 
@@ -25,82 +27,248 @@ func LogNoise(
 	appInfoStore AppInfoStore,
 	tableWriter io.Writer,
 	log Logger,
+	opts ...LogNoiseOption,
 ) {
-	appName := "nn-accumulator"
+	cfg := logNoiseConfig{
+		tty: true,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	f, err := parseFlags(args)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
 
-	if len(args) == 1 {
-		appName = args[0]
+	// The app subcommand shows the history of a single app, e.g.
+	// log-noise app my-app [accumulator app name]. The diff subcommand
+	// compares two windows, e.g. log-noise diff [accumulator app name]. The
+	// config subcommand persists the accumulator to use, e.g. log-noise
+	// config [--accumulator-url URL] [--route ROUTE] [accumulator app name].
+	var command, target string
+	switch {
+	case len(f.args) > 1 && f.args[0] == "app":
+		command, target = "app", f.args[1]
+		f.args = f.args[2:]
+	case len(f.args) > 0 && (f.args[0] == "diff" || f.args[0] == "config"):
+		command = f.args[0]
+		f.args = f.args[1:]
 	}
 
-	if len(args) > 1 {
-		log.Fatalf("Invalid number of arguments, expected 0 or 1, got %d", len(args))
+	if len(f.args) > 1 {
+		log.Fatalf("Invalid number of arguments, expected 0 or 1, got %d", len(f.args))
 	}
 
-	app, err := conn.GetApp(appName)
+	pc, err := loadConfig(cfg.configPath)
 	if err != nil {
-		log.Fatalf("%s", err)
+		log.Fatalf("Failed to read plugin config: %s", err)
+	}
+
+	if command == "config" {
+		if err := configure(pc, f, cfg.configPath, tableWriter); err != nil {
+			log.Fatalf("Failed to save plugin config: %s", err)
+		}
+		return
 	}
 
+	// An accumulator given on the command line takes precedence over the
+	// persisted config.
+	addr := f.accumulatorURL
+	if addr == "" && len(f.args) == 0 {
+		addr = pc.AccumulatorURL
+	}
+
+	if addr == "" {
+		appName := "nn-accumulator"
+		if pc.AccumulatorApp != "" {
+			appName = pc.AccumulatorApp
+		}
+
+		// The saved route only applies to the saved app.
+		route, insecureTCPRoute := pc.AccumulatorRoute, pc.InsecureTCPRoute
+		if len(f.args) == 1 {
+			appName = f.args[0]
+			route, insecureTCPRoute = "", false
+		}
+
+		if f.route != "" {
+			route = f.route
+		}
+		insecureTCPRoute = insecureTCPRoute || f.insecureTCPRoute
+
+		app, err := conn.GetApp(appName)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+
+		addr, err = accumulatorAddr(app, route, insecureTCPRoute)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
+	addr = strings.TrimRight(addr, "/")
+
 	authToken, err := conn.AccessToken()
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 
-	producers, err := topLogProducers(app, authToken, httpClient)
+	if command != "" && f.watch {
+		log.Fatalf("Watch mode is not supported for the %s subcommand", command)
+	}
+
+	switch command {
+	case "diff":
+		d, err := fetchDiff(addr, authToken, f, httpClient)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		deltas, appInfos := filterDiff(d.Apps, f, appInfoStore, log)
+
+		switch f.output {
+		case outputJSON:
+			err = writeJSON(tableWriter, newDiffRows(deltas, appInfos))
+		case outputCSV:
+			err = writeDiffCSV(tableWriter, newDiffRows(deltas, appInfos))
+		default:
+			err = writeDiffTable(tableWriter, d, deltas, appInfos, cfg.tty && !f.noColor)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write output: %s", err)
+		}
+		return
+	case "app":
+		h, err := targetAppHistory(conn, target, addr, authToken, httpClient, f)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+
+		switch f.output {
+		case outputJSON:
+			err = writeJSON(tableWriter, h)
+		case outputCSV:
+			err = writeAppHistoryCSV(tableWriter, h)
+		default:
+			err = writeAppHistoryTable(tableWriter, h)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write output: %s", err)
+		}
+		return
+	}
+
+	if f.watch {
+		if f.output != outputTable {
+			log.Fatalf("Output format %s is not supported in watch mode", f.output)
+		}
+
+		if f.since != 0 || !f.at.IsZero() {
+			log.Fatalf("--since and --at are not supported in watch mode")
+		}
+
+		w := &watcher{
+			addr:         addr,
+			conn:         conn,
+			httpClient:   httpClient,
+			appInfoStore: collector.NewCachedAppInfoStore(appInfoStore),
+			out:          tableWriter,
+			log:          log,
+			interval:     f.interval,
+			limit:        f.limitOr(watchRows),
+			filter:       f.filter,
+			minRate:      f.minRate,
+			tty:          cfg.tty,
+			input:        cfg.input,
+			rawMode:      cfg.rawMode,
+		}
+		w.run()
+		return
+	}
+
+	producers, err := topLogProducers(addr, authToken, httpClient, f)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
+	producers = producers.minRate(f.minRate, f.since)
+
+	// App names are only known after they are looked up so when filtering by
+	// name every producer has to be looked up before the top producers are
+	// known.
+	var appInfos map[collector.AppGUID]collector.AppInfo
+	if f.filter.byName() {
+		appInfos = lookupAll(producers.guids(), appInfoStore, log)
+		producers = producers.filter(f.filter, appInfos)
+	}
+
+	if limit := f.limitOr(10); len(producers) > limit {
+		producers = producers[:limit]
+	}
+
+	if !f.filter.byName() {
+		appInfos = lookupAll(producers.guids(), appInfoStore, log)
+	}
 
-	appInfos, err := fetchAppInfo(producers, appInfoStore)
+	switch f.output {
+	case outputJSON:
+		err = writeJSON(tableWriter, newOutputRows(producers, appInfos))
+	case outputCSV:
+		err = writeCSV(tableWriter, newOutputRows(producers, appInfos))
+	default:
+		err = writeTable(tableWriter, f.volumeTitle(), producers, appInfos, cfg.tty && !f.noColor)
+	}
 	if err != nil {
-		log.Printf("%s", err)
-	}
-
-	tw := tabwriter.NewWriter(tableWriter, 4, 2, 2, ' ', 0)
-	// Volume Last Minute column must contain color codes because the tabwriter
-	// does not ignore the escape sequences when calculating column width.
-	fmt.Fprint(tw, "\x1b[91;0mVolume Last Minute\x1b[0m\tApp Instance\n")
-	for _, item := range producers {
-		fmt.Fprintf(
-			tw,
-			"%s\t%s\n",
-			formattedNumber(item.count),
-			formattedAppInfo(item.appID, appInfos),
-		)
+		log.Fatalf("Failed to write output: %s", err)
 	}
-	tw.Flush()
 }
 
 func topLogProducers(
-	app plugin_models.GetAppModel,
+	addr string,
 	authToken string,
 	httpClient HTTPClient,
+	f flags,
 ) (counts, error) {
-	if len(app.Routes) < 1 {
-		return nil, fmt.Errorf("No routes found for %s", app.Name)
-	}
+	var rate store.Rate
+	if f.since > 0 {
+		end := time.Now()
+		if !f.at.IsZero() {
+			end = f.at
+		}
 
-	req, err := http.NewRequest(http.MethodGet, accumulatorEndpoint(app), nil)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to build request to accumulator: %s", err)
-	}
-	req.Header.Set("Authorization", authToken)
+		rates, err := fetchRange(
+			addr,
+			authToken,
+			end.Add(-f.since).Unix(),
+			end.Unix(),
+			httpClient,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rate = collector.Sum(rates)
+	} else {
+		req, err := http.NewRequest(http.MethodGet, accumulatorEndpoint(addr, f.at), nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to build request to accumulator: %s", err)
+		}
+		req.Header.Set("Authorization", authToken)
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf(
-			"Failed to get rates from accumulator, expected 200, got %d.",
-			resp.StatusCode,
-		)
-	}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf(
+				"Failed to get rates from accumulator, expected 200, got %d.",
+				resp.StatusCode,
+			)
+		}
 
-	var rate store.Rate
-	if err := json.NewDecoder(resp.Body).Decode(&rate); err != nil {
-		return nil, fmt.Errorf("Failed to decode accumulator response: %s", err)
+		if err := json.NewDecoder(resp.Body).Decode(&rate); err != nil {
+			return nil, fmt.Errorf("Failed to decode accumulator response: %s", err)
+		}
 	}
 
 	var c counts
@@ -113,38 +281,55 @@ func topLogProducers(
 
 	sort.Sort(sort.Reverse(c))
 
-	if len(c) > 10 {
-		c = c[:10]
-	}
 	return c, nil
 }
 
-func accumulatorEndpoint(app plugin_models.GetAppModel) string {
-	appRoute := fmt.Sprintf("%s.%s",
-		app.Routes[0].Host,
-		app.Routes[0].Domain.Name,
-	)
-	return fmt.Sprintf(
-		"https://%s/rates/%d?truncate_timestamp=true",
-		appRoute,
-		time.Now().Add(-30*time.Second).Unix(),
-	)
-}
+// targetAppHistory resolves the GUID of the target app and returns its
+// history over the requested window. Without a window the entire history
+// retained by the accumulator is used.
+func targetAppHistory(
+	conn plugin.CliConnection,
+	target string,
+	addr string,
+	authToken string,
+	httpClient HTTPClient,
+	f flags,
+) (appHistory, error) {
+	targetApp, err := conn.GetApp(target)
+	if err != nil {
+		return appHistory{}, err
+	}
 
-func fetchAppInfo(
-	producers counts,
-	appInfoStore AppInfoStore,
-) (map[collector.AppGUID]collector.AppInfo, error) {
-	var guids []string
-	for _, item := range producers {
-		guids = append(guids, item.appID.GUID())
+	end := time.Now()
+	if !f.at.IsZero() {
+		end = f.at
+	}
+
+	var start int64
+	if f.since > 0 {
+		start = end.Add(-f.since).Unix()
 	}
 
-	appInfos, err := appInfoStore.Lookup(guids)
+	rates, err := fetchRange(addr, authToken, start, end.Unix(), httpClient)
 	if err != nil {
-		return nil, err
+		return appHistory{}, err
 	}
-	return appInfos, nil
+
+	return newAppHistory(target, targetApp.Guid, rates), nil
+}
+
+// accumulatorEndpoint returns the endpoint for the rate at the given time.
+// When the time is zero the rate for the last complete minute is used.
+func accumulatorEndpoint(addr string, at time.Time) string {
+	if at.IsZero() {
+		at = time.Now().Add(-30 * time.Second)
+	}
+
+	return fmt.Sprintf(
+		"%s/rates/%d?truncate_timestamp=true",
+		addr,
+		at.Unix(),
+	)
 }
 
 func formattedAppInfo(
@@ -163,7 +348,24 @@ func formattedAppInfo(
 	)
 }
 
-func formattedNumber(i uint64) string {
+func formattedNumber(i uint64, color bool) string {
+	res := plainNumber(i)
+	if !color {
+		return res
+	}
+
+	if i >= 1000000 {
+		// Returns the number in red
+		return fmt.Sprintf("\x1b[91;1m%s\x1b[0m", res)
+	}
+
+	// Uses default color, however fixes issues with escape codes being
+	// calculated as part the column width.
+	return fmt.Sprintf("\x1b[91;0m%s\x1b[0m", res)
+}
+
+// plainNumber returns the given number with thousands separators.
+func plainNumber(i uint64) string {
 	str := []byte(fmt.Sprintf("%d", i))
 
 	counter := 0
@@ -177,14 +379,239 @@ func formattedNumber(i uint64) string {
 		counter++
 	}
 
-	if i >= 1000000 {
-		// Returns the number in red
-		return fmt.Sprintf("\x1b[91;1m%s\x1b[0m", res)
+	return string(res)
+}
+
+// LogNoiseOption is a func that is used to configure optional settings for
+// LogNoise.
+type LogNoiseOption func(*logNoiseConfig)
+
+// WithTTY configures whether or not the table writer is a terminal. When it
+// is, the table is colored and watch mode will redraw the table in full
+// screen. Defaults to true.
+func WithTTY(tty bool) LogNoiseOption {
+	return func(c *logNoiseConfig) {
+		c.tty = tty
 	}
+}
 
-	// Uses default color, however fixes issues with escape codes being
-	// calculated as part the column width.
-	return fmt.Sprintf("\x1b[91;0m%s\x1b[0m", res)
+// WithInput configures the reader that keyboard input is read from in watch
+// mode.
+func WithInput(r io.Reader) LogNoiseOption {
+	return func(c *logNoiseConfig) {
+		c.input = r
+	}
+}
+
+// WithRawMode configures a func that puts the terminal into raw mode while in
+// watch mode. The returned func is used to restore the terminal.
+func WithRawMode(f func() (func(), error)) LogNoiseOption {
+	return func(c *logNoiseConfig) {
+		c.rawMode = f
+	}
+}
+
+// WithConfigPath configures the path of the file the plugin config is
+// persisted to. Without a path, no config is read or saved.
+func WithConfigPath(path string) LogNoiseOption {
+	return func(c *logNoiseConfig) {
+		c.configPath = path
+	}
+}
+
+type logNoiseConfig struct {
+	tty        bool
+	input      io.Reader
+	rawMode    func() (func(), error)
+	configPath string
+}
+
+type flags struct {
+	watch    bool
+	interval time.Duration
+	output   string
+	noColor  bool
+	limit    int
+	since    time.Duration
+	at       time.Time
+	minRate  uint64
+	filter   filter
+	from     time.Time
+	to       time.Time
+	window   time.Duration
+	order    collector.DiffOrder
+
+	accumulatorURL   string
+	route            string
+	insecureTCPRoute bool
+
+	args []string
+}
+
+// limitOr returns the configured limit or the given default when no limit
+// was given.
+func (f flags) limitOr(d int) int {
+	if f.limit == 0 {
+		return d
+	}
+
+	return f.limit
+}
+
+// volumeTitle returns the title of the volume column in the table output.
+func (f flags) volumeTitle() string {
+	switch {
+	case f.since > 0 && !f.at.IsZero():
+		return fmt.Sprintf("Volume %s Before %s", shortDuration(f.since), f.at.Format(time.RFC3339))
+	case f.since > 0:
+		return fmt.Sprintf("Volume Last %s", shortDuration(f.since))
+	case !f.at.IsZero():
+		return fmt.Sprintf("Volume At %s", f.at.Format(time.RFC3339))
+	default:
+		return "Volume Last Minute"
+	}
+}
+
+// parseFlags parses the given args allowing flags to be given before or after
+// positional arguments.
+func parseFlags(args []string) (flags, error) {
+	var (
+		f   flags
+		err error
+	)
+
+	fs := flag.NewFlagSet("log-noise", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.BoolVar(&f.watch, "watch", false, "")
+	fs.DurationVar(&f.interval, "interval", time.Minute, "")
+	fs.StringVar(&f.output, "output", outputTable, "")
+	fs.StringVar(&f.accumulatorURL, "accumulator-url", "", "")
+	fs.StringVar(&f.route, "route", "", "")
+	fs.BoolVar(&f.insecureTCPRoute, "insecure-tcp-route", false, "")
+	fs.BoolVar(&f.noColor, "no-color", false, "")
+	fs.IntVar(&f.limit, "limit", 0, "")
+	fs.DurationVar(&f.since, "since", 0, "")
+	fs.Uint64Var(&f.minRate, "min-rate", 0, "")
+	fs.StringVar(&f.filter.org, "org", "", "")
+	fs.StringVar(&f.filter.space, "space", "", "")
+	fs.StringVar(&f.filter.app, "app", "", "")
+	at := fs.String("at", "", "")
+	from := fs.String("from", "30m", "")
+	to := fs.String("to", "now", "")
+	fs.DurationVar(&f.window, "window", 5*time.Minute, "")
+	order := fs.String("order", string(collector.DiffOrderAbsolute), "")
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return flags{}, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+
+		f.args = append(f.args, args[0])
+		args = args[1:]
+	}
+
+	if f.interval <= 0 {
+		return flags{}, fmt.Errorf("Invalid interval %s, must be greater than 0", f.interval)
+	}
+
+	if f.limit < 0 {
+		return flags{}, fmt.Errorf("Invalid limit %d, must be greater than 0", f.limit)
+	}
+
+	if f.since < 0 {
+		return flags{}, fmt.Errorf("Invalid since %s, must be greater than 0", f.since)
+	}
+
+	if *at != "" {
+		t, err := parseTime(*at)
+		if err != nil {
+			return flags{}, err
+		}
+		f.at = t
+	}
+
+	if f.accumulatorURL != "" {
+		u, err := url.Parse(f.accumulatorURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return flags{}, fmt.Errorf("Invalid accumulator URL %s, expected an http or https URL", f.accumulatorURL)
+		}
+	}
+
+	now := time.Now()
+	if f.from, err = parseRelativeTime(*from, now); err != nil {
+		return flags{}, err
+	}
+
+	if f.to, err = parseRelativeTime(*to, now); err != nil {
+		return flags{}, err
+	}
+
+	if f.from.After(f.to) {
+		return flags{}, fmt.Errorf("Invalid window, --from must be before --to")
+	}
+
+	if f.window <= 0 {
+		return flags{}, fmt.Errorf("Invalid window %s, must be greater than 0", f.window)
+	}
+
+	if f.order, err = collector.ParseDiffOrder(*order); err != nil {
+		return flags{}, fmt.Errorf("Invalid order %s, expected absolute or relative", *order)
+	}
+
+	switch f.output {
+	case outputTable, outputJSON, outputCSV:
+	default:
+		return flags{}, fmt.Errorf("Invalid output format %s, expected table, json or csv", f.output)
+	}
+
+	return f, nil
+}
+
+// parseTime parses either an RFC3339 time or a Unix timestamp.
+func parseTime(s string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid time %s, expected RFC3339 or Unix timestamp", s)
+	}
+
+	return t, nil
+}
+
+// parseRelativeTime parses "now", a duration before the given time, e.g.
+// 30m, or any time accepted by parseTime.
+func parseRelativeTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return parseTime(s)
+}
+
+// shortDuration formats the given duration without trailing zero units,
+// e.g. 15m rather than 15m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+
+	return s
 }
 
 // Logger defines the interface for logging.
@@ -213,3 +640,83 @@ type counts []count
 func (c counts) Len() int           { return len(c) }
 func (c counts) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
 func (c counts) Less(i, j int) bool { return c[i].count < c[j].count }
+
+// guids returns the unique app GUIDs of the counts.
+func (c counts) guids() []string {
+	var guids []string
+	seen := make(map[string]bool)
+	for _, item := range c {
+		g := item.appID.GUID()
+		if !seen[g] {
+			seen[g] = true
+			guids = append(guids, g)
+		}
+	}
+
+	return guids
+}
+
+// minRate returns the counts that averaged at least the given number of logs
+// per minute over the given window. A zero window is treated as a single
+// minute.
+func (c counts) minRate(rate uint64, window time.Duration) counts {
+	if rate == 0 {
+		return c
+	}
+
+	minutes := uint64(window / time.Minute)
+	if minutes == 0 {
+		minutes = 1
+	}
+
+	var res counts
+	for _, item := range c {
+		if item.count/minutes >= rate {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+// filter returns the counts whose app info matches the given filter.
+func (c counts) filter(f filter, appInfos map[collector.AppGUID]collector.AppInfo) counts {
+	var res counts
+	for _, item := range c {
+		info, ok := appInfos[collector.AppGUID(item.appID.GUID())]
+		if f.matches(info, ok) {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+// filter restricts log producers to the given org, space and app names. Empty
+// names match everything.
+type filter struct {
+	org   string
+	space string
+	app   string
+}
+
+// byName reports whether the filter restricts producers by name.
+func (f filter) byName() bool {
+	return f.org != "" || f.space != "" || f.app != ""
+}
+
+// matches reports whether the given app info matches the filter. Apps whose
+// info could not be looked up never match a filter by name.
+func (f filter) matches(info collector.AppInfo, ok bool) bool {
+	if !f.byName() {
+		return true
+	}
+
+	if !ok {
+		return false
+	}
+
+	return (f.org == "" || f.org == info.Org) &&
+		(f.space == "" || f.space == info.Space) &&
+		(f.app == "" || f.app == info.Name)
+}
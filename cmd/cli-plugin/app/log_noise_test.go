@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -258,6 +260,1064 @@ var _ = Describe("LogNoise", func() {
 
 		Expect(logger.fatalfMessage).To(Equal("Failed to get rates from accumulator, expected 200, got 400."))
 	})
+
+	Describe("windows and filters", func() {
+		It("limits the number of producers", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--limit", "2"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(tableWriter.String()).To(Equal("Volume Last Minute  App Instance\n" +
+				"1,234,567,890       org-1.space-1.name-1/1\n" +
+				"1,000               org-9.space-9.name-9/0\n",
+			))
+			Expect(appInfoStore.lookupGUIDs).To(ConsistOf("app-guid-1", "app-guid-9"))
+		})
+
+		It("sums the rates since the given duration", func() {
+			httpClient = newStubHTTPClient(`[
+				{"timestamp":1517855040,"counts":{"app-guid-1/0":100,"app-guid-2/0":1000}},
+				{"timestamp":1517855100,"counts":{"app-guid-1/0":1500}}
+			]`)
+
+			app.LogNoise(
+				cli,
+				[]string{"--since", "15m"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			url := `https:\/\/nn-accumulator\.localhost\/rates\?start=(\d+)&end=(\d+)`
+			Expect(httpClient.requestURL).To(MatchRegexp(url))
+			parts := regexp.MustCompile(url).FindStringSubmatch(httpClient.requestURL)
+			start, err := strconv.ParseInt(parts[1], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			end, err := strconv.ParseInt(parts[2], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(end).To(BeNumerically("~", time.Now().Unix(), 1))
+			Expect(end - start).To(Equal(int64(900)))
+
+			Expect(tableWriter.String()).To(Equal("Volume Last 15m  App Instance\n" +
+				"1,600            org-1.space-1.name-1/0\n" +
+				"1,000            org-2.space-2.name-2/0\n",
+			))
+		})
+
+		It("requests the rate at the given time", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--at", "2018-02-05T18:25:30Z"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(httpClient.requestURL).To(Equal(
+				"https://nn-accumulator.localhost/rates/1517855130?truncate_timestamp=true",
+			))
+			Expect(tableWriter.String()).To(HavePrefix("Volume At 2018-02-05T18:25:30Z"))
+		})
+
+		It("requests the window before the given time", func() {
+			httpClient = newStubHTTPClient(`[]`)
+
+			app.LogNoise(
+				cli,
+				[]string{"--since", "1h", "--at", "1517855130"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(httpClient.requestURL).To(Equal(
+				"https://nn-accumulator.localhost/rates?start=1517851530&end=1517855130",
+			))
+		})
+
+		It("filters by org, space and app after looking up names", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--org", "org-1", "--space", "space-1", "--app", "name-1"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(appInfoStore.lookupGUIDs).To(HaveLen(10))
+			Expect(tableWriter.String()).To(Equal("Volume Last Minute  App Instance\n" +
+				"1,234,567,890       org-1.space-1.name-1/1\n" +
+				"200                 org-1.space-1.name-1/0\n",
+			))
+		})
+
+		It("excludes producers that can not be looked up when filtering", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--org", "org-2"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(tableWriter.String()).To(Equal("Volume Last Minute  App Instance\n" +
+				"300                 org-2.space-2.name-2/0\n",
+			))
+		})
+
+		It("excludes producers below the minimum rate", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--min-rate", "900"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(tableWriter.String()).To(Equal("Volume Last Minute  App Instance\n" +
+				"1,234,567,890       org-1.space-1.name-1/1\n" +
+				"1,000               org-9.space-9.name-9/0\n" +
+				"900                 org-8.space-8.name-8/0\n",
+			))
+		})
+
+		It("averages the minimum rate over the window", func() {
+			httpClient = newStubHTTPClient(`[
+				{"timestamp":1517855040,"counts":{"app-guid-1/0":100,"app-guid-2/0":1000}}
+			]`)
+
+			app.LogNoise(
+				cli,
+				[]string{"--since", "10m", "--min-rate", "50"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(tableWriter.String()).To(Equal("Volume Last 10m  App Instance\n" +
+				"1,000            org-2.space-2.name-2/0\n",
+			))
+		})
+
+		It("fatally logs if the time is invalid", func() {
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--at", "yesterday"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("Invalid time yesterday, expected RFC3339 or Unix timestamp"))
+		})
+
+		It("fatally logs if a window is given in watch mode", func() {
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--watch", "--since", "5m"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--since and --at are not supported in watch mode"))
+		})
+	})
+
+	Describe("app subcommand", func() {
+		BeforeEach(func() {
+			httpClient = newStubHTTPClient(`[
+				{
+					"timestamp":1517855040,
+					"counts":{
+						"my-app-guid/0":100,
+						"my-app-guid/1":300,
+						"app-guid-1/0":1000,
+						"app-guid-2/0":200
+					}
+				},
+				{
+					"timestamp":1517855100,
+					"counts":{
+						"my-app-guid/1":600,
+						"app-guid-1/0":2000,
+						"app-guid-2/0":800
+					}
+				}
+			]`)
+		})
+
+		It("requests the entire history from the accumulator", func() {
+			app.LogNoise(
+				cli,
+				[]string{"app", "my-app", "accumulator"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(cli.requestedAppNames).To(Equal([]string{"accumulator", "my-app"}))
+			url := `https:\/\/nn-accumulator\.localhost\/rates\?start=0&end=(\d+)`
+			Expect(httpClient.requestURL).To(MatchRegexp(url))
+			Expect(httpClient.requestHeaders.Get("Authorization")).To(
+				Equal("my-token"),
+			)
+		})
+
+		It("shows the history, rank and share of the app", func() {
+			app.LogNoise(
+				cli,
+				[]string{"app", "my-app"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(cli.requestedAppNames).To(Equal([]string{"nn-accumulator", "my-app"}))
+			lines := strings.Split(tableWriter.String(), "\n")
+			Expect(lines[0]).To(Equal("App my-app (my-app-guid)"))
+			Expect(lines[1]).To(Equal("Rank: 2 of 3 apps"))
+			Expect(lines[2]).To(Equal("Share: 20.00% of 5,000 logs"))
+			Expect(lines[4]).To(Equal("Time      Total  /0   /1"))
+			Expect(lines[5]).To(MatchRegexp(`^\d\d:\d\d:00  400    100  300$`))
+			Expect(lines[6]).To(MatchRegexp(`^\d\d:\d\d:00  600    0    600$`))
+		})
+
+		It("writes the history as json", func() {
+			app.LogNoise(
+				cli,
+				[]string{"app", "my-app", "--output", "json"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(MatchJSON(`{
+				"app": "my-app",
+				"app_guid": "my-app-guid",
+				"rank": 2,
+				"apps": 3,
+				"count": 1000,
+				"platform_count": 5000,
+				"share": 20,
+				"buckets": [
+					{"timestamp": 1517855040, "count": 400, "instances": {"0": 100, "1": 300}},
+					{"timestamp": 1517855100, "count": 600, "instances": {"1": 600}}
+				]
+			}`))
+		})
+
+		It("writes the history as csv", func() {
+			app.LogNoise(
+				cli,
+				[]string{"app", "my-app", "--output", "csv"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(Equal(
+				"timestamp,app,app_guid,instance_index,count\n" +
+					"1517855040,my-app,my-app-guid,0,100\n" +
+					"1517855040,my-app,my-app-guid,1,300\n" +
+					"1517855100,my-app,my-app-guid,1,600\n",
+			))
+		})
+
+		It("reports when the app has not produced any logs", func() {
+			app.LogNoise(
+				cli,
+				[]string{"app", "quiet-app"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(ContainSubstring("Rank: no logs in the last 2 buckets\n"))
+			Expect(tableWriter.String()).To(ContainSubstring("Share: 0.00% of 5,000 logs\n"))
+		})
+
+		It("fatally logs if the app can not be found", func() {
+			cli.getAppError = errors.New("app not found")
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"app", "unknown-app"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("app not found"))
+		})
+	})
+
+	Describe("diff subcommand", func() {
+		BeforeEach(func() {
+			httpClient = newStubHTTPClient(`{
+				"before": {"start": 1517853000, "end": 1517853300},
+				"after": {"start": 1517854800, "end": 1517855100},
+				"order": "absolute",
+				"apps": [
+					{"app_guid": "app-guid-1", "before": 200, "after": 1200, "change": 1000, "relative_change": 5, "new": false},
+					{"app_guid": "app-guid-0", "before": 0, "after": 50, "change": 50, "relative_change": 0, "new": true},
+					{"app_guid": "app-guid-2", "before": 500, "after": 0, "change": -500, "relative_change": -1, "new": false}
+				]
+			}`)
+		})
+
+		It("requests the diff between the windows", func() {
+			app.LogNoise(
+				cli,
+				[]string{"diff", "accumulator", "--from", "1517853300", "--to", "now", "--window", "5m", "--order", "relative"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(cli.requestedAppName).To(Equal("accumulator"))
+			url := `https:\/\/nn-accumulator\.localhost\/rates\/diff\?from=1517853300&to=(\d+)&window=300&order=relative`
+			Expect(httpClient.requestURL).To(MatchRegexp(url))
+
+			parts := regexp.MustCompile(url).FindStringSubmatch(httpClient.requestURL)
+			to, err := strconv.ParseInt(parts[1], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(to).To(BeNumerically("~", time.Now().Unix(), 1))
+		})
+
+		It("defaults to comparing with 30 minutes ago", func() {
+			app.LogNoise(
+				cli,
+				[]string{"diff"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(cli.requestedAppName).To(Equal("nn-accumulator"))
+			url := `\/rates\/diff\?from=(\d+)&to=(\d+)&window=300&order=absolute`
+			parts := regexp.MustCompile(url).FindStringSubmatch(httpClient.requestURL)
+			Expect(parts).To(HaveLen(3))
+			from, err := strconv.ParseInt(parts[1], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			to, err := strconv.ParseInt(parts[2], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(to - from).To(Equal(int64(1800)))
+		})
+
+		It("highlights new producers", func() {
+			app.LogNoise(
+				cli,
+				[]string{"diff"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(tableWriter.String()).To(HavePrefix("Change from "))
+			Expect(tableWriter.String()).To(HaveSuffix(
+				"Change  Relative  Before  After  App\n" +
+					"+1,000  +500%     200     1,200  org-1.space-1.name-1\n" +
+					"+50     new       0       50     app-guid-0\n" +
+					"-500    -100%     500     0      org-2.space-2.name-2\n",
+			))
+
+			tableWriter.Reset()
+			app.LogNoise(
+				cli,
+				[]string{"diff"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(ContainSubstring("\x1b[91;1mNEW\x1b[0m"))
+		})
+
+		It("filters and limits the apps", func() {
+			app.LogNoise(
+				cli,
+				[]string{"diff", "--org", "org-2", "--output", "json"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(MatchJSON(`[{
+				"org": "org-2",
+				"space": "space-2",
+				"app": "name-2",
+				"app_guid": "app-guid-2",
+				"before": 500,
+				"after": 0,
+				"change": -500,
+				"relative_change": -1,
+				"new": false
+			}]`))
+		})
+
+		It("writes csv", func() {
+			app.LogNoise(
+				cli,
+				[]string{"diff", "--limit", "2", "--output", "csv"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(Equal(
+				"org,space,app,app_guid,before,after,change,relative_change,new\n" +
+					"org-1,space-1,name-1,app-guid-1,200,1200,1000,5,false\n" +
+					",,,app-guid-0,0,50,50,0,true\n",
+			))
+		})
+
+		It("fatally logs if the windows are invalid", func() {
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"diff", "--from", "now", "--to", "1h"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("Invalid window, --from must be before --to"))
+		})
+
+		It("fatally logs if the accumulator does not return a 200", func() {
+			httpClient.responseCode = http.StatusBadRequest
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"diff"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("Failed to get diff from accumulator, expected 200, got 400."))
+		})
+	})
+
+	Describe("accumulator discovery", func() {
+		route := func(host, domain, path string, port int) plugin_models.GetApp_RouteSummary {
+			return plugin_models.GetApp_RouteSummary{
+				Host:   host,
+				Domain: plugin_models.GetApp_DomainFields{Name: domain},
+				Path:   path,
+				Port:   port,
+			}
+		}
+
+		It("uses the given accumulator url without looking up an app", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--accumulator-url", "https://accumulator.example.com/nn/"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(cli.requestedAppNames).To(BeEmpty())
+			Expect(httpClient.requestURL).To(HavePrefix("https://accumulator.example.com/nn/rates/"))
+		})
+
+		It("fatally logs if the accumulator url is invalid", func() {
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--accumulator-url", "accumulator.example.com"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("Invalid accumulator URL accumulator.example.com, expected an http or https URL"))
+		})
+
+		It("prefers http routes without a path", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("", "tcp.example.com", "", 1024),
+				route("nn", "example.com", "/accumulator", 0),
+				route("nn-accumulator", "apps.internal", "", 0),
+				route("nn", "example.com", "", 0),
+			}
+
+			app.LogNoise(
+				cli,
+				[]string{},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(httpClient.requestURL).To(HavePrefix("https://nn.example.com/rates/"))
+		})
+
+		It("uses path routes", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("", "tcp.example.com", "", 1024),
+				route("nn", "example.com", "/accumulator", 0),
+			}
+
+			app.LogNoise(
+				cli,
+				[]string{},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(httpClient.requestURL).To(HavePrefix("https://nn.example.com/accumulator/rates/"))
+		})
+
+		It("uses tcp routes when insecure tcp routes are allowed", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("", "tcp.example.com", "", 1024),
+			}
+
+			app.LogNoise(
+				cli,
+				[]string{"--insecure-tcp-route"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(httpClient.requestURL).To(HavePrefix("http://tcp.example.com:1024/rates/"))
+		})
+
+		It("fatally logs if the accumulator only has tcp routes", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("", "tcp.example.com", "", 1024),
+			}
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(httpClient.requestURL).To(BeEmpty())
+			Expect(logger.fatalfMessage).To(Equal(
+				"nn-accumulator is only reachable on TCP routes (tcp.example.com:1024) which would receive the token in plain text, use --insecure-tcp-route to use them anyway",
+			))
+		})
+
+		It("uses the given route", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("nn", "example.com", "", 0),
+				route("nn", "example.com", "/accumulator", 0),
+				route("", "tcp.example.com", "", 1024),
+			}
+
+			app.LogNoise(
+				cli,
+				[]string{"--route", "nn.example.com/accumulator"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(httpClient.requestURL).To(HavePrefix("https://nn.example.com/accumulator/rates/"))
+		})
+
+		It("requires insecure tcp routes to be allowed for a given tcp route", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("nn", "example.com", "", 0),
+				route("", "tcp.example.com", "", 1024),
+			}
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--route", "tcp.example.com:1024"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+			Expect(logger.fatalfMessage).To(HavePrefix("nn-accumulator is only reachable on TCP routes"))
+
+			app.LogNoise(
+				cli,
+				[]string{"--route", "tcp.example.com:1024", "--insecure-tcp-route"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+			Expect(httpClient.requestURL).To(HavePrefix("http://tcp.example.com:1024/rates/"))
+		})
+
+		It("fatally logs if the given route does not exist", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("nn", "example.com", "", 0),
+				route("", "tcp.example.com", "", 1024),
+			}
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--route", "other.example.com"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal(
+				"Route other.example.com not found for nn-accumulator, expected one of nn.example.com, tcp.example.com:1024",
+			))
+		})
+
+		It("fatally logs if the accumulator only has internal routes", func() {
+			cli.routes = []plugin_models.GetApp_RouteSummary{
+				route("nn-accumulator", "apps.internal", "", 0),
+			}
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal(
+				"nn-accumulator is only reachable on internal routes (https://nn-accumulator.apps.internal), use --accumulator-url to set an externally reachable URL",
+			))
+		})
+
+		It("fatally logs if the accumulator has no routes", func() {
+			cli.routes = nil
+
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal(
+				"No routes found for nn-accumulator, use --accumulator-url to set the accumulator URL",
+			))
+		})
+
+		Describe("config", func() {
+			var configPath string
+
+			BeforeEach(func() {
+				dir, err := ioutil.TempDir("", "log-noise")
+				Expect(err).ToNot(HaveOccurred())
+				configPath = filepath.Join(dir, ".cf", "log-noise.json")
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(filepath.Dir(filepath.Dir(configPath)))
+			})
+
+			logNoise := func(args ...string) {
+				app.LogNoise(
+					cli,
+					args,
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+					app.WithConfigPath(configPath),
+				)
+			}
+
+			It("persists the accumulator url", func() {
+				logNoise("config", "--accumulator-url", "https://accumulator.example.com")
+				Expect(tableWriter.String()).To(Equal("Saved accumulator to " + configPath + "\n"))
+
+				tableWriter.Reset()
+				logNoise("config")
+				Expect(tableWriter.String()).To(Equal("Accumulator URL: https://accumulator.example.com\n"))
+
+				logNoise()
+				Expect(cli.requestedAppNames).To(BeEmpty())
+				Expect(httpClient.requestURL).To(HavePrefix("https://accumulator.example.com/rates/"))
+			})
+
+			It("persists the accumulator app name", func() {
+				logNoise("config", "my-accumulator")
+
+				tableWriter.Reset()
+				logNoise("config")
+				Expect(tableWriter.String()).To(Equal("Accumulator app: my-accumulator\n"))
+
+				logNoise()
+				Expect(cli.requestedAppNames).To(Equal([]string{"my-accumulator"}))
+			})
+
+			It("persists the accumulator route", func() {
+				cli.routes = []plugin_models.GetApp_RouteSummary{
+					route("nn", "example.com", "", 0),
+					route("", "tcp.example.com", "", 1024),
+				}
+
+				logNoise("config", "--route", "tcp.example.com:1024", "--insecure-tcp-route", "my-accumulator")
+
+				tableWriter.Reset()
+				logNoise("config")
+				Expect(tableWriter.String()).To(Equal(
+					"Accumulator app: my-accumulator\nAccumulator route: tcp.example.com:1024\n",
+				))
+
+				logNoise()
+				Expect(cli.requestedAppNames).To(Equal([]string{"my-accumulator"}))
+				Expect(httpClient.requestURL).To(HavePrefix("http://tcp.example.com:1024/rates/"))
+			})
+
+			It("prefers the accumulator given on the command line", func() {
+				logNoise("config", "--accumulator-url", "https://accumulator.example.com")
+
+				logNoise("other-accumulator")
+				Expect(cli.requestedAppNames).To(Equal([]string{"other-accumulator"}))
+				Expect(httpClient.requestURL).To(HavePrefix("https://nn-accumulator.localhost/rates/"))
+			})
+
+			It("reports when no accumulator is configured", func() {
+				logNoise("config")
+
+				Expect(tableWriter.String()).To(Equal("No accumulator configured, using the nn-accumulator app\n"))
+			})
+
+			It("fatally logs if the config can not be read", func() {
+				Expect(os.MkdirAll(filepath.Dir(configPath), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(configPath, []byte("{"), 0600)).To(Succeed())
+
+				Expect(func() { logNoise() }).To(Panic())
+				Expect(logger.fatalfMessage).To(HavePrefix("Failed to read plugin config: failed to decode"))
+			})
+		})
+	})
+
+	Describe("output formats", func() {
+		BeforeEach(func() {
+			httpClient = newStubHTTPClient(`{
+				"timestamp":1517855100,
+				"counts":{
+				   "app-guid-0/0":100,
+				   "app-guid-1/1":1234567890
+				}
+			}`)
+		})
+
+		It("writes a table without color when not writing to a terminal", func() {
+			app.LogNoise(
+				cli,
+				[]string{"accumulator"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+			)
+
+			Expect(tableWriter.String()).To(Equal("Volume Last Minute  App Instance\n" +
+				"1,234,567,890       org-1.space-1.name-1/1\n" +
+				"100                 app-guid-0/0\n",
+			))
+		})
+
+		It("writes a table without color when --no-color is given", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--no-color"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).ToNot(ContainSubstring("\x1b"))
+		})
+
+		It("writes json", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--output", "json"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(MatchJSON(`[
+				{
+					"org": "org-1",
+					"space": "space-1",
+					"app": "name-1",
+					"app_guid": "app-guid-1",
+					"instance_index": 1,
+					"count": 1234567890
+				},
+				{
+					"org": "",
+					"space": "",
+					"app": "",
+					"app_guid": "app-guid-0",
+					"instance_index": 0,
+					"count": 100
+				}
+			]`))
+		})
+
+		It("writes csv", func() {
+			app.LogNoise(
+				cli,
+				[]string{"accumulator", "--output=csv"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+			)
+
+			Expect(tableWriter.String()).To(Equal(
+				"org,space,app,app_guid,instance_index,count\n" +
+					"org-1,space-1,name-1,app-guid-1,1,1234567890\n" +
+					",,,app-guid-0,0,100\n",
+			))
+		})
+
+		It("fatally logs if the output format is unknown", func() {
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--output", "xml"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("Invalid output format xml, expected table, json or csv"))
+		})
+	})
+
+	Describe("watch mode", func() {
+		BeforeEach(func() {
+			httpClient = newStubHTTPClient(`[
+				{
+					"timestamp":1517855040,
+					"counts":{
+						"app-guid-1/0":100,
+						"app-guid-1/1":300,
+						"app-guid-2/0":1000
+					}
+				},
+				{
+					"timestamp":1517855100,
+					"counts":{
+						"app-guid-1/0":200,
+						"app-guid-1/1":1500,
+						"app-guid-2/0":500
+					}
+				}
+			]`)
+		})
+
+		It("requests the recent history of rates", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--watch", "--interval", "10s", "accumulator"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+				app.WithInput(strings.NewReader("q")),
+			)
+
+			Expect(cli.requestedAppName).To(Equal("accumulator"))
+			url := `https:\/\/nn-accumulator\.localhost\/rates\?start=(\d+)&end=(\d+)`
+			Expect(httpClient.requestURL).To(MatchRegexp(url))
+			Expect(httpClient.requestHeaders.Get("Authorization")).To(
+				Equal("my-token"),
+			)
+
+			parts := regexp.MustCompile(url).FindStringSubmatch(httpClient.requestURL)
+			start, err := strconv.ParseInt(parts[1], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			end, err := strconv.ParseInt(parts[2], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(end).To(BeNumerically("~", time.Now().Unix(), 1))
+			Expect(end - start).To(Equal(int64(660)))
+		})
+
+		It("sizes the history with the spacing of the rates", func() {
+			httpClient = newStubHTTPClient(`[
+				{"timestamp":1517855100,"counts":{"app-guid-1/0":100}},
+				{"timestamp":1517855400,"counts":{"app-guid-1/0":200}}
+			]`)
+
+			app.LogNoise(
+				cli,
+				[]string{"--watch", "--interval", "10s", "accumulator"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+				app.WithInput(strings.NewReader("q")),
+			)
+
+			url := `start=(\d+)&end=(\d+)`
+			parts := regexp.MustCompile(url).FindStringSubmatch(httpClient.requestURL)
+			Expect(parts).To(HaveLen(3))
+			start, err := strconv.ParseInt(parts[1], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			end, err := strconv.ParseInt(parts[2], 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(end - start).To(Equal(int64(3300)))
+		})
+
+		It("renders instances with their change and history", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--watch"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+				app.WithInput(strings.NewReader("q")),
+			)
+
+			Expect(tableWriter.String()).To(ContainSubstring("(sort: volume, group: instance)"))
+			Expect(tableWriter.String()).To(ContainSubstring(
+				"  Volume  Change  History  Name\n" +
+					"  1,500   +1,200  ▂█       org-1.space-1.name-1/1\n" +
+					"  500     -500    █▄       org-2.space-2.name-2/0\n" +
+					"  200     +100    ▄█       org-1.space-1.name-1/0\n",
+			))
+		})
+
+		It("groups rates by app", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--watch"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithTTY(false),
+				app.WithInput(strings.NewReader("gq")),
+			)
+
+			Expect(tableWriter.String()).To(ContainSubstring("(sort: volume, group: app)"))
+			Expect(tableWriter.String()).To(ContainSubstring(
+				"  Volume  Change  History  Name\n" +
+					"  1,700   +1,300  ▂█       org-1.space-1.name-1\n" +
+					"  500     -500    █▄       org-2.space-2.name-2\n",
+			))
+		})
+
+		It("draws in full screen on a terminal", func() {
+			app.LogNoise(
+				cli,
+				[]string{"--watch"},
+				httpClient,
+				appInfoStore,
+				tableWriter,
+				logger,
+				app.WithInput(strings.NewReader("q")),
+			)
+
+			Expect(tableWriter.String()).To(HavePrefix("\x1b[?1049h"))
+			Expect(tableWriter.String()).To(ContainSubstring("\x1b[H\x1b[2J"))
+			Expect(tableWriter.String()).To(ContainSubstring("> 1,500"))
+			Expect(tableWriter.String()).To(HaveSuffix("\x1b[?1049l"))
+		})
+
+		It("fatally logs if the interval is invalid", func() {
+			Expect(func() {
+				app.LogNoise(
+					cli,
+					[]string{"--watch", "--interval", "0s"},
+					httpClient,
+					appInfoStore,
+					tableWriter,
+					logger,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("Invalid interval 0s, must be greater than 0"))
+		})
+	})
 })
 
 type stubLogger struct {
@@ -280,27 +1340,33 @@ type stubCliConnection struct {
 	accessToken      string
 	accessTokenError error
 
-	requestedAppName string
-	getAppError      error
+	requestedAppName  string
+	requestedAppNames []string
+	getAppError       error
+	routes            []plugin_models.GetApp_RouteSummary
 }
 
 func newStubCliConnection() *stubCliConnection {
 	return &stubCliConnection{
 		accessToken: "my-token",
+		routes: []plugin_models.GetApp_RouteSummary{{
+			Host: "nn-accumulator",
+			Domain: plugin_models.GetApp_DomainFields{
+				Name: "localhost",
+			},
+			Path: "/",
+		}},
 	}
 }
 
 func (c *stubCliConnection) GetApp(name string) (plugin_models.GetAppModel, error) {
 	c.requestedAppName = name
+	c.requestedAppNames = append(c.requestedAppNames, name)
 
 	return plugin_models.GetAppModel{
-		Routes: []plugin_models.GetApp_RouteSummary{{
-			Host: "nn-accumulator",
-			Domain: plugin_models.GetApp_DomainFields{
-				Name: "localhost",
-			},
-			Path: "/",
-		}},
+		Guid:   name + "-guid",
+		Name:   name,
+		Routes: c.routes,
 	}, c.getAppError
 }
 
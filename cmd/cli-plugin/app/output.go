@@ -0,0 +1,105 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// outputRow is a single log producer in the machine readable output formats.
+// The org, space and app are empty if the app info could not be looked up.
+type outputRow struct {
+	Org           string `json:"org"`
+	Space         string `json:"space"`
+	App           string `json:"app"`
+	AppGUID       string `json:"app_guid"`
+	InstanceIndex int    `json:"instance_index"`
+	Count         uint64 `json:"count"`
+}
+
+func newOutputRows(
+	producers counts,
+	appInfos map[collector.AppGUID]collector.AppInfo,
+) []outputRow {
+	rows := make([]outputRow, 0, len(producers))
+	for _, p := range producers {
+		index, _ := strconv.Atoi(p.appID.Index())
+		appInfo := appInfos[collector.AppGUID(p.appID.GUID())]
+
+		rows = append(rows, outputRow{
+			Org:           appInfo.Org,
+			Space:         appInfo.Space,
+			App:           appInfo.Name,
+			AppGUID:       p.appID.GUID(),
+			InstanceIndex: index,
+			Count:         p.count,
+		})
+	}
+
+	return rows
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func writeCSV(w io.Writer, rows []outputRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"org", "space", "app", "app_guid", "instance_index", "count"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.Org,
+			r.Space,
+			r.App,
+			r.AppGUID,
+			strconv.Itoa(r.InstanceIndex),
+			strconv.FormatUint(r.Count, 10),
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func writeTable(
+	w io.Writer,
+	title string,
+	producers counts,
+	appInfos map[collector.AppGUID]collector.AppInfo,
+	color bool,
+) error {
+	tw := tabwriter.NewWriter(w, 4, 2, 2, ' ', 0)
+	if color {
+		// Volume Last Minute column must contain color codes because the
+		// tabwriter does not ignore the escape sequences when calculating
+		// column width.
+		fmt.Fprintf(tw, "\x1b[91;0m%s\x1b[0m\tApp Instance\n", title)
+	} else {
+		fmt.Fprintf(tw, "%s\tApp Instance\n", title)
+	}
+
+	for _, item := range producers {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\n",
+			formattedNumber(item.count, color),
+			formattedAppInfo(item.appID, appInfos),
+		)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,613 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+)
+
+const (
+	// historyLength is the number of rates shown in the history column.
+	historyLength = 10
+
+	// defaultBucketInterval is the interval of the rates until the spacing
+	// of the rates returned by the accumulator is known. It is the default
+	// polling interval of the nozzle.
+	defaultBucketInterval = time.Minute
+
+	// watchRows is the default number of rows shown in watch mode.
+	watchRows = 20
+
+	// lookupBatchSize is the number of app GUIDs looked up in a single
+	// request to the app info store.
+	lookupBatchSize = 100
+)
+
+const (
+	enterFullScreen = "\x1b[?1049h\x1b[?25l"
+	exitFullScreen  = "\x1b[?25h\x1b[?1049l"
+	clearScreen     = "\x1b[H\x1b[2J"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+type sortMode int
+
+const (
+	sortByCount sortMode = iota
+	sortByChange
+	sortByName
+	sortModes
+)
+
+func (s sortMode) String() string {
+	switch s {
+	case sortByChange:
+		return "change"
+	case sortByName:
+		return "name"
+	default:
+		return "volume"
+	}
+}
+
+type groupMode int
+
+const (
+	groupByInstance groupMode = iota
+	groupByApp
+	groupBySpace
+	groupByOrg
+	groupModes
+)
+
+func (g groupMode) String() string {
+	switch g {
+	case groupByApp:
+		return "app"
+	case groupBySpace:
+		return "space"
+	case groupByOrg:
+		return "org"
+	default:
+		return "instance"
+	}
+}
+
+type key int
+
+const (
+	keyQuit key = iota
+	keySort
+	keyGroup
+	keyUp
+	keyDown
+	keyDrill
+	keyBack
+)
+
+// watcher periodically fetches rates from the accumulator and redraws a
+// table of the top log producers.
+type watcher struct {
+	addr         string
+	conn         plugin.CliConnection
+	httpClient   HTTPClient
+	appInfoStore AppInfoStore
+	out          io.Writer
+	log          Logger
+	interval     time.Duration
+	limit        int
+	filter       filter
+	minRate      uint64
+	tty          bool
+	input        io.Reader
+	rawMode      func() (func(), error)
+
+	sort      sortMode
+	group     groupMode
+	selected  int
+	drillGUID string
+
+	bucketInterval time.Duration
+	rates          []store.Rate
+	appInfos       map[collector.AppGUID]collector.AppInfo
+	rows           []watchRow
+	err            error
+}
+
+type watchRow struct {
+	guid    string
+	label   string
+	count   uint64
+	change  int64
+	history []uint64
+}
+
+func (w *watcher) run() {
+	if w.tty {
+		if w.rawMode != nil && w.input != nil {
+			restore, err := w.rawMode()
+			if err != nil {
+				w.log.Printf("Failed to read keyboard input: %s", err)
+				w.input = nil
+			} else {
+				defer restore()
+			}
+		}
+
+		fmt.Fprint(w.out, enterFullScreen)
+		defer fmt.Fprint(w.out, exitFullScreen)
+	}
+
+	keys := make(chan key)
+	w.refresh()
+	w.render()
+
+	if w.input != nil {
+		go readKeys(w.input, keys)
+	} else {
+		keys = nil
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.refresh()
+		case k, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+
+			if k == keyQuit {
+				return
+			}
+
+			w.handle(k)
+		}
+
+		w.render()
+	}
+}
+
+func (w *watcher) handle(k key) {
+	switch k {
+	case keySort:
+		w.sort = (w.sort + 1) % sortModes
+	case keyGroup:
+		if w.drillGUID == "" {
+			w.group = (w.group + 1) % groupModes
+			w.selected = 0
+		}
+	case keyUp:
+		if w.selected > 0 {
+			w.selected--
+		}
+	case keyDown:
+		if w.selected < len(w.rows)-1 {
+			w.selected++
+		}
+	case keyDrill:
+		if w.drillGUID != "" || w.selected >= len(w.rows) {
+			return
+		}
+
+		if w.group != groupByInstance && w.group != groupByApp {
+			return
+		}
+
+		w.drillGUID = w.rows[w.selected].guid
+		w.selected = 0
+	case keyBack:
+		w.drillGUID = ""
+		w.selected = 0
+	}
+
+	w.buildRows()
+}
+
+// refresh fetches the recent history of rates from the accumulator and looks
+// up the app info for every app in the history.
+func (w *watcher) refresh() {
+	authToken, err := w.conn.AccessToken()
+	if err != nil {
+		w.err = err
+		return
+	}
+
+	if w.bucketInterval <= 0 {
+		w.bucketInterval = defaultBucketInterval
+	}
+
+	rates, err := w.fetchHistory(authToken)
+	if err != nil {
+		w.err = err
+		return
+	}
+
+	// The history window is sized with the interval of the rates. If the
+	// rates turn out to be further apart than assumed, fetch them again so
+	// the history is complete.
+	if d := bucketSpacing(rates); d > 0 && d != w.bucketInterval {
+		grown := d > w.bucketInterval
+		w.bucketInterval = d
+
+		if grown {
+			rates, err = w.fetchHistory(authToken)
+			if err != nil {
+				w.err = err
+				return
+			}
+		}
+	}
+
+	if len(rates) > historyLength {
+		rates = rates[len(rates)-historyLength:]
+	}
+
+	var guids []string
+	seen := make(map[string]bool)
+	for _, r := range rates {
+		for k := range r.Counts {
+			g := collector.GUIDIndex(k).GUID()
+			if !seen[g] {
+				seen[g] = true
+				guids = append(guids, g)
+			}
+		}
+	}
+
+	w.rates = rates
+	w.appInfos = lookupAll(guids, w.appInfoStore, w.log)
+	w.err = nil
+	w.buildRows()
+}
+
+// fetchHistory fetches the rates of the last historyLength rate intervals.
+func (w *watcher) fetchHistory(authToken string) ([]store.Rate, error) {
+	end := time.Now()
+	start := end.Add(-time.Duration(historyLength+1) * w.bucketInterval)
+
+	return fetchRange(w.addr, authToken, start.Unix(), end.Unix(), w.httpClient)
+}
+
+// bucketSpacing returns the smallest spacing between the timestamps of the
+// given rates, which is the interval of the rates. It returns 0 if there are
+// fewer than two rates.
+func bucketSpacing(rates []store.Rate) time.Duration {
+	var spacing int64
+	for i := 1; i < len(rates); i++ {
+		d := rates[i].Timestamp - rates[i-1].Timestamp
+		if d > 0 && (spacing == 0 || d < spacing) {
+			spacing = d
+		}
+	}
+
+	return time.Duration(spacing) * time.Second
+}
+
+// buildRows groups, sorts and limits the current rates into rows for
+// rendering.
+func (w *watcher) buildRows() {
+	group := w.group
+	if w.drillGUID != "" {
+		group = groupByInstance
+	}
+
+	byKey := make(map[string]*watchRow)
+	for i, r := range w.rates {
+		for k, v := range r.Counts {
+			gi := collector.GUIDIndex(k)
+			if w.drillGUID != "" && gi.GUID() != w.drillGUID {
+				continue
+			}
+
+			info, ok := w.appInfos[collector.AppGUID(gi.GUID())]
+			if !w.filter.matches(info, ok) {
+				continue
+			}
+
+			key, label := groupKey(gi, group, w.appInfos)
+			row, ok := byKey[key]
+			if !ok {
+				row = &watchRow{
+					guid:    gi.GUID(),
+					label:   label,
+					history: make([]uint64, len(w.rates)),
+				}
+				byKey[key] = row
+			}
+			row.history[i] += v
+		}
+	}
+
+	rows := make([]watchRow, 0, len(byKey))
+	for _, row := range byKey {
+		n := len(row.history)
+		row.count = row.history[n-1]
+		if n > 1 {
+			row.change = int64(row.history[n-1]) - int64(row.history[n-2])
+		}
+
+		if row.count == 0 || row.count < w.minRate {
+			continue
+		}
+
+		rows = append(rows, *row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		switch w.sort {
+		case sortByChange:
+			if rows[i].change != rows[j].change {
+				return rows[i].change > rows[j].change
+			}
+		case sortByName:
+			if rows[i].label != rows[j].label {
+				return rows[i].label < rows[j].label
+			}
+		}
+
+		if rows[i].count != rows[j].count {
+			return rows[i].count > rows[j].count
+		}
+		return rows[i].label < rows[j].label
+	})
+
+	if len(rows) > w.limit {
+		rows = rows[:w.limit]
+	}
+
+	w.rows = rows
+	if w.selected >= len(rows) {
+		w.selected = 0
+	}
+}
+
+func (w *watcher) render() {
+	buf := bytes.NewBuffer(nil)
+
+	title := "Top log producers"
+	if w.drillGUID != "" {
+		title = fmt.Sprintf("Instances of %s", w.drillLabel())
+	}
+
+	var bucket string
+	if len(w.rates) > 0 {
+		bucket = time.Unix(w.rates[len(w.rates)-1].Timestamp, 0).Format("15:04:05")
+	}
+
+	fmt.Fprintf(buf, "%s at %s  (sort: %s, group: %s)\n", title, bucket, w.sort, w.group)
+	if w.err != nil {
+		fmt.Fprintf(buf, "Failed to refresh: %s\n", w.err)
+	}
+	fmt.Fprintln(buf)
+
+	tw := tabwriter.NewWriter(buf, 4, 2, 2, ' ', 0)
+	fmt.Fprint(tw, "  Volume\tChange\tHistory\tName\n")
+	for i, row := range w.rows {
+		marker := " "
+		if w.tty && w.input != nil && i == w.selected {
+			marker = ">"
+		}
+
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\n",
+			marker,
+			plainNumber(row.count),
+			formattedChange(row.change),
+			sparkline(row.history),
+			row.label,
+		)
+	}
+	tw.Flush()
+
+	if w.tty && w.input != nil {
+		fmt.Fprintln(buf)
+		fmt.Fprint(buf, "q: quit  s: sort  g: group  j/k: select  enter: drill in  b: back\n")
+	}
+
+	if !w.tty {
+		fmt.Fprintln(buf)
+		w.out.Write(buf.Bytes())
+		return
+	}
+
+	// The terminal is in raw mode so each line must return the cursor to the
+	// beginning of the line.
+	frame := strings.Replace(buf.String(), "\n", "\r\n", -1)
+	fmt.Fprint(w.out, clearScreen+frame)
+}
+
+func (w *watcher) drillLabel() string {
+	info, ok := w.appInfos[collector.AppGUID(w.drillGUID)]
+	if !ok {
+		return w.drillGUID
+	}
+
+	return info.String()
+}
+
+// groupKey returns the key used to group the given GUIDIndex and the label
+// to display for that group.
+func groupKey(
+	gi collector.GUIDIndex,
+	group groupMode,
+	appInfos map[collector.AppGUID]collector.AppInfo,
+) (string, string) {
+	info, ok := appInfos[collector.AppGUID(gi.GUID())]
+
+	switch group {
+	case groupByApp:
+		if !ok {
+			return gi.GUID(), gi.GUID()
+		}
+		return gi.GUID(), info.String()
+	case groupBySpace:
+		if !ok {
+			return "", "unknown"
+		}
+		label := fmt.Sprintf("%s.%s", info.Org, info.Space)
+		return label, label
+	case groupByOrg:
+		if !ok {
+			return "", "unknown"
+		}
+		return info.Org, info.Org
+	default:
+		return string(gi), formattedAppInfo(gi, appInfos)
+	}
+}
+
+// readKeys reads key presses from the given reader until it is closed.
+func readKeys(r io.Reader, keys chan<- key) {
+	defer close(keys)
+
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch b {
+		case 'q', 0x03:
+			keys <- keyQuit
+			return
+		case 's':
+			keys <- keySort
+		case 'g':
+			keys <- keyGroup
+		case 'k':
+			keys <- keyUp
+		case 'j':
+			keys <- keyDown
+		case 'd', '\r', '\n':
+			keys <- keyDrill
+		case 'b', 0x7f:
+			keys <- keyBack
+		case 0x1b:
+			// Arrow keys are sent as the escape sequences ESC [ A and
+			// ESC [ B.
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(br, seq); err != nil {
+				return
+			}
+
+			switch string(seq) {
+			case "[A":
+				keys <- keyUp
+			case "[B":
+				keys <- keyDown
+			}
+		}
+	}
+}
+
+func fetchRange(
+	addr string,
+	authToken string,
+	start int64,
+	end int64,
+	httpClient HTTPClient,
+) ([]store.Rate, error) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("%s/rates?start=%d&end=%d", addr, start, end),
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build request to accumulator: %s", err)
+	}
+	req.Header.Set("Authorization", authToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"Failed to get rates from accumulator, expected 200, got %d.",
+			resp.StatusCode,
+		)
+	}
+
+	var rates []store.Rate
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("Failed to decode accumulator response: %s", err)
+	}
+
+	return rates, nil
+}
+
+// lookupAll looks up the app info for all of the given GUIDs in batches.
+func lookupAll(
+	guids []string,
+	appInfoStore AppInfoStore,
+	log Logger,
+) map[collector.AppGUID]collector.AppInfo {
+	appInfos := make(map[collector.AppGUID]collector.AppInfo)
+	for len(guids) > 0 {
+		n := lookupBatchSize
+		if len(guids) < n {
+			n = len(guids)
+		}
+
+		infos, err := appInfoStore.Lookup(guids[:n])
+		if err != nil {
+			log.Printf("%s", err)
+		}
+
+		for k, v := range infos {
+			appInfos[k] = v
+		}
+
+		guids = guids[n:]
+	}
+
+	return appInfos
+}
+
+func sparkline(history []uint64) string {
+	var max uint64
+	for _, v := range history {
+		if v > max {
+			max = v
+		}
+	}
+
+	line := make([]rune, 0, len(history))
+	for _, v := range history {
+		if max == 0 {
+			line = append(line, sparks[0])
+			continue
+		}
+
+		line = append(line, sparks[int(v*uint64(len(sparks)-1)/max)])
+	}
+
+	return string(line)
+}
+
+func formattedChange(i int64) string {
+	if i < 0 {
+		return "-" + plainNumber(uint64(-i))
+	}
+
+	return "+" + plainNumber(uint64(i))
+}
@@ -6,11 +6,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"code.cloudfoundry.org/cli/plugin"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/cmd/cli-plugin/app"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // LogNoiseCLI represent the CF CLI log-noise plugin
@@ -48,7 +50,11 @@ func (c *LogNoiseCLI) Run(conn plugin.CliConnection, args []string) {
 			http.DefaultClient,
 			httpAppInfoStore,
 			os.Stdout,
-			log.New(os.Stdout, "", 0),
+			log.New(os.Stderr, "", 0),
+			app.WithTTY(terminal.IsTerminal(int(os.Stdout.Fd()))),
+			app.WithInput(os.Stdin),
+			app.WithRawMode(rawMode),
+			app.WithConfigPath(configPath()),
 		)
 		return
 	}
@@ -73,14 +79,62 @@ func (c *LogNoiseCLI) GetMetadata() plugin.PluginMetadata {
 			{
 				Name: "log-noise",
 				UsageDetails: plugin.Usage{
-					Usage: "log-noise <nozzle accumulator app name>",
+					Usage: "log-noise [app <app name> | config | diff [--from TIME] [--to TIME] [--window DURATION] [--order absolute|relative]] [--limit N] [--since DURATION] [--at TIME] [--org ORG] [--space SPACE] [--app APP] [--min-rate N] [--output table|json|csv] [--no-color] [--watch] [--interval DURATION] [--accumulator-url URL | --route ROUTE [--insecure-tcp-route]] <nozzle accumulator app name>",
+					Options: map[string]string{
+						"-limit":              "Number of log producers to show (default 10, 20 in watch mode)",
+						"-since":              "Sum the rates over the given duration, e.g. 15m",
+						"-at":                 "Show rates at the given RFC3339 time or Unix timestamp",
+						"-org":                "Only show apps in the given org",
+						"-space":              "Only show apps in the given space",
+						"-app":                "Only show the app with the given name",
+						"-min-rate":           "Only show instances with at least N logs per minute",
+						"-from":               "Diff: end of the earlier window, e.g. 30m, now or an RFC3339 time (default 30m)",
+						"-to":                 "Diff: end of the later window (default now)",
+						"-window":             "Diff: length of each window (default 5m)",
+						"-order":              "Diff: rank by absolute or relative change (default absolute)",
+						"-accumulator-url":    "URL of the accumulator, overrides the accumulator app name",
+						"-route":              "Route of the accumulator app to use, e.g. nn.example.com or tcp.example.com:1024",
+						"-insecure-tcp-route": "Allow TCP routes, which receive the token in plain text",
+						"-output":             "Output format, one of table, json or csv (default table)",
+						"-no-color":           "Disable colored table output",
+						"-watch":              "Continuously refresh the top log producers",
+						"-interval":           "Refresh interval in watch mode (default 1m)",
+					},
 				},
-				HelpText: "Show top log producers from noisy-neighbor-nozzle accumulator.",
+				HelpText: "Show top log producers from noisy-neighbor-nozzle accumulator. Use \"log-noise app <app name>\" to show the history of a single app and \"log-noise diff\" to show what changed between two windows.",
 			},
 		},
 	}
 }
 
+// configPath returns the path of the plugin config. Like the CF CLI, the
+// config is stored in the .cf directory of CF_HOME or the user's home
+// directory.
+func configPath() string {
+	home := os.Getenv("CF_HOME")
+	if home == "" {
+		var err error
+		home, err = os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+	}
+
+	return filepath.Join(home, ".cf", "log-noise.json")
+}
+
+// rawMode puts stdin into raw mode so that key presses can be read in watch
+// mode. The returned func restores the previous terminal state.
+func rawMode() (func(), error) {
+	fd := int(os.Stdin.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { terminal.Restore(fd, state) }, nil
+}
+
 func main() {
 	plugin.Start(&LogNoiseCLI{})
 }
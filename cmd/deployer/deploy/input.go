@@ -27,6 +27,9 @@ type Input struct {
 	DataDogForwarderName string
 	DataDogForwarder     bool
 	DataDogAPIKey        string
+	DataDogSite          string
+	DataDogEndpoint      string
+	DataDogAPIVersion    string
 }
 
 func Values() Input {
@@ -75,6 +78,21 @@ func Values() Input {
 		"",
 		"DataDog API key",
 	)
+	dataDogSite := flag.String(
+		"datadog-site",
+		"datadoghq.com",
+		"DataDog site to send metrics to, e.g. datadoghq.eu",
+	)
+	dataDogEndpoint := flag.String(
+		"datadog-endpoint",
+		"",
+		"Base URL of the DataDog API, e.g. of a proxy. Takes precedence over the DataDog site.",
+	)
+	dataDogAPIVersion := flag.String(
+		"datadog-api-version",
+		"v1",
+		"Version of the DataDog series API, v1 or v2",
+	)
 	capiAddr := flag.String(
 		"capi-addr",
 		"",
@@ -107,6 +125,9 @@ func Values() Input {
 		ClientSecret:          *secret,
 		SkipCertVerify:        *skipCertVerify,
 		DataDogAPIKey:         *dataDogAPIKey,
+		DataDogSite:           *dataDogSite,
+		DataDogEndpoint:       *dataDogEndpoint,
+		DataDogAPIVersion:     *dataDogAPIVersion,
 		CAPIAddr:              *capiAddr,
 		DatadogRequestTimeout: *dataDogRequestTimeout,
 		CAPIRequestTimeout:    *capiRequestTimeout,
@@ -145,6 +166,9 @@ func Validate(f Input) error {
 	if f.ClientSecret == "" {
 		return errors.New("Client Secret is required, but not set")
 	}
+	if f.DataDogAPIVersion != "" && f.DataDogAPIVersion != "v1" && f.DataDogAPIVersion != "v2" {
+		return errors.New("DataDog API version must be v1 or v2")
+	}
 
 	return nil
 
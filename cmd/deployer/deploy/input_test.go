@@ -131,5 +131,19 @@ var _ = Describe("Deployflags", func() {
 				ClientID:           "my-client",
 			},
 		),
+		Entry("DataDogAPIVersion flag is invalid",
+			deploy.Input{
+				SystemDomain:       "system-domain.com",
+				AppDomain:          "app-domain.com",
+				NozzleAppName:      "nozzle-app",
+				AccumulatorAppName: "accumulator-app",
+				NozzleInstances:    3,
+				UAAAddr:            "https://uaa.my-env.com",
+				LoggregatorAddr:    "wss://doppler.my-env.com:443",
+				ClientID:           "my-client",
+				ClientSecret:       "a-password",
+				DataDogAPIVersion:  "v3",
+			},
+		),
 	)
 })
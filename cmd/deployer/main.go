@@ -56,14 +56,20 @@ func main() {
 	execute("start accumulator", "cf", "start", in.AccumulatorAppName)
 
 	if in.DataDogForwarder {
-		execute("push DataDogForwarder", "cf", "push", in.DataDogForwarderName, "--no-manifest", "--no-start", "--no-route", "-b", "binary_buildpack", "-c", "./datadog-reporter", "-u", "none")
+		execute("push DataDogForwarder", "cf", "push", in.DataDogForwarderName, "--no-manifest", "--no-start", "--no-route", "-b", "binary_buildpack", "-c", "./reporter", "-u", "http", "--endpoint", "/health")
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "UAA_ADDR", in.UAAAddr)
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "REPORTER_HOST", in.SystemDomain)
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "CAPI_ADDR", in.CAPIAddr)
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "ACCUMULATOR_ADDR", fmt.Sprintf("https://%s.%s", in.AccumulatorAppName, in.AppDomain))
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "CLIENT_ID", in.ClientID)
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "CLIENT_SECRET", in.ClientSecret)
+		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "EXPORTERS", "datadog")
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "DATADOG_API_KEY", in.DataDogAPIKey)
+		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "DATADOG_SITE", in.DataDogSite)
+		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "DATADOG_API_VERSION", in.DataDogAPIVersion)
+		if in.DataDogEndpoint != "" {
+			execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "DATADOG_ENDPOINT", in.DataDogEndpoint)
+		}
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "DATADOG_REQUEST_TIMEOUT", in.DatadogRequestTimeout)
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "CAPI_REQUEST_TIMEOUT", in.CAPIRequestTimeout)
 		execute("set accumulator app name", "cf", "set-env", in.DataDogForwarderName, "SKIP_CERT_VERIFY", strconv.FormatBool(in.SkipCertVerify))
@@ -194,6 +200,30 @@ func inputFromUser() deploy.Input {
 				},
 				Validate: survey.Required,
 			},
+			{
+				Name: "DataDogSite",
+				Prompt: &survey.Input{
+					Message: "What is the DataDog site?",
+					Default: "datadoghq.com",
+					Help:    "The DataDog site to send metrics to, e.g. datadoghq.eu.",
+				},
+				Validate: survey.Required,
+			},
+			{
+				Name: "DataDogEndpoint",
+				Prompt: &survey.Input{
+					Message: "DataDog API endpoint?",
+					Help:    "The base URL of the DataDog API, e.g. of a proxy. Leave empty to use the DataDog site.",
+				},
+			},
+			{
+				Name: "DataDogAPIVersion",
+				Prompt: &survey.Select{
+					Message: "Which version of the DataDog series API?",
+					Options: []string{"v1", "v2"},
+					Default: "v1",
+				},
+			},
 			{
 				Name: "CAPIRequestTimeout",
 				Prompt: &survey.Input{
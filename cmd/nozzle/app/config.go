@@ -2,13 +2,17 @@ package app
 
 import (
 	"crypto/tls"
-	"io"
-	"io/ioutil"
-	"log"
 	"os"
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+)
+
+// Supported values for the COUNTER_TYPE configuration.
+const (
+	CounterTypeExact        = "exact"
+	CounterTypeHeavyHitters = "heavy-hitters"
 )
 
 // Config stores configuration data for the noisy neighbor client.
@@ -25,31 +29,61 @@ type Config struct {
 	MaxRateBuckets    int           `env:"MAX_RATE_BUCKETS"`
 	IncludeRouterLogs bool          `env:"INCLUDE_ROUTER_LOGS"`
 
-	// VCapApplication is used to detect whether or not the application is
-	// deployed as a CF application.
-	VCapApplication string `env:"VCAP_APPLICATION"`
-	TLSConfig       *tls.Config
+	// ProcessorWorkers is the number of goroutines used to count envelopes.
+	// Each worker has its own buffer of BufferSize envelopes.
+	ProcessorWorkers int `env:"PROCESSOR_WORKERS"`
+
+	// CounterType selects how logs are counted during a polling interval.
+	// "exact" keeps a count for every application instance. "heavy-hitters"
+	// only keeps approximate counts for the HeavyHittersCapacity noisiest
+	// application instances, bounding memory usage. The capacity is divided
+	// across the ProcessorWorkers.
+	CounterType          string `env:"COUNTER_TYPE"`
+	HeavyHittersCapacity int    `env:"HEAVY_HITTERS_CAPACITY"`
+
+	// ShutdownDrainTimeout is how long the nozzle keeps serving on shutdown
+	// until an accumulator pulled the final partial rate.
+	ShutdownDrainTimeout time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT"`
 
-	LogWriter io.Writer
+	// LogLevel is the minimum level of the lines that are logged: debug,
+	// info, warn or error.
+	LogLevel string `env:"LOG_LEVEL"`
+
+	TLSConfig *tls.Config
+	Logger    *logging.Logger
 }
 
 // LoadConfig loads the Config from the environment
 func LoadConfig() Config {
 	cfg := Config{
-		SkipCertVerify:    false,
-		BufferSize:        10000,
-		PollingInterval:   time.Minute,
-		MaxRateBuckets:    60,
-		IncludeRouterLogs: false,
-		LogWriter:         os.Stdout,
+		SkipCertVerify:       false,
+		BufferSize:           10000,
+		PollingInterval:      time.Minute,
+		MaxRateBuckets:       60,
+		IncludeRouterLogs:    false,
+		ProcessorWorkers:     1,
+		CounterType:          CounterTypeExact,
+		HeavyHittersCapacity: 10000,
+		ShutdownDrainTimeout: 5 * time.Second,
+		LogLevel:             "info",
 	}
 
 	if err := envstruct.Load(&cfg); err != nil {
-		log.Fatalf("failed to load config from environment: %s", err)
+		logging.Default().Fatal("failed to load config from environment", "error", err)
+	}
+
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logging.Default().Fatal("failed to load config", "error", err)
 	}
+	cfg.Logger = logging.New(os.Stdout, level)
 
-	if cfg.VCapApplication != "" {
-		cfg.LogWriter = ioutil.Discard
+	switch cfg.CounterType {
+	case CounterTypeExact, CounterTypeHeavyHitters:
+	default:
+		cfg.Logger.Fatal("failed to load config: COUNTER_TYPE must be exact or heavy-hitters",
+			"counter_type", cfg.CounterType,
+		)
 	}
 
 	cfg.TLSConfig = &tls.Config{InsecureSkipVerify: cfg.SkipCertVerify}
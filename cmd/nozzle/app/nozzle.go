@@ -1,11 +1,14 @@
 package app
 
 import (
-	"log"
+	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/auth"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/ingress"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
 	"github.com/cloudfoundry/noaa/consumer"
@@ -17,23 +20,34 @@ type Nozzle struct {
 	cfg        Config
 	server     *web.Server
 	ingestor   *ingress.Ingestor
-	processor  *ingress.Processor
+	consumer   *consumer.Consumer
+	buffers    []*ingress.Buffer
+	processors []*ingress.Processor
 	aggregator *store.Aggregator
+	rates      *pullTracker
+	stream     *store.Broadcaster
+	logger     *logging.Logger
 }
 
 // New returns an initialized NoisyNeighbor. This will authenticate with UAA,
 // open a connection to the firehose, and initialize all subprocesses.
 func New(cfg Config) *Nozzle {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
 	authenticator := auth.NewAuthenticator(cfg.ClientID, cfg.ClientSecret, cfg.UAAAddr,
 		auth.WithHTTPClient(&http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: cfg.TLSConfig,
 			},
 		}),
+		auth.WithLogger(logger),
 	)
 	token, err := authenticator.RefreshAuthToken()
 	if err != nil {
-		log.Fatalf("failed to authenticate: %s", err)
+		logger.Fatal("failed to authenticate", "error", err)
 	}
 
 	cnsmr := consumer.New(cfg.LoggregatorAddr, cfg.TLSConfig, nil)
@@ -45,49 +59,214 @@ func New(cfg Config) *Nozzle {
 	)
 	go func() {
 		for err := range errs {
-			log.Printf("error received from firehose: %s", err)
+			logger.Error("error received from firehose", "error", err)
 		}
 	}()
 
-	b := ingress.NewBuffer(cfg.BufferSize)
-	c := store.NewCounter()
+	workers := cfg.ProcessorWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	c := store.NewShardedCounter(workers, func() store.Shard {
+		return newCounter(cfg, workers)
+	})
+
+	sets := make([]ingress.Set, 0, workers)
+	buffers := make([]*ingress.Buffer, 0, workers)
+	processors := make([]*ingress.Processor, 0, workers)
+	for i := 0; i < workers; i++ {
+		b := ingress.NewBuffer(cfg.BufferSize, ingress.WithLogger(logger))
+		sets = append(sets, b.Set)
+		buffers = append(buffers, b)
+		processors = append(processors,
+			ingress.NewProcessor(b.Next, c.Shard(i).Inc, cfg.IncludeRouterLogs),
+		)
+	}
+
+	b := store.NewBroadcaster()
 	a := store.NewAggregator(c,
 		store.WithPollingInterval(cfg.PollingInterval),
 		store.WithMaxRateBuckets(cfg.MaxRateBuckets),
+		store.WithBroadcaster(b),
 	)
+	rates := &pullTracker{
+		RateStore: a,
+		pulled:    make(chan struct{}, 1),
+	}
 	s := web.NewServer(
 		cfg.Port,
 		authenticator.CheckToken,
-		a,
+		rates,
 		cfg.PollingInterval,
-		web.WithLogWriter(cfg.LogWriter),
+		web.WithLogger(logger),
+		web.WithRateStream(b),
 	)
 
 	return &Nozzle{
 		cfg:        cfg,
 		server:     s,
 		aggregator: a,
-		ingestor:   ingress.NewIngestor(msgs, b.Set),
-		processor:  ingress.NewProcessor(b.Next, c.Inc, cfg.IncludeRouterLogs),
+		rates:      rates,
+		stream:     b,
+		ingestor:   ingress.NewIngestor(msgs, ingress.RoundRobin(sets...)),
+		consumer:   cnsmr,
+		buffers:    buffers,
+		processors: processors,
+		logger:     logger,
 	}
 }
 
+// newCounter returns the counter of a single worker. With heavy hitters the
+// capacity is divided across the workers so that the nozzle tracks at most
+// HeavyHittersCapacity application instances in total.
+func newCounter(cfg Config, workers int) store.Shard {
+	if cfg.CounterType == CounterTypeHeavyHitters {
+		capacity := cfg.HeavyHittersCapacity / workers
+		if capacity < 1 {
+			capacity = 1
+		}
+
+		return store.NewHeavyHitterCounter(capacity)
+	}
+
+	return store.NewCounter()
+}
+
 // Addr returns the address that the NoisyNeighbor is bound to.
 func (n *Nozzle) Addr() string {
 	return n.server.Addr()
 }
 
-// Run starts the NoisyNeighbor application. This is a blocking method call.
-func (n *Nozzle) Run() {
-	go n.ingestor.Run()
-	go n.processor.Run()
-	go n.aggregator.Run()
+// Run starts the NoisyNeighbor application. This is a blocking method call
+// that gracefully stops the application once the given context is done. It
+// will disconnect from the firehose, count every envelope that was already
+// buffered, store and stream the counts of the partial polling interval, wait
+// for an accumulator to pull them and complete any active HTTP requests before
+// it returns.
+func (n *Nozzle) Run(ctx context.Context) {
+	ingestCtx, stopIngestor := context.WithCancel(context.Background())
+	ingested := make(chan struct{})
+	go func() {
+		defer close(ingested)
+		n.ingestor.Run(ingestCtx)
+	}()
 
-	n.server.Serve()
-}
+	var processed sync.WaitGroup
+	for _, p := range n.processors {
+		processed.Add(1)
+		go func(p *ingress.Processor) {
+			defer processed.Done()
+			p.Run()
+		}(p)
+	}
+
+	aggregateCtx, stopAggregator := context.WithCancel(context.Background())
+	aggregated := make(chan struct{})
+	go func() {
+		defer close(aggregated)
+		n.aggregator.Run(aggregateCtx)
+	}()
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		n.server.Serve()
+	}()
+
+	<-ctx.Done()
+	n.logger.Info("shutting down")
+
+	if err := n.consumer.Close(); err != nil {
+		n.logger.Error("failed to close firehose consumer", "error", err)
+	}
+	stopIngestor()
+	<-ingested
+
+	// Processors return once the envelopes in their buffer are counted.
+	for _, b := range n.buffers {
+		b.Close()
+	}
+	processed.Wait()
+
+	stopAggregator()
+	<-aggregated
+	final := n.aggregator.Flush()
+	n.waitForPull(final.Timestamp)
 
-// Stop gracefully stops the NoisyNeighbor application. It will disconnect from
-// the firehose, and complete any active HTTP requests.
-func (n *Nozzle) Stop() {
 	n.server.Stop()
+	<-served
+	n.logger.Info("shut down")
+}
+
+// waitForPull waits until the rate for the given timestamp was pulled by an
+// accumulator or the shutdown drain timeout passed. Accumulators that stream
+// rates are sent the rate while the server stops, so there is no need to
+// wait for them.
+func (n *Nozzle) waitForPull(ts int64) {
+	if n.stream.Subscribers() > 0 {
+		return
+	}
+
+	timer := time.NewTimer(n.cfg.ShutdownDrainTimeout)
+	defer timer.Stop()
+
+	for !n.rates.hasPulled(ts) {
+		select {
+		case <-n.rates.pulled:
+		case <-timer.C:
+			n.logger.Warn("final rate was not pulled", "timestamp", ts)
+			return
+		}
+	}
+}
+
+// pullTracker is a web.RateStore that records the newest rate that was
+// served.
+type pullTracker struct {
+	web.RateStore
+
+	mu     sync.Mutex
+	newest int64
+	pulled chan struct{}
+}
+
+func (t *pullTracker) Rate(ts int64) (store.Rate, error) {
+	r, err := t.RateStore.Rate(ts)
+	if err == nil {
+		t.record(r.Timestamp)
+	}
+
+	return r, err
+}
+
+func (t *pullTracker) Range(start, end int64) ([]store.Rate, error) {
+	rates, err := t.RateStore.Range(start, end)
+	if err == nil {
+		for _, r := range rates {
+			t.record(r.Timestamp)
+		}
+	}
+
+	return rates, err
+}
+
+func (t *pullTracker) record(ts int64) {
+	t.mu.Lock()
+	if ts > t.newest {
+		t.newest = ts
+	}
+	t.mu.Unlock()
+
+	select {
+	case t.pulled <- struct{}{}:
+	default:
+	}
+}
+
+func (t *pullTracker) hasPulled(ts int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.newest >= ts
 }
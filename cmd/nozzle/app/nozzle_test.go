@@ -1,8 +1,9 @@
 package app_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/cmd/nozzle/app"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 	"github.com/cloudfoundry/sonde-go/events"
 	"github.com/gogo/protobuf/proto"
 	"github.com/gorilla/websocket"
@@ -32,13 +35,21 @@ var _ = Describe("Nozzle", func() {
 			PollingInterval: 100 * time.Millisecond,
 			MaxRateBuckets:  10,
 			UAAAddr:         uaa.server.URL,
-			LogWriter:       ioutil.Discard,
+			Logger:          logging.New(GinkgoWriter, logging.LevelDebug),
 		}
 		nn := app.New(cfg)
 		Expect(uaa.tokenCalled()).To(Equal(int64(1)))
 
-		go nn.Run()
-		defer nn.Stop()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			nn.Run(ctx)
+		}()
+		defer func() {
+			cancel()
+			Eventually(done).Should(BeClosed())
+		}()
 
 		Eventually(func() error {
 			req, err := http.NewRequest(
@@ -55,8 +66,65 @@ var _ = Describe("Nozzle", func() {
 			return err
 		}).Should(Succeed())
 	})
+
+	It("serves the final partial rate after it is stopped", func() {
+		uaa := newSpyUAA()
+		defer uaa.stop()
+
+		loggregator := newFakeLoggregator(testEnvelopes)
+		defer loggregator.stop()
+
+		cfg := app.Config{
+			LoggregatorAddr:      strings.Replace(loggregator.server.URL, "http", "ws", -1),
+			BufferSize:           1000,
+			PollingInterval:      time.Hour,
+			MaxRateBuckets:       10,
+			UAAAddr:              uaa.server.URL,
+			ShutdownDrainTimeout: time.Minute,
+			Logger:               logging.New(GinkgoWriter, logging.LevelDebug),
+		}
+		nn := app.New(cfg)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			nn.Run(ctx)
+		}()
+
+		Eventually(func() (*http.Response, error) {
+			return getRates(nn.Addr())
+		}).ShouldNot(BeNil())
+
+		cancel()
+		Consistently(done, 250*time.Millisecond).ShouldNot(BeClosed())
+
+		resp, err := getRates(nn.Addr())
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		var rates []store.Rate
+		Expect(json.NewDecoder(resp.Body).Decode(&rates)).To(Succeed())
+		Expect(rates).To(HaveLen(1))
+		Expect(rates[0].Timestamp).To(BeNumerically(">", time.Now().Unix()))
+
+		Eventually(done).Should(BeClosed())
+	})
 })
 
+func getRates(addr string) (*http.Response, error) {
+	req, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("http://%s/rates", addr),
+		nil,
+	)
+	Expect(err).ToNot(HaveOccurred())
+
+	req.Header.Add("Authorization", "Bearer some-token")
+
+	return http.DefaultClient.Do(req)
+}
+
 var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
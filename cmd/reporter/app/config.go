@@ -0,0 +1,379 @@
+package app
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/kafka"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/otlp"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/statsd"
+)
+
+// Exporters that can be enabled via the EXPORTERS environment variable.
+const (
+	ExporterDatadog  = "datadog"
+	ExporterStatsD   = "statsd"
+	ExporterInfluxDB = "influxdb"
+	ExporterOTLP     = "otlp"
+	ExporterGraphite = "graphite"
+	ExporterKafka    = "kafka"
+)
+
+// Config stores configuration data for the reporter.
+type Config struct {
+	// UAAAddr, CAPIAddr, AccumulatorAddr, ClientID and ClientSecret configure
+	// the single foundation that is reported on when Foundations is not set.
+	UAAAddr         string        `env:"UAA_ADDR"`
+	CAPIAddr        string        `env:"CAPI_ADDR"`
+	AccumulatorAddr string        `env:"ACCUMULATOR_ADDR"`
+	ClientID        string        `env:"CLIENT_ID"`
+	ClientSecret    string        `env:"CLIENT_SECRET, noreport"`
+	SkipCertVerify  bool          `env:"SKIP_CERT_VERIFY"`
+	ReportInterval  time.Duration `env:"REPORT_INTERVAL"`
+	RateInterval    time.Duration `env:"RATE_INTERVAL"`
+	ReporterHost    string        `env:"REPORTER_HOST"`
+	ReportLimit     int           `env:"REPORT_LIMIT"`
+
+	// Port is the port /health and /metrics are served on. HealthMaxFailures
+	// is the number of consecutive failed exports after which an exporter is
+	// reported as unhealthy.
+	Port              uint16 `env:"PORT"`
+	HealthMaxFailures int    `env:"HEALTH_MAX_FAILURES"`
+
+	// Foundations is a JSON list of the foundations to report on, each in
+	// the format of Foundation. The Points of every foundation are tagged
+	// with its name.
+	Foundations string `env:"FOUNDATIONS, noreport"`
+
+	// FoundationConfigs are the foundations that are reported on, either
+	// parsed from Foundations or the single unnamed foundation.
+	FoundationConfigs []Foundation
+
+	// Exporters is the list of exporters points are sent to.
+	Exporters []string `env:"EXPORTERS"`
+
+	DatadogAPIKey         string        `env:"DATADOG_API_KEY, noreport"`
+	DatadogSite           string        `env:"DATADOG_SITE"`
+	DatadogEndpoint       string        `env:"DATADOG_ENDPOINT"`
+	DatadogAPIVersion     string        `env:"DATADOG_API_VERSION"`
+	DatadogReportInterval time.Duration `env:"DATADOG_REPORT_INTERVAL"`
+	DatadogRequestTimeout time.Duration `env:"DATADOG_REQUEST_TIMEOUT"`
+	DatadogExportTimeout  time.Duration `env:"DATADOG_EXPORT_TIMEOUT"`
+	DatadogCompression    string        `env:"DATADOG_COMPRESSION"`
+	DatadogQueueSize      int           `env:"DATADOG_QUEUE_SIZE"`
+	DatadogMaxAttempts    int           `env:"DATADOG_MAX_ATTEMPTS"`
+	DatadogMetricPrefix   string        `env:"DATADOG_METRIC_PREFIX"`
+	DatadogMetricName     string        `env:"DATADOG_METRIC_NAME"`
+	DatadogTags           []string      `env:"DATADOG_TAGS"`
+	DatadogLegacyTag      bool          `env:"DATADOG_LEGACY_TAG"`
+	DatadogAppAggregates  bool          `env:"DATADOG_APP_AGGREGATES"`
+	DatadogHeartbeat      bool          `env:"DATADOG_HEARTBEAT"`
+
+	DatadogEvents          bool   `env:"DATADOG_EVENTS"`
+	DatadogEventsTopN      int    `env:"DATADOG_EVENTS_TOP_N"`
+	DatadogEventsThreshold uint64 `env:"DATADOG_EVENTS_THRESHOLD"`
+
+	StatsDAddr           string        `env:"STATSD_ADDR"`
+	StatsDPrefix         string        `env:"STATSD_PREFIX"`
+	StatsDDogStatsDTags  bool          `env:"STATSD_DOGSTATSD_TAGS"`
+	StatsDSampleRate     float64       `env:"STATSD_SAMPLE_RATE"`
+	StatsDMaxPacketSize  int           `env:"STATSD_MAX_PACKET_SIZE"`
+	StatsDSelfMetrics    bool          `env:"STATSD_SELF_METRICS"`
+	StatsDReportInterval time.Duration `env:"STATSD_REPORT_INTERVAL"`
+	StatsDWriteTimeout   time.Duration `env:"STATSD_WRITE_TIMEOUT"`
+
+	InfluxDBAddr            string        `env:"INFLUXDB_ADDR"`
+	InfluxDBDatabase        string        `env:"INFLUXDB_DATABASE"`
+	InfluxDBRetentionPolicy string        `env:"INFLUXDB_RETENTION_POLICY"`
+	InfluxDBUsername        string        `env:"INFLUXDB_USERNAME"`
+	InfluxDBPassword        string        `env:"INFLUXDB_PASSWORD, noreport"`
+	InfluxDBOrg             string        `env:"INFLUXDB_ORG"`
+	InfluxDBBucket          string        `env:"INFLUXDB_BUCKET"`
+	InfluxDBToken           string        `env:"INFLUXDB_TOKEN, noreport"`
+	InfluxDBBatchSize       int           `env:"INFLUXDB_BATCH_SIZE"`
+	InfluxDBGzip            bool          `env:"INFLUXDB_GZIP"`
+	InfluxDBReportInterval  time.Duration `env:"INFLUXDB_REPORT_INTERVAL"`
+	InfluxDBRequestTimeout  time.Duration `env:"INFLUXDB_REQUEST_TIMEOUT"`
+
+	OTLPEndpoint       string        `env:"OTLP_ENDPOINT"`
+	OTLPProtocol       string        `env:"OTLP_PROTOCOL"`
+	OTLPHeaders        string        `env:"OTLP_HEADERS, noreport"`
+	OTLPReportInterval time.Duration `env:"OTLP_REPORT_INTERVAL"`
+	OTLPRequestTimeout time.Duration `env:"OTLP_REQUEST_TIMEOUT"`
+
+	GraphiteAddr           string        `env:"GRAPHITE_ADDR"`
+	GraphitePrefix         string        `env:"GRAPHITE_PREFIX"`
+	GraphiteBufferSize     int           `env:"GRAPHITE_BUFFER_SIZE"`
+	GraphiteMaxBackoff     time.Duration `env:"GRAPHITE_MAX_BACKOFF"`
+	GraphiteReportInterval time.Duration `env:"GRAPHITE_REPORT_INTERVAL"`
+	GraphiteWriteTimeout   time.Duration `env:"GRAPHITE_WRITE_TIMEOUT"`
+
+	KafkaBrokers         []string      `env:"KAFKA_BROKERS"`
+	KafkaTopic           string        `env:"KAFKA_TOPIC"`
+	KafkaFormat          string        `env:"KAFKA_FORMAT"`
+	KafkaTLS             bool          `env:"KAFKA_TLS"`
+	KafkaSpoolDir        string        `env:"KAFKA_SPOOL_DIR"`
+	KafkaSpoolMaxBuckets int           `env:"KAFKA_SPOOL_MAX_BUCKETS"`
+	KafkaReportInterval  time.Duration `env:"KAFKA_REPORT_INTERVAL"`
+	KafkaRequestTimeout  time.Duration `env:"KAFKA_REQUEST_TIMEOUT"`
+
+	CAPIRequestTimeout time.Duration `env:"CAPI_REQUEST_TIMEOUT"`
+
+	AppInfoCacheTTL time.Duration `env:"APP_INFO_CACHE_TTL"`
+
+	// LogLevel is the minimum level of the lines that are logged: debug,
+	// info, warn or error.
+	LogLevel string `env:"LOG_LEVEL"`
+
+	TLSConfig *tls.Config
+	Logger    *logging.Logger
+}
+
+// Foundation is the configuration of a single CF foundation the reporter
+// reports on.
+type Foundation struct {
+	Name            string `json:"name"`
+	UAAAddr         string `json:"uaa_addr"`
+	CAPIAddr        string `json:"capi_addr"`
+	AccumulatorAddr string `json:"accumulator_addr"`
+	ClientID        string `json:"client_id"`
+	ClientSecret    string `json:"client_secret"`
+}
+
+// LoadConfig loads the configuration settings from the current environment.
+// It exits if the configuration is invalid.
+func LoadConfig() Config {
+	cfg, err := ParseConfig()
+	if err != nil {
+		logging.Default().Fatal("invalid config", "error", err)
+	}
+
+	return cfg
+}
+
+// ParseConfig parses the configuration settings from the current
+// environment.
+func ParseConfig() (Config, error) {
+	cfg := Config{
+		ReportInterval:         time.Minute,
+		RateInterval:           time.Minute,
+		ReportLimit:            50,
+		Port:                   8080,
+		HealthMaxFailures:      5,
+		SkipCertVerify:         false,
+		AppInfoCacheTTL:        150 * time.Second,
+		CAPIRequestTimeout:     5 * time.Second,
+		DatadogSite:            datadog.DefaultSite,
+		DatadogAPIVersion:      datadog.APIVersionV1,
+		DatadogRequestTimeout:  5 * time.Second,
+		DatadogExportTimeout:   30 * time.Second,
+		DatadogCompression:     datadog.CompressionGzip,
+		DatadogQueueSize:       10000,
+		DatadogMaxAttempts:     5,
+		DatadogLegacyTag:       true,
+		DatadogHeartbeat:       true,
+		StatsDSampleRate:       1,
+		StatsDMaxPacketSize:    statsd.DefaultMaxPacketSize,
+		StatsDWriteTimeout:     time.Second,
+		InfluxDBBatchSize:      5000,
+		InfluxDBGzip:           true,
+		InfluxDBRequestTimeout: 5 * time.Second,
+		OTLPProtocol:           otlp.ProtocolHTTP,
+		OTLPRequestTimeout:     5 * time.Second,
+		GraphitePrefix:         "noisy-neighbor",
+		GraphiteBufferSize:     10000,
+		GraphiteMaxBackoff:     time.Minute,
+		GraphiteWriteTimeout:   5 * time.Second,
+		KafkaFormat:            kafka.FormatJSON,
+		KafkaSpoolDir:          filepath.Join(os.TempDir(), "noisy-neighbor-kafka-spool"),
+		KafkaSpoolMaxBuckets:   60,
+		KafkaRequestTimeout:    10 * time.Second,
+		Exporters:              []string{ExporterDatadog},
+		LogLevel:               "info",
+	}
+
+	if err := envstruct.Load(&cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to load config: %s", err)
+	}
+
+	for i, e := range cfg.Exporters {
+		cfg.Exporters[i] = strings.TrimSpace(e)
+	}
+
+	for i, t := range cfg.DatadogTags {
+		cfg.DatadogTags[i] = strings.TrimSpace(t)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+
+	// The log level is validated with the config.
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	cfg.Logger = logging.New(os.Stdout, level)
+
+	// Foundations are validated with the config.
+	cfg.FoundationConfigs, _ = cfg.foundations()
+
+	if cfg.DatadogReportInterval == 0 {
+		cfg.DatadogReportInterval = cfg.ReportInterval
+	}
+
+	if cfg.StatsDReportInterval == 0 {
+		cfg.StatsDReportInterval = cfg.ReportInterval
+	}
+
+	if cfg.InfluxDBReportInterval == 0 {
+		cfg.InfluxDBReportInterval = cfg.ReportInterval
+	}
+
+	if cfg.OTLPReportInterval == 0 {
+		cfg.OTLPReportInterval = cfg.ReportInterval
+	}
+
+	if cfg.GraphiteReportInterval == 0 {
+		cfg.GraphiteReportInterval = cfg.ReportInterval
+	}
+
+	if cfg.KafkaReportInterval == 0 {
+		cfg.KafkaReportInterval = cfg.ReportInterval
+	}
+
+	cfg.TLSConfig = &tls.Config{InsecureSkipVerify: cfg.SkipCertVerify}
+
+	return cfg, nil
+}
+
+// foundations returns the foundations configured with FOUNDATIONS or, if it
+// is not set, the single unnamed foundation.
+func (c Config) foundations() ([]Foundation, error) {
+	if c.Foundations == "" {
+		f := Foundation{
+			UAAAddr:         c.UAAAddr,
+			CAPIAddr:        c.CAPIAddr,
+			AccumulatorAddr: c.AccumulatorAddr,
+			ClientID:        c.ClientID,
+			ClientSecret:    c.ClientSecret,
+		}
+		if f.UAAAddr == "" || f.CAPIAddr == "" || f.AccumulatorAddr == "" || f.ClientID == "" || f.ClientSecret == "" {
+			return nil, errors.New("UAA_ADDR, CAPI_ADDR, ACCUMULATOR_ADDR, CLIENT_ID and CLIENT_SECRET are required without FOUNDATIONS")
+		}
+
+		return []Foundation{f}, nil
+	}
+
+	var foundations []Foundation
+	if err := json.Unmarshal([]byte(c.Foundations), &foundations); err != nil {
+		return nil, fmt.Errorf("failed to parse FOUNDATIONS: %s", err)
+	}
+	if len(foundations) == 0 {
+		return nil, errors.New("FOUNDATIONS must contain at least one foundation")
+	}
+
+	names := make(map[string]bool)
+	for _, f := range foundations {
+		if f.Name == "" {
+			return nil, errors.New("every foundation in FOUNDATIONS requires a name")
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("foundation %q is configured more than once in FOUNDATIONS", f.Name)
+		}
+		names[f.Name] = true
+
+		if f.UAAAddr == "" || f.CAPIAddr == "" || f.AccumulatorAddr == "" || f.ClientID == "" || f.ClientSecret == "" {
+			return nil, fmt.Errorf("foundation %q requires uaa_addr, capi_addr, accumulator_addr, client_id and client_secret", f.Name)
+		}
+	}
+
+	return foundations, nil
+}
+
+func (c Config) validate() error {
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+
+	if _, err := c.foundations(); err != nil {
+		return err
+	}
+
+	if len(c.Exporters) == 0 {
+		return errors.New("at least one exporter must be enabled in EXPORTERS")
+	}
+
+	for _, e := range c.Exporters {
+		switch e {
+		case ExporterDatadog:
+			if c.DatadogAPIKey == "" {
+				return errors.New("DATADOG_API_KEY is required for the datadog exporter")
+			}
+
+			if c.DatadogAPIVersion != datadog.APIVersionV1 && c.DatadogAPIVersion != datadog.APIVersionV2 {
+				return fmt.Errorf("unknown DATADOG_API_VERSION %q, expected v1 or v2", c.DatadogAPIVersion)
+			}
+
+			switch c.DatadogCompression {
+			case datadog.CompressionGzip, datadog.CompressionDeflate, datadog.CompressionNone:
+			default:
+				return fmt.Errorf("unknown DATADOG_COMPRESSION %q, expected gzip, deflate or none", c.DatadogCompression)
+			}
+
+			if c.DatadogExportTimeout <= 0 {
+				return errors.New("DATADOG_EXPORT_TIMEOUT must be positive")
+			}
+		case ExporterStatsD:
+			if c.StatsDAddr == "" {
+				return errors.New("STATSD_ADDR is required for the statsd exporter")
+			}
+
+			if c.StatsDSampleRate <= 0 || c.StatsDSampleRate > 1 {
+				return errors.New("STATSD_SAMPLE_RATE must be greater than 0 and at most 1")
+			}
+		case ExporterInfluxDB:
+			if c.InfluxDBAddr == "" {
+				return errors.New("INFLUXDB_ADDR is required for the influxdb exporter")
+			}
+
+			if c.InfluxDBBucket == "" && c.InfluxDBDatabase == "" {
+				return errors.New("either INFLUXDB_DATABASE or INFLUXDB_BUCKET is required for the influxdb exporter")
+			}
+
+			if c.InfluxDBBucket != "" && (c.InfluxDBOrg == "" || c.InfluxDBToken == "") {
+				return errors.New("INFLUXDB_ORG and INFLUXDB_TOKEN are required when INFLUXDB_BUCKET is set")
+			}
+		case ExporterOTLP:
+			if c.OTLPEndpoint == "" {
+				return errors.New("OTLP_ENDPOINT is required for the otlp exporter")
+			}
+
+			if _, err := otlp.ParseHeaders(c.OTLPHeaders); err != nil {
+				return fmt.Errorf("invalid OTLP_HEADERS: %s", err)
+			}
+		case ExporterGraphite:
+			if c.GraphiteAddr == "" {
+				return errors.New("GRAPHITE_ADDR is required for the graphite exporter")
+			}
+		case ExporterKafka:
+			if len(c.KafkaBrokers) == 0 || c.KafkaTopic == "" {
+				return errors.New("KAFKA_BROKERS and KAFKA_TOPIC are required for the kafka exporter")
+			}
+
+			if c.KafkaFormat != kafka.FormatJSON && c.KafkaFormat != kafka.FormatAvro {
+				return fmt.Errorf("unknown KAFKA_FORMAT %q, expected json or avro", c.KafkaFormat)
+			}
+		default:
+			return fmt.Errorf("unknown exporter %q", e)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package app_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/cmd/reporter/app"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	required := map[string]string{
+		"UAA_ADDR":         "https://uaa.example.com",
+		"CAPI_ADDR":        "https://api.example.com",
+		"ACCUMULATOR_ADDR": "https://accumulator.example.com",
+		"CLIENT_ID":        "client-id",
+		"CLIENT_SECRET":    "client-secret",
+		"DATADOG_API_KEY":  "api-key",
+	}
+
+	BeforeEach(func() {
+		for k, v := range required {
+			Expect(os.Setenv(k, v)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		for k := range required {
+			Expect(os.Unsetenv(k)).To(Succeed())
+		}
+	})
+
+	It("loads the datadog exporter with only the required variables", func() {
+		cfg, err := app.ParseConfig()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cfg.Exporters).To(Equal([]string{app.ExporterDatadog}))
+		Expect(cfg.DatadogSite).To(Equal(datadog.DefaultSite))
+		Expect(cfg.DatadogAPIVersion).To(Equal(datadog.APIVersionV1))
+		Expect(cfg.DatadogCompression).To(Equal(datadog.CompressionGzip))
+		Expect(cfg.DatadogExportTimeout).To(Equal(30 * time.Second))
+		Expect(cfg.DatadogQueueSize).To(Equal(10000))
+		Expect(cfg.DatadogMaxAttempts).To(Equal(5))
+		Expect(cfg.DatadogReportInterval).To(Equal(time.Minute))
+	})
+
+	It("returns an error without a Datadog API key", func() {
+		Expect(os.Unsetenv("DATADOG_API_KEY")).To(Succeed())
+
+		_, err := app.ParseConfig()
+		Expect(err).To(MatchError(ContainSubstring("DATADOG_API_KEY is required")))
+	})
+})
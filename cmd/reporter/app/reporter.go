@@ -0,0 +1,327 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/auth"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/graphite"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/influxdb"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/kafka"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/otlp"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/statsd"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
+	"github.com/IBM/sarama"
+)
+
+// Reporter is the constructor for the reporter application.
+type Reporter struct {
+	pipeline *sink.Pipeline
+	caches   []*collector.CachedAppInfoStore
+	lis      net.Listener
+	server   *http.Server
+	logger   *logging.Logger
+}
+
+// NewReporter configures and returns a new Reporter
+func NewReporter(cfg Config) *Reporter {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
+	client := &http.Client{
+		Timeout: cfg.CAPIRequestTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: cfg.TLSConfig,
+		},
+	}
+
+	// Every foundation has its own UAA client, app info cache and collector
+	// so that a failing foundation does not affect the others.
+	var (
+		caches         []*collector.CachedAppInfoStore
+		foundations    []collector.Foundation
+		authenticators []*auth.Authenticator
+	)
+	for _, f := range cfg.FoundationConfigs {
+		a := auth.NewAuthenticator(f.ClientID, f.ClientSecret, f.UAAAddr,
+			auth.WithHTTPClient(client),
+			auth.WithLogger(logger),
+		)
+		authenticators = append(authenticators, a)
+
+		httpStore := collector.NewHTTPAppInfoStore(f.CAPIAddr, client, a)
+		cache := collector.NewCachedAppInfoStore(
+			httpStore,
+			collector.WithCacheTTL(cfg.AppInfoCacheTTL),
+			collector.WithCacheLogger(logger),
+		)
+		caches = append(caches, cache)
+
+		logger.Info("initializing collector", "foundation", f.Name, "accumulator", f.AccumulatorAddr)
+		foundations = append(foundations, collector.Foundation{
+			Name: f.Name,
+			Builder: collector.New([]string{f.AccumulatorAddr}, a, "", cache,
+				collector.WithReportLimit(cfg.ReportLimit),
+				collector.WithHTTPClient(client),
+				collector.WithLogger(logger),
+			),
+		})
+	}
+
+	opts := []sink.PipelineOption{
+		sink.WithRateInterval(cfg.RateInterval),
+		sink.WithLogger(logger),
+	}
+	for _, e := range cfg.Exporters {
+		logger.Info("initializing exporter", "exporter", e)
+
+		switch e {
+		case ExporterDatadog:
+			ddClient := &http.Client{
+				Timeout:   cfg.DatadogRequestTimeout,
+				Transport: http.DefaultTransport,
+			}
+
+			ddExporter := datadog.NewExporter(cfg.DatadogAPIKey,
+				datadog.WithHost(cfg.ReporterHost),
+				datadog.WithSite(cfg.DatadogSite),
+				datadog.WithEndpoint(cfg.DatadogEndpoint),
+				datadog.WithAPIVersion(cfg.DatadogAPIVersion),
+				datadog.WithHTTPClient(ddClient),
+				datadog.WithCompression(cfg.DatadogCompression),
+				datadog.WithQueueSize(cfg.DatadogQueueSize),
+				datadog.WithRetry(cfg.DatadogMaxAttempts, time.Second, 30*time.Second),
+				datadog.WithMetricPrefix(cfg.DatadogMetricPrefix),
+				datadog.WithMetricName(cfg.DatadogMetricName),
+				datadog.WithTags(cfg.DatadogTags),
+				datadog.WithLegacyTag(cfg.DatadogLegacyTag),
+				datadog.WithAppAggregates(cfg.DatadogAppAggregates),
+				datadog.WithHeartbeat(cfg.DatadogHeartbeat),
+			)
+
+			opts = append(opts, sink.WithExporter(
+				ExporterDatadog,
+				ddExporter,
+				cfg.DatadogReportInterval,
+				cfg.DatadogExportTimeout,
+			))
+
+			if cfg.DatadogEvents {
+				logger.Info("initializing exporter", "exporter", "datadog-events")
+
+				opts = append(opts, sink.WithExporter(
+					"datadog-events",
+					datadog.NewEventExporter(ddExporter,
+						datadog.WithTopN(cfg.DatadogEventsTopN),
+						datadog.WithThreshold(cfg.DatadogEventsThreshold),
+					),
+					cfg.DatadogReportInterval,
+					cfg.DatadogExportTimeout,
+				))
+			}
+		case ExporterStatsD:
+			e, err := statsd.NewExporter(cfg.StatsDAddr,
+				statsd.WithPrefix(cfg.StatsDPrefix),
+				statsd.WithDogStatsDTags(cfg.StatsDDogStatsDTags),
+				statsd.WithSampleRate(cfg.StatsDSampleRate),
+				statsd.WithMaxPacketSize(cfg.StatsDMaxPacketSize),
+				statsd.WithSelfMetrics(cfg.StatsDSelfMetrics),
+			)
+			if err != nil {
+				logger.Fatal("failed to initialize statsd exporter", "error", err)
+			}
+
+			opts = append(opts, sink.WithExporter(
+				ExporterStatsD,
+				e,
+				cfg.StatsDReportInterval,
+				cfg.StatsDWriteTimeout,
+			))
+		case ExporterInfluxDB:
+			influxOpts := []influxdb.ExporterOption{
+				influxdb.WithBatchSize(cfg.InfluxDBBatchSize),
+				influxdb.WithGzip(cfg.InfluxDBGzip),
+				influxdb.WithHTTPClient(&http.Client{
+					Timeout:   cfg.InfluxDBRequestTimeout,
+					Transport: http.DefaultTransport,
+				}),
+			}
+			if cfg.InfluxDBBucket != "" {
+				influxOpts = append(influxOpts,
+					influxdb.WithV2(cfg.InfluxDBOrg, cfg.InfluxDBBucket, cfg.InfluxDBToken),
+				)
+			} else {
+				influxOpts = append(influxOpts,
+					influxdb.WithDatabase(cfg.InfluxDBDatabase, cfg.InfluxDBRetentionPolicy),
+					influxdb.WithBasicAuth(cfg.InfluxDBUsername, cfg.InfluxDBPassword),
+				)
+			}
+
+			opts = append(opts, sink.WithExporter(
+				ExporterInfluxDB,
+				influxdb.NewExporter(cfg.InfluxDBAddr, influxOpts...),
+				cfg.InfluxDBReportInterval,
+				cfg.InfluxDBRequestTimeout,
+			))
+		case ExporterOTLP:
+			// Headers are validated when the config is loaded.
+			headers, _ := otlp.ParseHeaders(cfg.OTLPHeaders)
+
+			attrs := map[string]string{"service.name": "noisy-neighbor-reporter"}
+			if cfg.ReporterHost != "" {
+				attrs["cf.foundation"] = cfg.ReporterHost
+			}
+
+			e, err := otlp.NewExporter(cfg.OTLPEndpoint,
+				otlp.WithProtocol(cfg.OTLPProtocol),
+				otlp.WithHeaders(headers),
+				otlp.WithResourceAttributes(attrs),
+				otlp.WithTLSConfig(cfg.TLSConfig),
+			)
+			if err != nil {
+				logger.Fatal("failed to initialize otlp exporter", "error", err)
+			}
+
+			opts = append(opts, sink.WithExporter(
+				ExporterOTLP,
+				e,
+				cfg.OTLPReportInterval,
+				cfg.OTLPRequestTimeout,
+			))
+		case ExporterGraphite:
+			opts = append(opts, sink.WithExporter(
+				ExporterGraphite,
+				graphite.NewExporter(cfg.GraphiteAddr,
+					graphite.WithPrefix(cfg.GraphitePrefix),
+					graphite.WithBufferSize(cfg.GraphiteBufferSize),
+					graphite.WithBackoff(time.Second, cfg.GraphiteMaxBackoff),
+				),
+				cfg.GraphiteReportInterval,
+				cfg.GraphiteWriteTimeout,
+			))
+		case ExporterKafka:
+			saramaCfg := sarama.NewConfig()
+			saramaCfg.Net.TLS.Enable = cfg.KafkaTLS
+			saramaCfg.Net.TLS.Config = cfg.TLSConfig
+
+			p, err := kafka.NewSaramaProducer(cfg.KafkaBrokers, saramaCfg)
+			if err != nil {
+				logger.Fatal("failed to initialize kafka producer", "error", err)
+			}
+
+			e, err := kafka.NewExporter(p, cfg.KafkaTopic,
+				kafka.WithFormat(cfg.KafkaFormat),
+				kafka.WithSpool(cfg.KafkaSpoolDir, cfg.KafkaSpoolMaxBuckets),
+				kafka.WithLogger(logger),
+			)
+			if err != nil {
+				logger.Fatal("failed to initialize kafka exporter", "error", err)
+			}
+
+			opts = append(opts, sink.WithExporter(
+				ExporterKafka,
+				e,
+				cfg.KafkaReportInterval,
+				cfg.KafkaRequestTimeout,
+			))
+		default:
+			logger.Fatal("unknown exporter", "exporter", e)
+		}
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		logger.Fatal("failed to start listener", "port", cfg.Port, "error", err)
+	}
+	logger.Info("health server bound", "addr", lis.Addr().String())
+
+	pb := collector.NewFoundationPointBuilder(foundations,
+		collector.WithFoundationLogger(logger),
+	)
+	r := &Reporter{
+		pipeline: sink.NewPipeline(pb, opts...),
+		caches:   caches,
+		lis:      lis,
+		logger:   logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", web.Health(r, cfg.HealthMaxFailures))
+	mux.Handle("/metrics", web.Metrics(r))
+	mux.Handle("/top", web.AdminAuthMiddleware(checkToken(authenticators))(
+		web.Top(r.pipeline),
+	))
+	r.server = &http.Server{Handler: mux}
+
+	return r
+}
+
+// checkToken returns a web.CheckToken that accepts tokens that are valid with
+// the UAA of any of the foundations, as /top renders the applications of
+// every foundation.
+func checkToken(authenticators []*auth.Authenticator) web.CheckToken {
+	return func(token, scope string) bool {
+		for _, a := range authenticators {
+			if a.CheckToken(token, scope) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Addr returns the address the HTTP endpoints of the reporter are served on.
+func (r *Reporter) Addr() string {
+	return r.lis.Addr().String()
+}
+
+// Stats returns the statistics of every exporter and the sum of the
+// statistics of the app info cache of every foundation.
+func (r *Reporter) Stats() web.ReporterStats {
+	stats := web.ReporterStats{
+		Exporters: r.pipeline.Stats(),
+	}
+	for _, c := range r.caches {
+		cs := c.Stats()
+		stats.Cache.Hits += cs.Hits
+		stats.Cache.Misses += cs.Misses
+		stats.Cache.LookupErrors += cs.LookupErrors
+	}
+
+	return stats
+}
+
+// Run starts the reporter. This is a blocking method call that gracefully
+// stops the reporter once the given context is done. It waits for in flight
+// exports and completes any active HTTP requests before it returns.
+func (r *Reporter) Run(ctx context.Context) {
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := r.server.Serve(r.lis); err != nil && err != http.ErrServerClosed {
+			r.logger.Error("health server stopped", "error", err)
+		}
+	}()
+
+	r.pipeline.Run(ctx)
+	r.logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.server.Shutdown(shutdownCtx); err != nil {
+		r.logger.Error("failed to shut down health server", "error", err)
+	}
+	<-served
+	r.logger.Info("shut down")
+}
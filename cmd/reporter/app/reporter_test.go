@@ -0,0 +1,118 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/cmd/reporter/app"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reporter", func() {
+	var (
+		uaa    *spyUAA
+		r      *app.Reporter
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+
+	BeforeEach(func() {
+		uaa = newSpyUAA()
+
+		r = app.NewReporter(app.Config{
+			FoundationConfigs: []app.Foundation{{
+				UAAAddr:         uaa.server.URL,
+				CAPIAddr:        "http://capi.example.com",
+				AccumulatorAddr: "http://accumulator.example.com",
+				ClientID:        "client-id",
+				ClientSecret:    "client-secret",
+			}},
+			ReportInterval: time.Hour,
+			RateInterval:   time.Minute,
+			Logger:         logging.New(GinkgoWriter, logging.LevelDebug),
+		})
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			r.Run(ctx)
+		}()
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+		uaa.server.Close()
+	})
+
+	get := func(path, token string) int {
+		req, err := http.NewRequest(
+			http.MethodGet,
+			fmt.Sprintf("http://%s%s", r.Addr(), path),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	It("requires a token for /top", func() {
+		Expect(get("/top", "")).To(Equal(http.StatusBadRequest))
+		Expect(uaa.checkCalled()).To(BeZero())
+	})
+
+	It("rejects tokens the UAA rejects", func() {
+		uaa.status = http.StatusUnauthorized
+
+		Expect(get("/top", "some-token")).To(Equal(http.StatusUnauthorized))
+		Expect(uaa.checkCalled()).To(Equal(int64(1)))
+	})
+
+	It("serves /top to tokens the UAA accepts", func() {
+		Expect(get("/top", "some-token")).To(Equal(http.StatusOK))
+	})
+
+	It("serves /health without a token", func() {
+		Expect(get("/health", "")).To(Equal(http.StatusOK))
+	})
+})
+
+type spyUAA struct {
+	status       int
+	_checkCalled int64
+	server       *httptest.Server
+}
+
+func newSpyUAA() *spyUAA {
+	s := &spyUAA{status: http.StatusOK}
+	s.server = httptest.NewServer(s)
+
+	return s
+}
+
+func (s *spyUAA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/check_token" {
+		atomic.AddInt64(&s._checkCalled, 1)
+	}
+	w.WriteHeader(s.status)
+}
+
+func (s *spyUAA) checkCalled() int64 {
+	return atomic.LoadInt64(&s._checkCalled)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/cmd/reporter/app"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+)
+
+func main() {
+	cfg := app.LoadConfig()
+
+	logging.SetDefault(cfg.Logger)
+	log.SetFlags(0)
+	log.SetOutput(cfg.Logger.StdWriter())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	app.NewReporter(cfg).Run(ctx)
+}
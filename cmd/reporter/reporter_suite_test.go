@@ -7,7 +7,7 @@ import (
 	"testing"
 )
 
-func TestDatadogReporter(t *testing.T) {
+func TestReporter(t *testing.T) {
 	RegisterFailHandler(Fail)
-	RunSpecs(t, "DatadogReporter Suite")
+	RunSpecs(t, "Reporter Suite")
 }
@@ -5,10 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 )
 
 // Authenticator stores authentication information that can be used to get an
@@ -18,6 +19,7 @@ type Authenticator struct {
 	clientSecret string
 	uaaAddr      string
 	httpClient   HTTPClient
+	logger       *logging.Logger
 }
 
 // NewAuthenticator returns an initialized Authenticator. The authenticator, by
@@ -29,6 +31,7 @@ func NewAuthenticator(id, secret, uaaAddr string, opts ...AuthenticatorOption) *
 		clientSecret: secret,
 		uaaAddr:      uaaAddr,
 		httpClient:   http.DefaultClient,
+		logger:       logging.Default(),
 	}
 
 	for _, o := range opts {
@@ -95,20 +98,20 @@ func (a *Authenticator) CheckToken(token, scope string) bool {
 		strings.NewReader(form.Encode()),
 	)
 	if err != nil {
-		log.Fatalf("failed to build request to UAA: %s", err)
+		a.logger.Fatal("failed to build request to UAA", "error", err)
 	}
 	req.SetBasicAuth(a.clientID, a.clientSecret)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	response, err := a.httpClient.Do(req)
 	if err != nil {
-		log.Printf("failed to check token: %s", err)
+		a.logger.Error("failed to check token", "uaa_addr", a.uaaAddr, "error", err)
 		return false
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		log.Printf("expected 200 status code from /check_token, got %d", response.StatusCode)
+		a.logger.Info("token rejected by UAA", "uaa_addr", a.uaaAddr, "status", response.StatusCode)
 		return false
 	}
 
@@ -132,3 +135,11 @@ func WithHTTPClient(c HTTPClient) AuthenticatorOption {
 		a.httpClient = c
 	}
 }
+
+// WithLogger is an AuthenticatorOption to configure the Logger failed token
+// checks are logged to. Defaults to the default Logger.
+func WithLogger(l *logging.Logger) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.logger = l
+	}
+}
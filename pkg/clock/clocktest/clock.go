@@ -0,0 +1,168 @@
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock"
+)
+
+// Clock is a fake clock.Clock for tests. Its time only moves when it is
+// advanced, firing every timer and ticker that is due in order. Like the
+// timers and tickers of the time package, a tick is dropped if the previous
+// tick was not received yet.
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+type waiter struct {
+	clock    *Clock
+	ch       chan time.Time
+	deadline time.Time
+
+	// period is the interval of a ticker. It is zero for timers.
+	period time.Duration
+}
+
+// New returns a new Clock set to the given time.
+func New(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// Now satisfies the clock.Clock interface.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer satisfies the clock.Clock interface.
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	return timer{c.add(d, 0)}
+}
+
+// NewTicker satisfies the clock.Clock interface.
+func (c *Clock) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	return ticker{c.add(d, d)}
+}
+
+// Advance moves the time forward by the given duration. Every timer and
+// ticker that is due is fired at its deadline, in order of the deadlines.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+		})
+		if len(c.waiters) == 0 || c.waiters[0].deadline.After(end) {
+			break
+		}
+
+		w := c.waiters[0]
+		c.now = w.deadline
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+			continue
+		}
+		c.remove(w)
+	}
+	c.now = end
+	c.cond.Broadcast()
+}
+
+// BlockUntil blocks until the given number of timers and tickers are
+// active. It is used to wait until a component is waiting on the Clock, e.g.
+// to know that it handled the last tick and is waiting for the next.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) != n {
+		c.cond.Wait()
+	}
+}
+
+// Waiters returns the number of active timers and tickers.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+func (c *Clock) add(d, period time.Duration) *waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &waiter{
+		clock:    c,
+		ch:       make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+		period:   period,
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+
+	return w
+}
+
+// remove removes the given waiter and returns whether it was active. The
+// lock must be held.
+func (c *Clock) remove(w *waiter) bool {
+	for i, cw := range c.waiters {
+		if cw == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *waiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *waiter) stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+
+	return w.clock.remove(w)
+}
+
+type timer struct {
+	*waiter
+}
+
+func (t timer) Stop() bool {
+	return t.stop()
+}
+
+type ticker struct {
+	*waiter
+}
+
+func (t ticker) Stop() {
+	t.stop()
+}
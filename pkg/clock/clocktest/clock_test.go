@@ -0,0 +1,88 @@
+package clocktest_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock/clocktest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Clock", func() {
+	var (
+		start time.Time
+		c     *clocktest.Clock
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		c = clocktest.New(start)
+	})
+
+	It("only moves when it is advanced", func() {
+		Expect(c.Now()).To(Equal(start))
+
+		c.Advance(time.Minute)
+
+		Expect(c.Now()).To(Equal(start.Add(time.Minute)))
+	})
+
+	It("fires timers once they are due", func() {
+		t := c.NewTimer(time.Minute)
+
+		c.Advance(59 * time.Second)
+		Expect(t.C()).ToNot(Receive())
+
+		c.Advance(time.Second)
+		Expect(t.C()).To(Receive(Equal(start.Add(time.Minute))))
+		Expect(c.Waiters()).To(BeZero())
+	})
+
+	It("does not fire stopped timers", func() {
+		t := c.NewTimer(time.Minute)
+
+		Expect(t.Stop()).To(BeTrue())
+		Expect(t.Stop()).To(BeFalse())
+
+		c.Advance(time.Minute)
+		Expect(t.C()).ToNot(Receive())
+	})
+
+	It("fires tickers every interval and drops ticks that are not received", func() {
+		t := c.NewTicker(time.Minute)
+		defer t.Stop()
+
+		c.Advance(time.Minute)
+		Expect(t.C()).To(Receive(Equal(start.Add(time.Minute))))
+
+		c.Advance(3 * time.Minute)
+		Expect(t.C()).To(Receive(Equal(start.Add(2 * time.Minute))))
+		Expect(t.C()).ToNot(Receive())
+	})
+
+	It("fires timers and tickers in order of their deadlines", func() {
+		t1 := c.NewTimer(2 * time.Minute)
+		t2 := c.NewTimer(time.Minute)
+
+		c.Advance(time.Hour)
+
+		var first, second time.Time
+		Expect(t2.C()).To(Receive(&first))
+		Expect(t1.C()).To(Receive(&second))
+		Expect(first).To(BeTemporally("<", second))
+		Expect(c.Now()).To(Equal(start.Add(time.Hour)))
+	})
+
+	It("blocks until the given number of timers and tickers are active", func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.BlockUntil(1)
+		}()
+
+		Consistently(done, 50*time.Millisecond).ShouldNot(BeClosed())
+		c.NewTimer(time.Minute)
+		Eventually(done).Should(BeClosed())
+	})
+})
@@ -0,0 +1,13 @@
+package clocktest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestClocktest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Clocktest Suite")
+}
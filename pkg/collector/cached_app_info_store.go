@@ -1,10 +1,11 @@
 package collector
 
 import (
-	"log"
 	"strings"
 	"sync"
 	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 )
 
 // CachedAppInfoStore caches app info lookups against the APIStore.
@@ -12,9 +13,34 @@ type CachedAppInfoStore struct {
 	store            AppInfoStore
 	cacheTTL         time.Duration
 	cacheLastCleared time.Time
+	logger           *logging.Logger
+
+	mu           sync.Mutex
+	cache        map[AppGUID]AppInfo
+	hits         uint64
+	misses       uint64
+	lookupErrors uint64
+}
+
+// CacheStats are the statistics of a CachedAppInfoStore.
+type CacheStats struct {
+	// Hits and Misses are the number of app GUIDs that were and were not
+	// found in the cache.
+	Hits   uint64
+	Misses uint64
+
+	// LookupErrors is the number of failed lookups against the APIStore.
+	LookupErrors uint64
+}
+
+// HitRate returns the fraction of app GUIDs that were found in the cache.
+// It is zero if nothing was looked up yet.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
 
-	mu    sync.Mutex
-	cache map[AppGUID]AppInfo
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
 }
 
 // NewCachedAppInfoStore initializes a CachedAppInfoStore.
@@ -24,6 +50,7 @@ func NewCachedAppInfoStore(s AppInfoStore, opts ...CachedAppInfoStoreOption) *Ca
 		cache:            make(map[AppGUID]AppInfo),
 		cacheTTL:         150 * time.Second,
 		cacheLastCleared: time.Now(),
+		logger:           logging.Default(),
 	}
 
 	for _, opt := range opts {
@@ -35,15 +62,15 @@ func NewCachedAppInfoStore(s AppInfoStore, opts ...CachedAppInfoStoreOption) *Ca
 
 // Lookup associates AppInfo for a particular app GUID.
 func (c *CachedAppInfoStore) Lookup(guids []string) (map[AppGUID]AppInfo, error) {
+	var toLookup []string
+	cached := make(map[AppGUID]AppInfo)
+
+	c.mu.Lock()
 	if c.cacheLastCleared.Add(c.cacheTTL).Before(time.Now()) {
 		c.cache = make(map[AppGUID]AppInfo)
 		c.cacheLastCleared = time.Now()
 	}
 
-	var toLookup []string
-	cached := make(map[AppGUID]AppInfo)
-
-	c.mu.Lock()
 	for _, g := range guids {
 		appInfo, ok := c.cache[AppGUID(g)]
 		if !ok {
@@ -52,6 +79,8 @@ func (c *CachedAppInfoStore) Lookup(guids []string) (map[AppGUID]AppInfo, error)
 		}
 		cached[AppGUID(g)] = appInfo
 	}
+	c.hits += uint64(len(cached))
+	c.misses += uint64(len(toLookup))
 	c.mu.Unlock()
 
 	if len(toLookup) == 0 {
@@ -60,7 +89,12 @@ func (c *CachedAppInfoStore) Lookup(guids []string) (map[AppGUID]AppInfo, error)
 
 	fresh, err := c.store.Lookup(toLookup)
 	if err != nil {
-		log.Printf("call to HTTP store failed: %s", err)
+		c.logger.Error("failed to look up app info", "guids", len(toLookup), "error", err)
+
+		c.mu.Lock()
+		c.lookupErrors++
+		c.mu.Unlock()
+
 		return cached, nil
 	}
 
@@ -68,6 +102,19 @@ func (c *CachedAppInfoStore) Lookup(guids []string) (map[AppGUID]AppInfo, error)
 	return merge(fresh, cached), nil
 }
 
+// Stats returns the cache hits and misses and the number of failed lookups
+// since the CachedAppInfoStore was created.
+func (c *CachedAppInfoStore) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:         c.hits,
+		Misses:       c.misses,
+		LookupErrors: c.lookupErrors,
+	}
+}
+
 func (c *CachedAppInfoStore) updateCache(fresh map[AppGUID]AppInfo) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -84,13 +131,36 @@ func WithCacheTTL(cacheTTL time.Duration) CachedAppInfoStoreOption {
 	}
 }
 
+// WithCacheLogger sets the Logger failed lookups are written to.
+func WithCacheLogger(l *logging.Logger) CachedAppInfoStoreOption {
+	return func(c *CachedAppInfoStore) {
+		c.logger = l
+	}
+}
+
 // GUIDIndex is a concatentation of GUID and instance index in the format
-// some-guid/some-index, e.g., 7b8228a0-cf40-42d8-a7bb-b287a88198a3/0
+// some-guid/some-index, e.g., 7b8228a0-cf40-42d8-a7bb-b287a88198a3/0. Rates
+// of federated accumulators are namespaced with the foundation in the format
+// some-foundation:some-guid/some-index.
 type GUIDIndex string
 
+// Foundation returns the Foundation of the GUIDIndex or an empty string if
+// it is not namespaced.
+func (g GUIDIndex) Foundation() string {
+	i := strings.Index(string(g), foundationSeparator)
+	if i < 0 {
+		return ""
+	}
+	return string(g[:i])
+}
+
 // GUID returns the GUID of the GUIDIndex
 func (g GUIDIndex) GUID() string {
-	return strings.Split(string(g), "/")[0]
+	guidIndex := string(g)
+	if i := strings.Index(guidIndex, foundationSeparator); i >= 0 {
+		guidIndex = guidIndex[i+1:]
+	}
+	return strings.Split(guidIndex, "/")[0]
 }
 
 // Index returns the Index of the GUIDIndex
@@ -77,6 +77,31 @@ var _ = Describe("CachedAppInfoStore", func() {
 		Expect(actual).To(Equal(emptyCache))
 	})
 
+	It("counts cache hits, misses and lookup errors", func() {
+		apiStore := &spyAPIStore{
+			lookupReturns: map[collector.AppGUID]collector.AppInfo{
+				"app-guid-1": collector.AppInfo{Name: "some-name"},
+			},
+		}
+		store := collector.NewCachedAppInfoStore(apiStore)
+
+		Expect(store.Stats().HitRate()).To(BeZero())
+
+		_, _ = store.Lookup([]string{"app-guid-1"})
+		_, _ = store.Lookup([]string{"app-guid-1"})
+		_, _ = store.Lookup([]string{"app-guid-1"})
+		apiStore.lookupError = errors.New("HTTP request failed")
+		_, _ = store.Lookup([]string{"app-guid-1", "app-guid-2"})
+
+		stats := store.Stats()
+		Expect(stats).To(Equal(collector.CacheStats{
+			Hits:         3,
+			Misses:       2,
+			LookupErrors: 1,
+		}))
+		Expect(stats.HitRate()).To(Equal(0.6))
+	})
+
 	// NOTE This test assumes test invocations occur with `-race`.
 	It("supports thread safe read access", func() {
 		apiStore := &spyAPIStore{
@@ -118,6 +143,18 @@ var _ = Describe("CachedAppInfoStore", func() {
 			Expect(id).To(Equal("0"))
 		})
 
+		It("returns the GUID of a namespaced GUIDIndex", func() {
+			g := collector.GUIDIndex("prod-east:12abc/3")
+
+			Expect(g.GUID()).To(Equal("12abc"))
+			Expect(g.Index()).To(Equal("3"))
+		})
+
+		It("returns a foundation", func() {
+			Expect(collector.GUIDIndex("prod-east:12abc/3").Foundation()).To(Equal("prod-east"))
+			Expect(collector.GUIDIndex("12abc/3").Foundation()).To(BeEmpty())
+		})
+
 		It("returns 0 when no index is found", func() {
 			g := collector.GUIDIndex("12abc")
 
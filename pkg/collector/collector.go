@@ -7,7 +7,8 @@ import (
 	"sort"
 	"time"
 
-	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 )
 
@@ -30,6 +31,11 @@ type Collector struct {
 	reportLimit   int
 	nozzleAppGUID string
 	store         AppInfoStore
+	logger        *logging.Logger
+
+	streamMergeTimeout time.Duration
+	minStreamBackoff   time.Duration
+	maxStreamBackoff   time.Duration
 }
 
 // New initializes and returns a new Collector.
@@ -52,6 +58,11 @@ func New(
 		reportLimit:   250,
 		nozzleAppGUID: nozzleAppGUID,
 		store:         store,
+		logger:        logging.Default(),
+
+		streamMergeTimeout: 10 * time.Second,
+		minStreamBackoff:   time.Second,
+		maxStreamBackoff:   30 * time.Second,
 	}
 
 	for _, o := range opts {
@@ -61,9 +72,16 @@ func New(
 	return c
 }
 
-// BuildPoints satisfies the datadog PointBuilder interface. It will
-// request all the rates from all the known nozzles and sum their counts.
-func (c *Collector) BuildPoints(timestamp int64) ([]datadog.Point, error) {
+// IngressMetric is the name of the Points built for the number of logs
+// produced by an application instance.
+const IngressMetric = "application.ingress"
+
+// BuildPoints satisfies the sink PointBuilder interface. It will request all
+// the rates from all the known nozzles and sum their counts. A Point is built
+// for each of the noisiest application instances, tagged with the app GUID,
+// instance index and, if they can be looked up, the org, space and app names.
+// Rates of federated accumulators are also tagged with their foundation.
+func (c *Collector) BuildPoints(timestamp int64) ([]sink.Point, error) {
 	rate, err := c.Rate(timestamp)
 	if err != nil {
 		return nil, err
@@ -90,27 +108,31 @@ func (c *Collector) BuildPoints(timestamp int64) ([]datadog.Point, error) {
 	// returns the cache when an error occurs.
 	appInfo, _ := c.store.Lookup(guids)
 
-	var ddPoints []datadog.Point
+	points := make([]sink.Point, 0, len(top))
 	for _, c := range top {
 		gi := GUIDIndex(c.guidIndex)
-		tags := []string{
-			fmt.Sprintf("application.instance:%s", gi),
+		tags := map[string]string{
+			sink.TagAppGUID:       gi.GUID(),
+			sink.TagInstanceIndex: gi.Index(),
 		}
-		orgSpaceAppName, ok := appInfo[AppGUID(gi.GUID())]
-		if ok {
-			tags = []string{
-				fmt.Sprintf("application.instance:%s/%s", orgSpaceAppName, gi.Index()),
-			}
+		if f := gi.Foundation(); f != "" {
+			tags[sink.TagFoundation] = f
 		}
-		ddPoints = append(ddPoints, datadog.Point{
-			Metric: "application.ingress",
-			Points: [][]int64{[]int64{rate.Timestamp, int64(c.value)}},
-			Type:   "gauge",
-			Tags:   tags,
+		if info, ok := appInfo[AppGUID(gi.GUID())]; ok {
+			tags[sink.TagOrg] = info.Org
+			tags[sink.TagSpace] = info.Space
+			tags[sink.TagApp] = info.Name
+		}
+
+		points = append(points, sink.Point{
+			Name:      IngressMetric,
+			Timestamp: rate.Timestamp,
+			Value:     float64(c.value),
+			Tags:      tags,
 		})
 	}
 
-	return ddPoints, nil
+	return points, nil
 }
 
 // Rate will collect rates from all the nozzles and sum the totals to produce a
@@ -151,16 +173,69 @@ func (c *Collector) Rate(timestamp int64) (store.Rate, error) {
 	return Sum(result), nil
 }
 
+// Range will collect the rates between start and end from all the nozzles and
+// sum the totals for each timestamp.
+func (c *Collector) Range(start, end int64) ([]store.Rate, error) {
+	token, err := c.auth.RefreshAuthToken()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan rangeResult, len(c.nozzles))
+	defer close(results)
+	for i, n := range c.nozzles {
+		go func(idx int, addr string) {
+			var rates []store.Rate
+			err := c.fetch(fmt.Sprintf("/rates?start=%d&end=%d", start, end), idx, addr, token, &rates)
+			results <- rangeResult{
+				rates: rates,
+				err:   err,
+			}
+		}(i, n)
+	}
+
+	byTimestamp := make(map[int64][]store.Rate)
+	for i := 0; i < len(c.nozzles); i++ {
+		r := <-results
+
+		if r.err != nil {
+			err = r.err
+		}
+
+		for _, rate := range r.rates {
+			byTimestamp[rate.Timestamp] = append(byTimestamp[rate.Timestamp], rate)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]store.Rate, 0, len(byTimestamp))
+	for _, r := range byTimestamp {
+		rates = append(rates, Sum(r))
+	}
+	sort.Sort(store.Rates(rates))
+
+	return rates, nil
+}
+
 func (c *Collector) fetchRate(timestamp int64, index int, addr, token string) (store.Rate, error) {
-	req, err := http.NewRequest(
-		http.MethodGet,
-		fmt.Sprintf("%s/rates/%d", addr, timestamp),
-		nil,
-	)
+	var rate store.Rate
+	err := c.fetch(fmt.Sprintf("/rates/%d", timestamp), index, addr, token, &rate)
 	if err != nil {
 		return store.Rate{}, err
 	}
 
+	return rate, nil
+}
+
+func (c *Collector) fetch(path string, index int, addr, token string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, addr+path, nil)
+	if err != nil {
+		return err
+	}
+
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
 	if c.nozzleAppGUID != "" {
@@ -169,21 +244,15 @@ func (c *Collector) fetchRate(timestamp int64, index int, addr, token string) (s
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return store.Rate{}, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return store.Rate{}, fmt.Errorf("failed to get rates, expected status code 200, got %d", resp.StatusCode)
-	}
-
-	var rate store.Rate
-	err = json.NewDecoder(resp.Body).Decode(&rate)
-	if err != nil {
-		return store.Rate{}, err
+		return fmt.Errorf("failed to get rates, expected status code 200, got %d", resp.StatusCode)
 	}
 
-	return rate, nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
 // CollectorOption is a type of func that can be used for optional configuration
@@ -207,6 +276,33 @@ func WithHTTPClient(client *http.Client) CollectorOption {
 	}
 }
 
+// WithStreamMergeTimeout sets how long the collector will wait for every
+// nozzle to stream a rate for a timestamp before publishing the sum of the
+// rates it has received.
+func WithStreamMergeTimeout(d time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.streamMergeTimeout = d
+	}
+}
+
+// WithStreamBackoff sets the backoff between reconnects to a nozzle's rate
+// stream. The backoff starts at min, doubles with every failed reconnect up
+// to max and is reset once a stream delivered a rate. Defaults to a backoff
+// between 1 and 30 seconds.
+func WithStreamBackoff(min, max time.Duration) CollectorOption {
+	return func(c *Collector) {
+		c.minStreamBackoff = min
+		c.maxStreamBackoff = max
+	}
+}
+
+// WithLogger sets the Logger the collector writes stream failures to.
+func WithLogger(l *logging.Logger) CollectorOption {
+	return func(c *Collector) {
+		c.logger = l
+	}
+}
+
 // Sum will take a slice of Rate and sum all their counts together to create a
 // single Rate.
 func Sum(r []store.Rate) store.Rate {
@@ -230,6 +326,11 @@ type rateResult struct {
 	err  error
 }
 
+type rangeResult struct {
+	rates []store.Rate
+	err   error
+}
+
 type count struct {
 	guidIndex string
 	value     uint64
@@ -3,6 +3,8 @@ package collector_test
 import (
 	"log"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,6 +13,7 @@ import (
 
 func TestCollector(t *testing.T) {
 	log.SetOutput(GinkgoWriter)
+	logging.SetDefault(logging.New(GinkgoWriter, logging.LevelDebug))
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Collector Suite")
 }
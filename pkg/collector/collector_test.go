@@ -5,10 +5,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
-	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 
 	. "github.com/onsi/ginkgo"
@@ -39,26 +40,23 @@ var _ = Describe("Collector", func() {
 			Expect(request.headers.Get("Authorization")).To(Equal("Bearer valid-token"))
 			Expect(request.headers.Get("X-CF-APP-INSTANCE")).To(Equal("app-guid:0"))
 
-			point := findPointWithTag("application.instance:my-org.my-space.my-app/0", points)
+			point := findPoint("app-1", "0", points)
 			Expect(point).ToNot(BeZero())
-			Expect(point.Metric).To(Equal("application.ingress"))
-			Expect(point.Points).To(Equal([][]int64{
-				[]int64{ts1, 1186},
-			}))
+			Expect(point.Name).To(Equal("application.ingress"))
+			Expect(point.Timestamp).To(Equal(ts1))
+			Expect(point.Value).To(Equal(float64(1186)))
 
-			point = findPointWithTag("application.instance:my-org.my-space.my-app/1", points)
+			point = findPoint("app-1", "1", points)
 			Expect(point).ToNot(BeZero())
-			Expect(point.Metric).To(Equal("application.ingress"))
-			Expect(point.Points).To(Equal([][]int64{
-				[]int64{ts1, 966},
-			}))
+			Expect(point.Name).To(Equal("application.ingress"))
+			Expect(point.Timestamp).To(Equal(ts1))
+			Expect(point.Value).To(Equal(float64(966)))
 
-			point = findPointWithTag("application.instance:app-2/0", points)
+			point = findPoint("app-2", "0", points)
 			Expect(point).ToNot(BeZero())
-			Expect(point.Metric).To(Equal("application.ingress"))
-			Expect(point.Points).To(Equal([][]int64{
-				[]int64{ts1, 1234},
-			}))
+			Expect(point.Name).To(Equal("application.ingress"))
+			Expect(point.Timestamp).To(Equal(ts1))
+			Expect(point.Value).To(Equal(float64(1234)))
 		})
 
 		It("sums counts from multiple nozzles", func() {
@@ -85,19 +83,17 @@ var _ = Describe("Collector", func() {
 			Expect(requestsB).To(Receive(&request))
 			Expect(request.headers.Get("X-CF-APP-INSTANCE")).To(Equal("app-guid:1"))
 
-			point := findPointWithTag("application.instance:my-org.my-space.my-app/0", points)
+			point := findPoint("app-1", "0", points)
 			Expect(point).ToNot(BeZero())
-			Expect(point.Metric).To(Equal("application.ingress"))
-			Expect(point.Points).To(Equal([][]int64{
-				[]int64{ts1, 2372},
-			}))
+			Expect(point.Name).To(Equal("application.ingress"))
+			Expect(point.Timestamp).To(Equal(ts1))
+			Expect(point.Value).To(Equal(float64(2372)))
 
-			point = findPointWithTag("application.instance:my-org.my-space.my-app/1", points)
+			point = findPoint("app-1", "1", points)
 			Expect(point).ToNot(BeZero())
-			Expect(point.Metric).To(Equal("application.ingress"))
-			Expect(point.Points).To(Equal([][]int64{
-				[]int64{ts1, 1932},
-			}))
+			Expect(point.Name).To(Equal("application.ingress"))
+			Expect(point.Timestamp).To(Equal(ts1))
+			Expect(point.Value).To(Equal(float64(1932)))
 		})
 
 		It("looks up app info based off of GUID/instance", func() {
@@ -117,30 +113,9 @@ var _ = Describe("Collector", func() {
 			Expect(spyStore.lookupGuids).To(ContainElement("app-1"))
 
 			Expect(points).To(ConsistOf(
-				datadog.Point{
-					Metric: "application.ingress",
-					Points: [][]int64{[]int64{ts1, 1186}},
-					Type:   "gauge",
-					Tags: []string{
-						"application.instance:my-org.my-space.my-app/0",
-					},
-				},
-				datadog.Point{
-					Metric: "application.ingress",
-					Points: [][]int64{[]int64{ts1, 966}},
-					Type:   "gauge",
-					Tags: []string{
-						"application.instance:my-org.my-space.my-app/1",
-					},
-				},
-				datadog.Point{
-					Metric: "application.ingress",
-					Points: [][]int64{[]int64{ts1, 1234}},
-					Type:   "gauge",
-					Tags: []string{
-						"application.instance:app-2/0",
-					},
-				},
+				appPoint(ts1, 1186, "app-1", "0", "my-org", "my-space", "my-app"),
+				appPoint(ts1, 966, "app-1", "1", "my-org", "my-space", "my-app"),
+				appPoint(ts1, 1234, "app-2", "0", "", "", ""),
 			))
 		})
 
@@ -231,32 +206,71 @@ var _ = Describe("Collector", func() {
 			points, err := c.BuildPoints(ts1)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(points).To(ConsistOf(
-				datadog.Point{
-					Metric: "application.ingress",
-					Points: [][]int64{[]int64{ts1, 1186}},
-					Type:   "gauge",
-					Tags: []string{
-						"application.instance:my-org.my-space.my-app/0",
-					},
-				},
-				datadog.Point{
-					Metric: "application.ingress",
-					Points: [][]int64{[]int64{ts1, 966}},
-					Type:   "gauge",
-					Tags: []string{
-						"application.instance:my-org.my-space.my-app/1",
+				appPoint(ts1, 1186, "app-1", "0", "my-org", "my-space", "my-app"),
+				appPoint(ts1, 966, "app-1", "1", "my-org", "my-space", "my-app"),
+				appPoint(ts1, 1234, "app-2", "0", "", "", ""),
+			))
+		})
+	})
+
+	Describe("Range", func() {
+		It("sums the rates for each timestamp from all nozzles", func() {
+			serverA, requestsA := setupRangeTestServer(http.StatusOK)
+			serverB, requestsB := setupRangeTestServer(http.StatusOK)
+			defer serverA.Close()
+			defer serverB.Close()
+
+			c := collector.New(
+				[]string{serverA.URL, serverB.URL},
+				&spyAuthenticator{refreshToken: "valid-token"},
+				"app-guid",
+				newSpyStore(),
+			)
+
+			rates, err := c.Range(60, 120)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rates).To(Equal([]store.Rate{
+				{
+					Timestamp: 60,
+					Counts: map[string]uint64{
+						"app-1/0": 20,
 					},
 				},
-				datadog.Point{
-					Metric: "application.ingress",
-					Points: [][]int64{[]int64{ts1, 1234}},
-					Type:   "gauge",
-					Tags: []string{
-						// GUID Instance only
-						"application.instance:app-2/0",
+				{
+					Timestamp: 120,
+					Counts: map[string]uint64{
+						"app-1/0": 40,
+						"app-2/0": 60,
 					},
 				},
-			))
+			}))
+
+			var request request
+			Expect(requestsA).To(Receive(&request))
+			Expect(request.url.Path).To(Equal("/rates"))
+			Expect(request.url.Query().Get("start")).To(Equal("60"))
+			Expect(request.url.Query().Get("end")).To(Equal("120"))
+			Expect(request.headers.Get("Authorization")).To(Equal("Bearer valid-token"))
+			Expect(request.headers.Get("X-CF-APP-INSTANCE")).To(Equal("app-guid:0"))
+			Expect(requestsB).To(Receive(&request))
+			Expect(request.headers.Get("X-CF-APP-INSTANCE")).To(Equal("app-guid:1"))
+		})
+
+		It("returns an error if any of the nozzles return a non 200 status code", func() {
+			serverA, _ := setupRangeTestServer(http.StatusOK)
+			serverB, _ := setupRangeTestServer(http.StatusInternalServerError)
+			defer serverA.Close()
+			defer serverB.Close()
+
+			c := collector.New(
+				[]string{serverA.URL, serverB.URL},
+				&spyAuthenticator{},
+				"",
+				newSpyStore(),
+			)
+
+			_, err := c.Range(60, 120)
+			Expect(err).To(HaveOccurred())
 		})
 	})
 
@@ -327,20 +341,60 @@ func setupTestServer(ts1 int64, statusCode int) (*httptest.Server, chan request)
 	), requests
 }
 
-func findPointWithTag(tag string, points []datadog.Point) datadog.Point {
-	for _, p := range points {
-		if len(p.Tags) < 1 {
-			continue
-		}
+func setupRangeTestServer(statusCode int) (*httptest.Server, chan request) {
+	requests := make(chan request, 100)
 
-		for _, t := range p.Tags {
-			if t == tag {
-				return p
+	return httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- request{
+				url:     r.URL,
+				headers: r.Header,
 			}
+
+			w.WriteHeader(statusCode)
+			w.Write([]byte(`[
+				{
+					"timestamp": 60,
+					"counts": {"app-1/0": 10}
+				},
+				{
+					"timestamp": 120,
+					"counts": {"app-1/0": 20, "app-2/0": 30}
+				}
+			]`))
+		}),
+	), requests
+}
+
+func findPoint(guid, index string, points []sink.Point) sink.Point {
+	for _, p := range points {
+		if p.Tags[sink.TagAppGUID] == guid && p.Tags[sink.TagInstanceIndex] == index {
+			return p
 		}
 	}
 
-	return datadog.Point{}
+	return sink.Point{}
+}
+
+// appPoint returns the Point expected for an app instance. The org, space and
+// app tags are omitted when org is empty.
+func appPoint(ts int64, value float64, guid, index, org, space, app string) sink.Point {
+	tags := map[string]string{
+		sink.TagAppGUID:       guid,
+		sink.TagInstanceIndex: index,
+	}
+	if org != "" {
+		tags[sink.TagOrg] = org
+		tags[sink.TagSpace] = space
+		tags[sink.TagApp] = app
+	}
+
+	return sink.Point{
+		Name:      "application.ingress",
+		Timestamp: ts,
+		Value:     value,
+		Tags:      tags,
+	}
 }
 
 type spyInfoStore struct {
@@ -366,13 +420,24 @@ func (s *spyInfoStore) Lookup(guids []string) (map[collector.AppGUID]collector.A
 }
 
 type spyAuthenticator struct {
-	refreshCalled bool
-	refreshToken  string
-	refreshError  error
+	mu             sync.Mutex
+	_refreshCalled bool
+	refreshToken   string
+	refreshError   error
 }
 
 func (s *spyAuthenticator) RefreshAuthToken() (string, error) {
-	s.refreshCalled = true
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s._refreshCalled = true
 
 	return s.refreshToken, s.refreshError
 }
+
+func (s *spyAuthenticator) refreshCalled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._refreshCalled
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+)
+
+// DiffOrder is the order the AppDeltas of a Diff are ranked in.
+type DiffOrder string
+
+const (
+	// DiffOrderAbsolute ranks apps by the increase in the number of logs
+	// they produced.
+	DiffOrderAbsolute DiffOrder = "absolute"
+
+	// DiffOrderRelative ranks apps by the increase in the number of logs they
+	// produced relative to the number of logs they produced before. New
+	// producers are ranked first.
+	DiffOrderRelative DiffOrder = "relative"
+)
+
+// ParseDiffOrder returns the DiffOrder for the given string. An empty string
+// is DiffOrderAbsolute.
+func ParseDiffOrder(s string) (DiffOrder, error) {
+	switch DiffOrder(s) {
+	case "", DiffOrderAbsolute:
+		return DiffOrderAbsolute, nil
+	case DiffOrderRelative:
+		return DiffOrderRelative, nil
+	default:
+		return "", fmt.Errorf("unknown diff order %q, expected absolute or relative", s)
+	}
+}
+
+// AppDelta is the change in the number of logs produced by all instances of
+// an app between two windows.
+type AppDelta struct {
+	AppGUID string `json:"app_guid"`
+	Before  uint64 `json:"before"`
+	After   uint64 `json:"after"`
+	Change  int64  `json:"change"`
+
+	// RelativeChange is the change as a fraction of the number of logs
+	// produced before. It is 0 for new producers.
+	RelativeChange float64 `json:"relative_change"`
+
+	// New is true if the app did not produce any logs before.
+	New bool `json:"new"`
+}
+
+// Diff sums the given before and after rates per app and returns the change
+// for every app that produced logs in either window, ranked by the given
+// order.
+func Diff(before, after []store.Rate, order DiffOrder) []AppDelta {
+	beforeCounts := appCounts(Sum(before))
+	afterCounts := appCounts(Sum(after))
+
+	deltas := make([]AppDelta, 0, len(afterCounts))
+	for guid, a := range afterCounts {
+		b := beforeCounts[guid]
+		deltas = append(deltas, newAppDelta(guid, b, a))
+	}
+
+	for guid, b := range beforeCounts {
+		if _, ok := afterCounts[guid]; ok {
+			continue
+		}
+		deltas = append(deltas, newAppDelta(guid, b, 0))
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		a, b := deltas[i], deltas[j]
+		if order == DiffOrderRelative {
+			if a.New != b.New {
+				return a.New
+			}
+
+			if a.RelativeChange != b.RelativeChange {
+				return a.RelativeChange > b.RelativeChange
+			}
+		}
+
+		if a.Change != b.Change {
+			return a.Change > b.Change
+		}
+
+		return a.AppGUID < b.AppGUID
+	})
+
+	return deltas
+}
+
+func newAppDelta(guid string, before, after uint64) AppDelta {
+	d := AppDelta{
+		AppGUID: guid,
+		Before:  before,
+		After:   after,
+		Change:  int64(after) - int64(before),
+		New:     before == 0,
+	}
+
+	if before > 0 {
+		d.RelativeChange = float64(d.Change) / float64(before)
+	}
+
+	return d
+}
+
+// appCounts sums the counts of every instance of each app in the given rate.
+func appCounts(r store.Rate) map[string]uint64 {
+	counts := make(map[string]uint64)
+	for k, v := range r.Counts {
+		counts[GUIDIndex(k).GUID()] += v
+	}
+
+	return counts
+}
@@ -0,0 +1,59 @@
+package collector_test
+
+import (
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	var before, after []store.Rate
+
+	BeforeEach(func() {
+		before = []store.Rate{
+			{Timestamp: 60, Counts: map[string]uint64{"app-1/0": 100, "app-1/1": 100, "app-2/0": 50}},
+			{Timestamp: 120, Counts: map[string]uint64{"app-1/0": 100, "app-3/0": 1000}},
+		}
+		after = []store.Rate{
+			{Timestamp: 1800, Counts: map[string]uint64{"app-1/0": 400, "app-2/0": 150}},
+			{Timestamp: 1860, Counts: map[string]uint64{"app-1/1": 200, "app-4/0": 50}},
+		}
+	})
+
+	It("ranks apps by absolute change", func() {
+		Expect(collector.Diff(before, after, collector.DiffOrderAbsolute)).To(Equal([]collector.AppDelta{
+			{AppGUID: "app-1", Before: 300, After: 600, Change: 300, RelativeChange: 1},
+			{AppGUID: "app-2", Before: 50, After: 150, Change: 100, RelativeChange: 2},
+			{AppGUID: "app-4", Before: 0, After: 50, Change: 50, New: true},
+			{AppGUID: "app-3", Before: 1000, After: 0, Change: -1000, RelativeChange: -1},
+		}))
+	})
+
+	It("ranks new producers first and then apps by relative change", func() {
+		deltas := collector.Diff(before, after, collector.DiffOrderRelative)
+
+		var guids []string
+		for _, d := range deltas {
+			guids = append(guids, d.AppGUID)
+		}
+		Expect(guids).To(Equal([]string{"app-4", "app-2", "app-1", "app-3"}))
+	})
+
+	It("returns no deltas without rates", func() {
+		Expect(collector.Diff(nil, nil, collector.DiffOrderAbsolute)).To(BeEmpty())
+	})
+
+	Describe("ParseDiffOrder", func() {
+		It("defaults to absolute", func() {
+			Expect(collector.ParseDiffOrder("")).To(Equal(collector.DiffOrderAbsolute))
+			Expect(collector.ParseDiffOrder("relative")).To(Equal(collector.DiffOrderRelative))
+		})
+
+		It("returns an error for unknown orders", func() {
+			_, err := collector.ParseDiffOrder("sideways")
+			Expect(err).To(MatchError(`unknown diff order "sideways", expected absolute or relative`))
+		})
+	})
+})
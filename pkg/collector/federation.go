@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+)
+
+// foundationSeparator separates the foundation from the GUID and index in
+// namespaced rate keys.
+const foundationSeparator = ":"
+
+// RateSource provides the rates of a single foundation.
+type RateSource interface {
+	Rate(timestamp int64) (store.Rate, error)
+	Range(start, end int64) ([]store.Rate, error)
+}
+
+// Upstream is an accumulator of another foundation whose rates are
+// federated. Requests to the upstream are authenticated with its own
+// Authenticator.
+type Upstream struct {
+	Foundation string
+	Addr       string
+	Auth       Authenticator
+}
+
+// UpstreamStatus is the availability of a single Upstream.
+type UpstreamStatus struct {
+	Foundation string
+	Addr       string
+
+	// Available is true if the last request to the upstream succeeded.
+	Available bool
+
+	// LastSuccess is the time of the last successful request. It is zero if
+	// no request has succeeded yet.
+	LastSuccess time.Time
+
+	// ConsecutiveFailures is the number of failed requests since the last
+	// successful request and LastError is the error of the last failed
+	// request.
+	ConsecutiveFailures int
+	LastError           string
+}
+
+// Federation sums the rates of the local foundation with the rates of
+// upstream accumulators in other foundations. The keys of every rate are
+// namespaced with the foundation they came from in the format
+// foundation:guid/index. Keys that are already namespaced, e.g. because the
+// upstream is federated itself, are left as they are. Unavailable upstreams
+// are left out of the sum so that the rates of the available foundations
+// are still served.
+type Federation struct {
+	sources []*federatedSource
+	logger  *logging.Logger
+}
+
+type federatedSource struct {
+	foundation string
+	source     RateSource
+	upstream   bool
+
+	mu     sync.Mutex
+	status UpstreamStatus
+}
+
+// NewFederation initializes and returns a new Federation. The local
+// RateSource is namespaced with the given foundation and may be nil if the
+// accumulator has no nozzles of its own. Upstreams are requested with the
+// given HTTP client.
+func NewFederation(
+	foundation string,
+	local RateSource,
+	upstreams []Upstream,
+	client *http.Client,
+	opts ...FederationOption,
+) *Federation {
+	f := &Federation{
+		logger: logging.Default(),
+	}
+	for _, o := range opts {
+		o(f)
+	}
+
+	if local != nil {
+		f.sources = append(f.sources, &federatedSource{
+			foundation: foundation,
+			source:     local,
+		})
+	}
+
+	for _, u := range upstreams {
+		f.sources = append(f.sources, &federatedSource{
+			foundation: u.Foundation,
+			source:     New([]string{u.Addr}, u.Auth, "", nil, WithHTTPClient(client), WithLogger(f.logger)),
+			upstream:   true,
+			status: UpstreamStatus{
+				Foundation: u.Foundation,
+				Addr:       u.Addr,
+			},
+		})
+	}
+
+	return f
+}
+
+// FederationOption is a type of func that can be used for optional
+// configuration settings for the Federation.
+type FederationOption func(*Federation)
+
+// WithFederationLogger sets the Logger failed foundations are written to.
+func WithFederationLogger(l *logging.Logger) FederationOption {
+	return func(f *Federation) {
+		f.logger = l
+	}
+}
+
+// Rate returns the sum of the rates of every available foundation for the
+// given timestamp. An error is only returned if every foundation failed.
+func (f *Federation) Rate(timestamp int64) (store.Rate, error) {
+	results := make([]store.Rate, len(f.sources))
+	errs := f.each(func(i int, s *federatedSource) error {
+		rate, err := s.source.Rate(timestamp)
+		results[i] = Namespace(rate, s.foundation)
+		return err
+	})
+	if err := f.allFailed(errs); err != nil {
+		return store.Rate{}, err
+	}
+
+	var rates []store.Rate
+	for i := range f.sources {
+		if errs[i] == nil {
+			rates = append(rates, results[i])
+		}
+	}
+
+	sum := Sum(rates)
+	sum.Timestamp = timestamp
+
+	return sum, nil
+}
+
+// Range returns the sum of the rates of every available foundation for each
+// timestamp between start and end. An error is only returned if every
+// foundation failed.
+func (f *Federation) Range(start, end int64) ([]store.Rate, error) {
+	results := make([][]store.Rate, len(f.sources))
+	errs := f.each(func(i int, s *federatedSource) error {
+		rates, err := s.source.Range(start, end)
+		for _, r := range rates {
+			results[i] = append(results[i], Namespace(r, s.foundation))
+		}
+		return err
+	})
+	if err := f.allFailed(errs); err != nil {
+		return nil, err
+	}
+
+	byTimestamp := make(map[int64][]store.Rate)
+	for i := range f.sources {
+		if errs[i] != nil {
+			continue
+		}
+
+		for _, r := range results[i] {
+			byTimestamp[r.Timestamp] = append(byTimestamp[r.Timestamp], r)
+		}
+	}
+
+	rates := make([]store.Rate, 0, len(byTimestamp))
+	for _, r := range byTimestamp {
+		rates = append(rates, Sum(r))
+	}
+	sort.Sort(store.Rates(rates))
+
+	return rates, nil
+}
+
+// Status returns the availability of every Upstream in the order they were
+// given.
+func (f *Federation) Status() []UpstreamStatus {
+	var statuses []UpstreamStatus
+	for _, s := range f.sources {
+		if !s.upstream {
+			continue
+		}
+
+		s.mu.Lock()
+		statuses = append(statuses, s.status)
+		s.mu.Unlock()
+	}
+
+	return statuses
+}
+
+// each calls fn for every source concurrently and records the result in the
+// status of upstreams. Failures are logged.
+func (f *Federation) each(fn func(int, *federatedSource) error) []error {
+	errs := make([]error, len(f.sources))
+
+	var wg sync.WaitGroup
+	for i, s := range f.sources {
+		wg.Add(1)
+		go func(i int, s *federatedSource) {
+			defer wg.Done()
+
+			errs[i] = fn(i, s)
+			if errs[i] != nil {
+				f.logger.Error("failed to get rates of foundation", "foundation", s.foundation, "error", errs[i])
+			}
+			s.record(errs[i])
+		}(i, s)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// allFailed returns an error with every failure if every source failed.
+func (f *Federation) allFailed(errs []error) error {
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", f.sources[i].foundation, err))
+		}
+	}
+
+	if len(failed) < len(f.sources) {
+		return nil
+	}
+
+	return fmt.Errorf("failed to get rates of every foundation: %s", strings.Join(failed, ", "))
+}
+
+func (s *federatedSource) record(err error) {
+	if !s.upstream {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.status.Available = false
+		s.status.ConsecutiveFailures++
+		s.status.LastError = err.Error()
+		return
+	}
+
+	s.status.Available = true
+	s.status.LastSuccess = time.Now()
+	s.status.ConsecutiveFailures = 0
+	s.status.LastError = ""
+}
+
+// Namespace returns a copy of the Rate with every key prefixed with the given
+// foundation. Keys that are already namespaced are left as they are, as is
+// the Rate if the foundation is empty.
+func Namespace(r store.Rate, foundation string) store.Rate {
+	if foundation == "" || r.Counts == nil {
+		return r
+	}
+
+	counts := make(map[string]uint64, len(r.Counts))
+	for k, v := range r.Counts {
+		if !strings.Contains(k, foundationSeparator) {
+			k = foundation + foundationSeparator + k
+		}
+		counts[k] += v
+	}
+
+	return store.Rate{
+		Timestamp: r.Timestamp,
+		Counts:    counts,
+	}
+}
@@ -0,0 +1,186 @@
+package collector_test
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Federation", func() {
+	var local *spyRateSource
+
+	BeforeEach(func() {
+		local = &spyRateSource{
+			rate: store.Rate{
+				Timestamp: 120,
+				Counts:    map[string]uint64{"app-1/0": 5, "app-3/0": 7},
+			},
+			rates: []store.Rate{
+				{Timestamp: 120, Counts: map[string]uint64{"app-1/0": 5}},
+			},
+		}
+	})
+
+	Describe("Rate", func() {
+		It("sums the namespaced rates of the local foundation and upstreams", func() {
+			upstream, requests := setupTestServer(120, http.StatusOK)
+			defer upstream.Close()
+
+			f := collector.NewFederation("prod-east", local, []collector.Upstream{
+				{
+					Foundation: "prod-west",
+					Addr:       upstream.URL,
+					Auth:       &spyAuthenticator{refreshToken: "west-token"},
+				},
+			}, http.DefaultClient)
+
+			rate, err := f.Rate(120)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rate).To(Equal(store.Rate{
+				Timestamp: 120,
+				Counts: map[string]uint64{
+					"prod-east:app-1/0": 5,
+					"prod-east:app-3/0": 7,
+					"prod-west:app-1/1": 966,
+					"prod-west:app-1/0": 1186,
+					"prod-west:app-2/0": 1234,
+				},
+			}))
+
+			var r request
+			Expect(requests).To(Receive(&r))
+			Expect(r.url.Path).To(Equal("/rates/120"))
+			Expect(r.headers.Get("Authorization")).To(Equal("Bearer west-token"))
+		})
+
+		It("does not namespace keys of federated upstreams twice", func() {
+			local.rate.Counts = map[string]uint64{"prod-north:app-1/0": 5}
+			f := collector.NewFederation("prod-east", local, nil, http.DefaultClient)
+
+			rate, err := f.Rate(120)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rate.Counts).To(Equal(map[string]uint64{"prod-north:app-1/0": 5}))
+		})
+
+		It("leaves out and reports unavailable upstreams", func() {
+			upstream, _ := setupTestServer(120, http.StatusOK)
+			defer upstream.Close()
+			unavailable, _ := setupTestServer(120, http.StatusInternalServerError)
+			defer unavailable.Close()
+
+			f := collector.NewFederation("", nil, []collector.Upstream{
+				{
+					Foundation: "prod-west",
+					Addr:       upstream.URL,
+					Auth:       &spyAuthenticator{},
+				},
+				{
+					Foundation: "prod-north",
+					Addr:       unavailable.URL,
+					Auth:       &spyAuthenticator{},
+				},
+				{
+					Foundation: "prod-south",
+					Addr:       upstream.URL,
+					Auth:       &spyAuthenticator{refreshError: errors.New("uaa unavailable")},
+				},
+			}, http.DefaultClient)
+
+			rate, err := f.Rate(120)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rate.Counts).To(HaveLen(3))
+			Expect(rate.Counts).To(HaveKey("prod-west:app-2/0"))
+
+			status := f.Status()
+			Expect(status).To(HaveLen(3))
+
+			Expect(status[0].Foundation).To(Equal("prod-west"))
+			Expect(status[0].Addr).To(Equal(upstream.URL))
+			Expect(status[0].Available).To(BeTrue())
+			Expect(status[0].LastSuccess).To(BeTemporally("~", time.Now(), time.Second))
+			Expect(status[0].ConsecutiveFailures).To(BeZero())
+
+			Expect(status[1].Foundation).To(Equal("prod-north"))
+			Expect(status[1].Available).To(BeFalse())
+			Expect(status[1].LastSuccess.IsZero()).To(BeTrue())
+			Expect(status[1].ConsecutiveFailures).To(Equal(1))
+			Expect(status[1].LastError).To(ContainSubstring("got 500"))
+
+			Expect(status[2].Foundation).To(Equal("prod-south"))
+			Expect(status[2].Available).To(BeFalse())
+			Expect(status[2].LastError).To(Equal("uaa unavailable"))
+		})
+
+		It("returns an error when every foundation fails", func() {
+			local.err = errors.New("nozzles unavailable")
+			f := collector.NewFederation("prod-east", local, []collector.Upstream{
+				{
+					Foundation: "prod-west",
+					Addr:       "http://127.0.0.1:1",
+					Auth:       &spyAuthenticator{refreshError: errors.New("uaa unavailable")},
+				},
+			}, http.DefaultClient)
+
+			_, err := f.Rate(120)
+			Expect(err).To(MatchError(
+				"failed to get rates of every foundation: prod-east: nozzles unavailable, prod-west: uaa unavailable",
+			))
+		})
+	})
+
+	Describe("Range", func() {
+		It("sums the namespaced rates for each timestamp", func() {
+			upstream, requests := setupRangeTestServer(http.StatusOK)
+			defer upstream.Close()
+
+			f := collector.NewFederation("prod-east", local, []collector.Upstream{
+				{
+					Foundation: "prod-west",
+					Addr:       upstream.URL,
+					Auth:       &spyAuthenticator{},
+				},
+			}, http.DefaultClient)
+
+			rates, err := f.Range(60, 120)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rates).To(Equal([]store.Rate{
+				{
+					Timestamp: 60,
+					Counts:    map[string]uint64{"prod-west:app-1/0": 10},
+				},
+				{
+					Timestamp: 120,
+					Counts: map[string]uint64{
+						"prod-east:app-1/0": 5,
+						"prod-west:app-1/0": 20,
+						"prod-west:app-2/0": 30,
+					},
+				},
+			}))
+
+			var r request
+			Expect(requests).To(Receive(&r))
+			Expect(r.url.RawQuery).To(Equal("start=60&end=120"))
+		})
+	})
+})
+
+type spyRateSource struct {
+	rate  store.Rate
+	rates []store.Rate
+	err   error
+}
+
+func (s *spyRateSource) Rate(int64) (store.Rate, error) {
+	return s.rate, s.err
+}
+
+func (s *spyRateSource) Range(int64, int64) ([]store.Rate, error) {
+	return s.rates, s.err
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// Foundation is a PointBuilder for the apps of a single CF foundation.
+type Foundation struct {
+	Name    string
+	Builder sink.PointBuilder
+}
+
+// FoundationPointBuilder builds the Points of multiple foundations. Every
+// foundation is built concurrently so that a foundation with an unavailable
+// UAA, CAPI or accumulator does not block or fail the others.
+type FoundationPointBuilder struct {
+	foundations []Foundation
+	logger      *logging.Logger
+}
+
+// NewFoundationPointBuilder initializes and returns a new
+// FoundationPointBuilder.
+func NewFoundationPointBuilder(
+	foundations []Foundation,
+	opts ...FoundationPointBuilderOption,
+) *FoundationPointBuilder {
+	b := &FoundationPointBuilder{
+		foundations: foundations,
+		logger:      logging.Default(),
+	}
+
+	for _, o := range opts {
+		o(b)
+	}
+
+	return b
+}
+
+// FoundationPointBuilderOption is a type of func that can be used for
+// optional configuration settings for the FoundationPointBuilder.
+type FoundationPointBuilderOption func(*FoundationPointBuilder)
+
+// WithFoundationLogger sets the Logger failed foundations are written to.
+func WithFoundationLogger(l *logging.Logger) FoundationPointBuilderOption {
+	return func(b *FoundationPointBuilder) {
+		b.logger = l
+	}
+}
+
+// BuildPoints satisfies the sink PointBuilder interface. The Points of every
+// named foundation are tagged with its name, unless they already have a
+// foundation, and returned in the order the foundations were given.
+// Foundations that fail to build are logged and left out. An error is only
+// returned if every foundation failed.
+func (b *FoundationPointBuilder) BuildPoints(timestamp int64) ([]sink.Point, error) {
+	results := make([][]sink.Point, len(b.foundations))
+	errs := make([]error, len(b.foundations))
+
+	var wg sync.WaitGroup
+	for i, f := range b.foundations {
+		wg.Add(1)
+		go func(i int, f Foundation) {
+			defer wg.Done()
+			results[i], errs[i] = f.Builder.BuildPoints(timestamp)
+		}(i, f)
+	}
+	wg.Wait()
+
+	var (
+		points []sink.Point
+		failed []string
+	)
+	for i, f := range b.foundations {
+		if errs[i] != nil {
+			b.logger.Error("failed to build points for foundation", "foundation", f.Name, "error", errs[i])
+			failed = append(failed, fmt.Sprintf("%s: %s", f.Name, errs[i]))
+			continue
+		}
+
+		for _, p := range results[i] {
+			// Points of federated accumulators already have a foundation.
+			if _, ok := p.Tags[sink.TagFoundation]; !ok && f.Name != "" {
+				tags := make(map[string]string, len(p.Tags)+1)
+				for k, v := range p.Tags {
+					tags[k] = v
+				}
+				tags[sink.TagFoundation] = f.Name
+				p.Tags = tags
+			}
+			points = append(points, p)
+		}
+	}
+
+	if len(b.foundations) > 0 && len(failed) == len(b.foundations) {
+		return nil, fmt.Errorf("failed to build points for every foundation: %s", strings.Join(failed, ", "))
+	}
+
+	return points, nil
+}
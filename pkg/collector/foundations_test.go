@@ -0,0 +1,105 @@
+package collector_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FoundationPointBuilder", func() {
+	It("tags the points of every foundation with its name", func() {
+		east := &spyPointBuilder{points: []sink.Point{
+			appPoint(1234, 10, "app-1", "0", "org", "space", "app"),
+		}}
+		west := &spyPointBuilder{points: []sink.Point{
+			appPoint(1234, 20, "app-2", "1", "", "", ""),
+		}}
+		b := collector.NewFoundationPointBuilder([]collector.Foundation{
+			{Name: "prod-east", Builder: east},
+			{Name: "prod-west", Builder: west},
+		})
+
+		points, err := b.BuildPoints(1234)
+		Expect(err).ToNot(HaveOccurred())
+
+		expectedEast := appPoint(1234, 10, "app-1", "0", "org", "space", "app")
+		expectedEast.Tags[sink.TagFoundation] = "prod-east"
+		expectedWest := appPoint(1234, 20, "app-2", "1", "", "", "")
+		expectedWest.Tags[sink.TagFoundation] = "prod-west"
+		Expect(points).To(Equal([]sink.Point{expectedEast, expectedWest}))
+
+		Expect(east.timestamp).To(Equal(int64(1234)))
+		Expect(east.points[0].Tags).ToNot(HaveKey(sink.TagFoundation))
+	})
+
+	It("does not tag the points of an unnamed foundation", func() {
+		b := collector.NewFoundationPointBuilder([]collector.Foundation{
+			{Builder: &spyPointBuilder{points: []sink.Point{
+				appPoint(1234, 10, "app-1", "0", "", "", ""),
+			}}},
+		})
+
+		points, err := b.BuildPoints(1234)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(points).To(Equal([]sink.Point{
+			appPoint(1234, 10, "app-1", "0", "", "", ""),
+		}))
+	})
+
+	It("leaves out foundations that fail to build", func() {
+		b := collector.NewFoundationPointBuilder([]collector.Foundation{
+			{Name: "prod-east", Builder: &spyPointBuilder{err: errors.New("uaa unavailable")}},
+			{Name: "prod-west", Builder: &spyPointBuilder{points: []sink.Point{
+				appPoint(1234, 20, "app-2", "1", "", "", ""),
+			}}},
+		})
+
+		points, err := b.BuildPoints(1234)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(points).To(HaveLen(1))
+		Expect(points[0].Tags[sink.TagFoundation]).To(Equal("prod-west"))
+	})
+
+	It("builds every foundation concurrently", func() {
+		b := collector.NewFoundationPointBuilder([]collector.Foundation{
+			{Name: "prod-east", Builder: &spyPointBuilder{delay: 200 * time.Millisecond}},
+			{Name: "prod-west", Builder: &spyPointBuilder{delay: 200 * time.Millisecond}},
+		})
+
+		start := time.Now()
+		_, err := b.BuildPoints(1234)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 400*time.Millisecond))
+	})
+
+	It("returns an error when every foundation fails", func() {
+		b := collector.NewFoundationPointBuilder([]collector.Foundation{
+			{Name: "prod-east", Builder: &spyPointBuilder{err: errors.New("uaa unavailable")}},
+			{Name: "prod-west", Builder: &spyPointBuilder{err: errors.New("capi unavailable")}},
+		})
+
+		_, err := b.BuildPoints(1234)
+		Expect(err).To(MatchError(
+			"failed to build points for every foundation: prod-east: uaa unavailable, prod-west: capi unavailable",
+		))
+	})
+})
+
+type spyPointBuilder struct {
+	points    []sink.Point
+	err       error
+	delay     time.Duration
+	timestamp int64
+}
+
+func (s *spyPointBuilder) BuildPoints(timestamp int64) ([]sink.Point, error) {
+	time.Sleep(s.delay)
+	s.timestamp = timestamp
+
+	return s.points, s.err
+}
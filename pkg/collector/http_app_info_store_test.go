@@ -71,7 +71,7 @@ var _ = Describe("HTTPAppInfoStore", func() {
 
 		store.Lookup([]string{"a", "b"})
 
-		Expect(auth.refreshCalled).To(BeTrue())
+		Expect(auth.refreshCalled()).To(BeTrue())
 	})
 
 	It("returns an error when the authenticator fails", func() {
@@ -93,7 +93,7 @@ var _ = Describe("HTTPAppInfoStore", func() {
 
 		Expect(data).To(HaveLen(0))
 		Expect(client.doCalled).To(BeFalse())
-		Expect(auth.refreshCalled).To(BeFalse())
+		Expect(auth.refreshCalled()).To(BeFalse())
 	})
 
 	It("returns an error when getting apps fails", func() {
@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+)
+
+const (
+	maxStreamEventSize   = 16 * 1024 * 1024
+	streamDeadlineTicker = time.Second
+)
+
+// Stream subscribes to the rate stream of every nozzle and publishes the sum
+// of each rate once every nozzle has streamed a rate for the same timestamp.
+// If not every nozzle streams a rate within the stream merge timeout, the sum
+// of the rates received so far is published. This method blocks until the
+// given context is done and every stream is closed, reconnecting to nozzles
+// as needed.
+func (c *Collector) Stream(ctx context.Context, publish func(store.Rate)) {
+	rates := make(chan streamedRate, len(c.nozzles))
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i, n := range c.nozzles {
+		wg.Add(1)
+		go func(i int, n string) {
+			defer wg.Done()
+			c.streamNozzle(ctx, i, n, rates)
+		}(i, n)
+	}
+
+	pending := make(map[int64]*pendingRate)
+	var lastPublished int64
+
+	ticker := time.NewTicker(streamDeadlineTicker)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-rates:
+			if r.rate.Timestamp <= lastPublished {
+				continue
+			}
+
+			p, ok := pending[r.rate.Timestamp]
+			if !ok {
+				p = &pendingRate{
+					deadline: time.Now().Add(c.streamMergeTimeout),
+					nozzles:  make(map[int]store.Rate),
+				}
+				pending[r.rate.Timestamp] = p
+			}
+			p.nozzles[r.index] = r.rate
+
+			if len(p.nozzles) == len(c.nozzles) {
+				publish(p.sum())
+				delete(pending, r.rate.Timestamp)
+				lastPublished = r.rate.Timestamp
+			}
+		case now := <-ticker.C:
+			for ts, p := range pending {
+				if now.Before(p.deadline) {
+					continue
+				}
+
+				c.logger.Warn("publishing partial rate",
+					"timestamp", ts,
+					"received", len(p.nozzles),
+					"nozzles", len(c.nozzles),
+				)
+				publish(p.sum())
+				delete(pending, ts)
+				if ts > lastPublished {
+					lastPublished = ts
+				}
+			}
+		}
+	}
+}
+
+// streamNozzle reads the rate stream of a single nozzle, reconnecting with a
+// backoff whenever the stream closes. The backoff is reset once a stream
+// delivered a rate so that a nozzle that was healthy is reconnected to
+// quickly.
+func (c *Collector) streamNozzle(ctx context.Context, index int, addr string, rates chan<- streamedRate) {
+	backoff := c.minStreamBackoff
+	for {
+		received, err := c.readStream(ctx, index, addr, rates)
+		if ctx.Err() != nil {
+			return
+		}
+		c.logger.Error("rate stream closed", "addr", addr, "index", index, "error", err)
+
+		if received {
+			backoff = c.minStreamBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > c.maxStreamBackoff {
+			backoff = c.maxStreamBackoff
+		}
+	}
+}
+
+// readStream reads rates from the rate stream of a single nozzle until the
+// stream closes. It returns whether any rate was received.
+func (c *Collector) readStream(ctx context.Context, index int, addr string, rates chan<- streamedRate) (bool, error) {
+	token, err := c.auth.RefreshAuthToken()
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, addr+"/rates/stream", nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Accept", "text/event-stream")
+
+	if c.nozzleAppGUID != "" {
+		req.Header.Set("X-CF-APP-INSTANCE", fmt.Sprintf("%s:%d", c.nozzleAppGUID, index))
+	}
+
+	// Streams are long lived so the configured client's timeout can not be
+	// used.
+	client := &http.Client{Transport: c.httpClient.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to stream rates, expected status code 200, got %d", resp.StatusCode)
+	}
+
+	var received bool
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamEventSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var rate store.Rate
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if err := json.Unmarshal([]byte(data), &rate); err != nil {
+			c.logger.Warn("failed to decode streamed rate",
+				"addr", addr,
+				"index", index,
+				"dropped", 1,
+				"error", err,
+			)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return received, ctx.Err()
+		case rates <- streamedRate{
+			index: index,
+			rate:  rate,
+		}:
+			received = true
+		}
+	}
+
+	return received, scanner.Err()
+}
+
+type streamedRate struct {
+	index int
+	rate  store.Rate
+}
+
+type pendingRate struct {
+	deadline time.Time
+	nozzles  map[int]store.Rate
+}
+
+func (p *pendingRate) sum() store.Rate {
+	rates := make([]store.Rate, 0, len(p.nozzles))
+	for _, r := range p.nozzles {
+		rates = append(rates, r)
+	}
+
+	return Sum(rates)
+}
@@ -0,0 +1,172 @@
+package collector_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream", func() {
+	It("publishes the sum of rates streamed by every nozzle", func() {
+		serverA, requestsA := setupStreamServer(60, 120)
+		serverB, requestsB := setupStreamServer(60, 120)
+		defer closeStreamServer(serverA)
+		defer closeStreamServer(serverB)
+
+		c := collector.New(
+			[]string{serverA.URL, serverB.URL},
+			&spyAuthenticator{refreshToken: "valid-token"},
+			"app-guid",
+			nil,
+		)
+
+		rates := make(chan store.Rate, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Stream(ctx, func(r store.Rate) { rates <- r })
+
+		Eventually(rates).Should(Receive(Equal(store.Rate{
+			Timestamp: 60,
+			Counts: map[string]uint64{
+				"app-1/0": 20,
+				"app-2/0": 40,
+			},
+		})))
+		Eventually(rates).Should(Receive(Equal(store.Rate{
+			Timestamp: 120,
+			Counts: map[string]uint64{
+				"app-1/0": 20,
+				"app-2/0": 40,
+			},
+		})))
+
+		var request request
+		Expect(requestsA).To(Receive(&request))
+		Expect(request.url.Path).To(Equal("/rates/stream"))
+		Expect(request.headers.Get("Authorization")).To(Equal("Bearer valid-token"))
+		Expect(request.headers.Get("X-CF-APP-INSTANCE")).To(Equal("app-guid:0"))
+		Expect(requestsB).To(Receive(&request))
+		Expect(request.headers.Get("X-CF-APP-INSTANCE")).To(Equal("app-guid:1"))
+	})
+
+	It("publishes a partial rate when a nozzle does not stream in time", func() {
+		serverA, _ := setupStreamServer(60)
+		serverB, _ := setupStreamServer()
+		defer closeStreamServer(serverA)
+		defer closeStreamServer(serverB)
+
+		c := collector.New(
+			[]string{serverA.URL, serverB.URL},
+			&spyAuthenticator{},
+			"",
+			nil,
+			collector.WithStreamMergeTimeout(10*time.Millisecond),
+		)
+
+		rates := make(chan store.Rate, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Stream(ctx, func(r store.Rate) { rates <- r })
+
+		Eventually(rates, 3).Should(Receive(Equal(store.Rate{
+			Timestamp: 60,
+			Counts: map[string]uint64{
+				"app-1/0": 10,
+				"app-2/0": 20,
+			},
+		})))
+	})
+
+	It("resets the reconnect backoff once a stream delivered a rate", func() {
+		var (
+			mu    sync.Mutex
+			conns int
+		)
+		server := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				conns++
+				ts := conns * 60
+				mu.Unlock()
+
+				// Every stream delivers a single rate and drops.
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, "event: rate\nid: %d\ndata: {\"timestamp\": %d}\n\n", ts, ts)
+			}),
+		)
+		defer closeStreamServer(server)
+
+		c := collector.New([]string{server.URL}, &spyAuthenticator{}, "", nil,
+			collector.WithStreamBackoff(10*time.Millisecond, time.Minute),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go c.Stream(ctx, func(store.Rate) {})
+
+		// Without a reset the tenth reconnect would wait more than 5s.
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return conns
+		}, 2).Should(BeNumerically(">=", 10))
+	})
+
+	It("closes every stream once the context is done", func() {
+		server, requests := setupStreamServer(60)
+		defer closeStreamServer(server)
+
+		c := collector.New([]string{server.URL}, &spyAuthenticator{}, "", nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.Stream(ctx, func(store.Rate) {})
+		}()
+
+		Eventually(requests).Should(Receive())
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+})
+
+func setupStreamServer(timestamps ...int64) (*httptest.Server, chan request) {
+	requests := make(chan request, 100)
+
+	return httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- request{
+				url:     r.URL,
+				headers: r.Header,
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			for _, ts := range timestamps {
+				fmt.Fprintf(w, "event: rate\nid: %d\ndata: %s\n\n", ts, fmt.Sprintf(
+					`{"timestamp": %d, "counts": {"app-1/0": 10, "app-2/0": 20}}`, ts,
+				))
+			}
+			w.(http.Flusher).Flush()
+
+			<-r.Context().Done()
+		}),
+	), requests
+}
+
+func closeStreamServer(s *httptest.Server) {
+	s.CloseClientConnections()
+	s.Close()
+}
@@ -0,0 +1,305 @@
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// eventHistoryLength is the number of rate intervals of history that is
+// kept for every app and included in the text of events.
+const eventHistoryLength = 10
+
+// Event is a Datadog event as accepted by the events API.
+type Event struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	DateHappened   int64    `json:"date_happened"`
+	AlertType      string   `json:"alert_type"`
+	AggregationKey string   `json:"aggregation_key"`
+	SourceTypeName string   `json:"source_type_name"`
+	Host           string   `json:"host,omitempty"`
+	Tags           []string `json:"tags"`
+}
+
+// EventExporter is a sink Exporter that posts Datadog events when an app
+// enters or leaves the top N log producers or its log rate crosses a
+// threshold. It sends events with the HTTP client and settings of an
+// Exporter.
+type EventExporter struct {
+	exporter  *Exporter
+	topN      int
+	threshold uint64
+
+	mu            sync.Mutex
+	initialized   bool
+	lastTimestamp int64
+	top           map[string]bool
+	apps          map[string]*appState
+}
+
+// appState is what is known about an app from previous rate intervals.
+type appState struct {
+	foundation       string
+	org, space, name string
+	history          []appRate
+	aboveThreshold   bool
+}
+
+type appRate struct {
+	timestamp int64
+	count     uint64
+}
+
+// NewEventExporter initializes and returns a new EventExporter that posts
+// events with the given Exporter.
+func NewEventExporter(e *Exporter, opts ...EventExporterOption) *EventExporter {
+	ee := &EventExporter{
+		exporter: e,
+		topN:     10,
+		top:      make(map[string]bool),
+		apps:     make(map[string]*appState),
+	}
+
+	for _, o := range opts {
+		o(ee)
+	}
+
+	return ee
+}
+
+// Export satisfies the sink Exporter interface. The counts of every app
+// instance are summed per app and compared with the previous rate interval.
+// The first rate interval is only used to establish the current state, so no
+// events are posted for it.
+func (ee *EventExporter) Export(ctx context.Context, points []sink.Point) error {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	ts, counts := ee.appCounts(points)
+	if len(points) == 0 || ts <= ee.lastTimestamp {
+		return nil
+	}
+	ee.lastTimestamp = ts
+
+	ee.record(ts, counts)
+	top := topApps(counts, ee.topN)
+
+	var events []Event
+	if ee.initialized {
+		events = ee.events(ts, counts, top)
+	}
+	ee.initialized = true
+	ee.top = top
+
+	for guid, a := range ee.apps {
+		if ee.threshold > 0 {
+			a.aboveThreshold = counts[guid] >= ee.threshold
+		}
+	}
+
+	var firstErr error
+	for _, event := range events {
+		if err := ee.post(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// appCounts returns the timestamp of the given Points and the count of every
+// app. The names of every app are recorded when known.
+func (ee *EventExporter) appCounts(points []sink.Point) (int64, map[string]uint64) {
+	var ts int64
+	counts := make(map[string]uint64)
+	for _, p := range points {
+		guid, ok := p.Tags[sink.TagAppGUID]
+		if !ok {
+			continue
+		}
+
+		if p.Timestamp > ts {
+			ts = p.Timestamp
+		}
+		counts[guid] += uint64(p.Value)
+
+		a, ok := ee.apps[guid]
+		if !ok {
+			a = &appState{}
+			ee.apps[guid] = a
+		}
+		a.foundation = p.Tags[sink.TagFoundation]
+		if name, ok := p.Tags[sink.TagApp]; ok {
+			a.org, a.space, a.name = p.Tags[sink.TagOrg], p.Tags[sink.TagSpace], name
+		}
+	}
+
+	return ts, counts
+}
+
+// record adds the counts to the history of every app. Apps without logs in
+// the whole history are forgotten.
+func (ee *EventExporter) record(ts int64, counts map[string]uint64) {
+	for guid, a := range ee.apps {
+		a.history = append(a.history, appRate{timestamp: ts, count: counts[guid]})
+		if len(a.history) > eventHistoryLength {
+			a.history = a.history[len(a.history)-eventHistoryLength:]
+		}
+
+		var total uint64
+		for _, r := range a.history {
+			total += r.count
+		}
+		if total == 0 && !ee.top[guid] {
+			delete(ee.apps, guid)
+		}
+	}
+}
+
+func (ee *EventExporter) events(ts int64, counts map[string]uint64, top map[string]bool) []Event {
+	var events []Event
+	for _, guid := range sortedGUIDs(ee.apps) {
+		a := ee.apps[guid]
+		count := counts[guid]
+
+		switch {
+		case top[guid] && !ee.top[guid]:
+			events = append(events, ee.event(ts, guid, a, "warning",
+				fmt.Sprintf("%s entered the top %d log producers", a.label(guid), ee.topN),
+			))
+		case !top[guid] && ee.top[guid]:
+			events = append(events, ee.event(ts, guid, a, "info",
+				fmt.Sprintf("%s left the top %d log producers", a.label(guid), ee.topN),
+			))
+		}
+
+		if ee.threshold == 0 {
+			continue
+		}
+
+		switch {
+		case count >= ee.threshold && !a.aboveThreshold:
+			events = append(events, ee.event(ts, guid, a, "error",
+				fmt.Sprintf("%s is above %d logs per interval", a.label(guid), ee.threshold),
+			))
+		case count < ee.threshold && a.aboveThreshold:
+			events = append(events, ee.event(ts, guid, a, "success",
+				fmt.Sprintf("%s is below %d logs per interval", a.label(guid), ee.threshold),
+			))
+		}
+	}
+
+	return events
+}
+
+func (ee *EventExporter) event(ts int64, guid string, a *appState, alertType, title string) Event {
+	var text bytes.Buffer
+	text.WriteString("%%% \nLogs per interval:\n\n")
+	for _, r := range a.history {
+		fmt.Fprintf(&text, "- %s: %d\n", time.Unix(r.timestamp, 0).UTC().Format("15:04"), r.count)
+	}
+	text.WriteString(" \n%%%")
+
+	tags := []string{"app_guid:" + guid}
+	if a.foundation != "" {
+		tags = append(tags, "foundation:"+a.foundation)
+	}
+	if a.name != "" {
+		tags = append(tags, "org:"+a.org, "space:"+a.space, "app:"+a.name)
+	}
+	tags = append(tags, ee.exporter.globalTags...)
+
+	return Event{
+		Title:          title,
+		Text:           text.String(),
+		DateHappened:   ts,
+		AlertType:      alertType,
+		AggregationKey: "noisy-neighbor:" + guid,
+		SourceTypeName: "noisy-neighbor-nozzle",
+		Host:           ee.exporter.host,
+		Tags:           tags,
+	}
+}
+
+func (ee *EventExporter) post(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event for datadog: %s", err)
+	}
+
+	return ee.exporter.send(ctx, ee.exporter.apiURL("/api/v1/events"), body, CompressionNone)
+}
+
+func (a *appState) label(guid string) string {
+	if a.name == "" {
+		return guid
+	}
+
+	return fmt.Sprintf("%s.%s.%s", a.org, a.space, a.name)
+}
+
+// topApps returns the n apps with the highest counts. Ties are broken by app
+// GUID so that the top apps are stable.
+func topApps(counts map[string]uint64, n int) map[string]bool {
+	guids := make([]string, 0, len(counts))
+	for guid, c := range counts {
+		if c > 0 {
+			guids = append(guids, guid)
+		}
+	}
+	sort.Slice(guids, func(i, j int) bool {
+		if counts[guids[i]] != counts[guids[j]] {
+			return counts[guids[i]] > counts[guids[j]]
+		}
+		return guids[i] < guids[j]
+	})
+
+	if len(guids) > n {
+		guids = guids[:n]
+	}
+
+	top := make(map[string]bool, len(guids))
+	for _, guid := range guids {
+		top[guid] = true
+	}
+
+	return top
+}
+
+func sortedGUIDs(apps map[string]*appState) []string {
+	guids := make([]string, 0, len(apps))
+	for guid := range apps {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+
+	return guids
+}
+
+// EventExporterOption is a func that is used to configure optional settings
+// on an EventExporter.
+type EventExporterOption func(*EventExporter)
+
+// WithTopN returns an EventExporterOption for configuring the number of top
+// log producers that apps are compared against. Defaults to 10.
+func WithTopN(n int) EventExporterOption {
+	return func(ee *EventExporter) {
+		ee.topN = n
+	}
+}
+
+// WithThreshold returns an EventExporterOption for configuring the number of
+// logs per rate interval above which an event is posted for an app. A
+// threshold of 0, the default, disables these events.
+func WithThreshold(threshold uint64) EventExporterOption {
+	return func(ee *EventExporter) {
+		ee.threshold = threshold
+	}
+}
@@ -0,0 +1,125 @@
+package datadog_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EventExporter", func() {
+	var (
+		httpClient *spyHTTPClient
+		exporter   *datadog.EventExporter
+	)
+
+	BeforeEach(func() {
+		httpClient = &spyHTTPClient{}
+		exporter = datadog.NewEventExporter(
+			datadog.NewExporter("api-key",
+				datadog.WithHTTPClient(httpClient),
+				datadog.WithHost("abcdefg"),
+				datadog.WithSite("datadoghq.eu"),
+			),
+			datadog.WithTopN(2),
+			datadog.WithThreshold(1000),
+		)
+	})
+
+	events := func() []datadog.Event {
+		var events []datadog.Event
+		for _, r := range httpClient.requests() {
+			Expect(r.url).To(Equal("https://api.datadoghq.eu/api/v1/events"))
+			Expect(r.apiKey).To(Equal("api-key"))
+
+			var e datadog.Event
+			Expect(json.Unmarshal([]byte(r.body), &e)).To(Succeed())
+			events = append(events, e)
+		}
+		return events
+	}
+
+	It("does not post events for the first rate interval", func() {
+		Expect(exporter.Export(context.Background(), appPoints(60, 5000, 100, 10))).To(Succeed())
+
+		Expect(httpClient.requests()).To(BeEmpty())
+	})
+
+	It("posts events when apps enter and leave the top N", func() {
+		Expect(exporter.Export(context.Background(), appPoints(60, 300, 200, 100))).To(Succeed())
+		Expect(exporter.Export(context.Background(), appPoints(120, 300, 100, 200))).To(Succeed())
+
+		Expect(events()).To(Equal([]datadog.Event{
+			{
+				Title:          "org.space.app-1 left the top 2 log producers",
+				Text:           "%%% \nLogs per interval:\n\n- 00:01: 200\n- 00:02: 100\n \n%%%",
+				DateHappened:   120,
+				AlertType:      "info",
+				AggregationKey: "noisy-neighbor:guid-1",
+				SourceTypeName: "noisy-neighbor-nozzle",
+				Host:           "abcdefg",
+				Tags:           []string{"app_guid:guid-1", "org:org", "space:space", "app:app-1"},
+			},
+			{
+				Title:          "org.space.app-2 entered the top 2 log producers",
+				Text:           "%%% \nLogs per interval:\n\n- 00:01: 100\n- 00:02: 200\n \n%%%",
+				DateHappened:   120,
+				AlertType:      "warning",
+				AggregationKey: "noisy-neighbor:guid-2",
+				SourceTypeName: "noisy-neighbor-nozzle",
+				Host:           "abcdefg",
+				Tags:           []string{"app_guid:guid-2", "org:org", "space:space", "app:app-2"},
+			},
+		}))
+	})
+
+	It("posts events when apps cross the threshold", func() {
+		Expect(exporter.Export(context.Background(), appPoints(60, 300, 200))).To(Succeed())
+		Expect(exporter.Export(context.Background(), appPoints(120, 1500, 200))).To(Succeed())
+		Expect(exporter.Export(context.Background(), appPoints(180, 1200, 200))).To(Succeed())
+		Expect(exporter.Export(context.Background(), appPoints(240, 300, 200))).To(Succeed())
+
+		e := events()
+		Expect(e).To(HaveLen(2))
+		Expect(e[0].Title).To(Equal("org.space.app-0 is above 1000 logs per interval"))
+		Expect(e[0].AlertType).To(Equal("error"))
+		Expect(e[0].DateHappened).To(Equal(int64(120)))
+		Expect(e[1].Title).To(Equal("org.space.app-0 is below 1000 logs per interval"))
+		Expect(e[1].AlertType).To(Equal("success"))
+		Expect(e[1].Text).To(ContainSubstring("- 00:02: 1500\n- 00:03: 1200\n- 00:04: 300\n"))
+	})
+
+	It("only evaluates every rate interval once", func() {
+		Expect(exporter.Export(context.Background(), appPoints(60, 300, 200, 100))).To(Succeed())
+		Expect(exporter.Export(context.Background(), appPoints(120, 300, 100, 200))).To(Succeed())
+		Expect(exporter.Export(context.Background(), appPoints(120, 300, 100, 200))).To(Succeed())
+
+		Expect(httpClient.requests()).To(HaveLen(2))
+	})
+})
+
+// appPoints returns a Point for a single instance of an app with each of the
+// given counts.
+func appPoints(ts int64, counts ...float64) []sink.Point {
+	var points []sink.Point
+	for i, c := range counts {
+		points = append(points, sink.Point{
+			Name:      "application.ingress",
+			Timestamp: ts,
+			Value:     c,
+			Tags: map[string]string{
+				sink.TagAppGUID:       fmt.Sprintf("guid-%d", i),
+				sink.TagInstanceIndex: "0",
+				sink.TagOrg:           "org",
+				sink.TagSpace:         "space",
+				sink.TagApp:           fmt.Sprintf("app-%d", i),
+			},
+		})
+	}
+
+	return points
+}
@@ -0,0 +1,721 @@
+package datadog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// DefaultSite is the Datadog site metrics are sent to by default.
+const DefaultSite = "datadoghq.com"
+
+// Versions of the Datadog series API.
+const (
+	APIVersionV1 = "v1"
+	APIVersionV2 = "v2"
+)
+
+// HeartbeatMetric is the name of the metric the Exporter reports on every
+// export when the heartbeat is enabled.
+const HeartbeatMetric = "reporter.heartbeat"
+
+// gaugeTypeV2 is the metric type of gauges in the v2 series API.
+const gaugeTypeV2 = 3
+
+// appAggregateSuffix is appended to the metric name of per app aggregates.
+const appAggregateSuffix = ".app"
+
+// Compression algorithms that can be used for request bodies.
+const (
+	CompressionNone    = "none"
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+)
+
+// DefaultMaxPayloadSize is the maximum size of a request body before
+// compression. It is kept below the 3.2 MB payload limit of the Datadog
+// series API so that a batch is within the limit even if it does not
+// compress.
+const DefaultMaxPayloadSize = 3000000
+
+// Exporter is a sink Exporter that sends Points to Datadog. Points are
+// queued and sent in batches. Batches that fail with a retryable error are
+// retried with exponential backoff and are kept in the queue if they could
+// not be sent before the export timed out, so they can be sent with the next
+// export.
+type Exporter struct {
+	apiKey         string
+	host           string
+	site           string
+	endpoint       string
+	apiVersion     string
+	units          map[string]string
+	metricPrefix   string
+	metric         string
+	globalTags     []string
+	legacyTag      bool
+	appAggregates  bool
+	heartbeat      bool
+	httpClient     HTTPClient
+	compression    string
+	maxPayloadSize int
+	queueSize      int
+	maxAttempts    int
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	clock          clock.Clock
+
+	mu      sync.Mutex
+	queue   *queue
+	dropped int
+}
+
+// NewExporter initializes and returns a new Exporter.
+func NewExporter(apiKey string, opts ...ExporterOption) *Exporter {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+		},
+	}
+
+	e := &Exporter{
+		apiKey:         apiKey,
+		httpClient:     httpClient,
+		site:           DefaultSite,
+		apiVersion:     APIVersionV1,
+		units:          map[string]string{"application.ingress": "event"},
+		legacyTag:      true,
+		compression:    CompressionGzip,
+		maxPayloadSize: DefaultMaxPayloadSize,
+		queueSize:      10000,
+		maxAttempts:    5,
+		minBackoff:     time.Second,
+		maxBackoff:     30 * time.Second,
+		clock:          clock.New(),
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	e.queue = newQueue(e.queueSize)
+
+	return e
+}
+
+// Export satisfies the sink Exporter interface. It adds the given Points to
+// the queue as gauges and sends every queued series to Datadog, oldest
+// first. The heartbeat is sent on its own before the queued series.
+func (e *Exporter) Export(ctx context.Context, points []sink.Point) error {
+	var heartbeatErr error
+	if e.heartbeat {
+		heartbeatErr = e.sendHeartbeat(ctx)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, p := range points {
+		if err := e.enqueue(p, e.metricName(p)); err != nil {
+			return err
+		}
+	}
+
+	if e.appAggregates {
+		for _, p := range appAggregates(points) {
+			if err := e.enqueue(p, e.metricName(p)+appAggregateSuffix); err != nil {
+				return err
+			}
+		}
+	}
+
+	var permanentErr error
+	for e.queue.len() > 0 {
+		n, body := e.queue.batch(e.maxPayloadSize)
+
+		err := e.send(ctx, e.seriesURL(), body, e.compression)
+		if _, ok := err.(permanentError); ok {
+			// The batch will never be accepted so it is dropped instead of
+			// blocking the queue.
+			e.queue.pop(n)
+			permanentErr = err
+			continue
+		}
+		if err != nil {
+			dropped := e.dropped
+			e.dropped = 0
+
+			return fmt.Errorf(
+				"%s, %d series queued, %d dropped",
+				err,
+				e.queue.len(),
+				dropped,
+			)
+		}
+
+		e.queue.pop(n)
+	}
+	e.dropped = 0
+
+	if permanentErr != nil {
+		return permanentErr
+	}
+
+	return heartbeatErr
+}
+
+// sendHeartbeat sends the heartbeat gauge, timestamped with the current
+// time. It is not queued or retried: a heartbeat is only useful when it is
+// sent on time, and the next export sends a new one.
+func (e *Exporter) sendHeartbeat(ctx context.Context) error {
+	p := sink.Point{
+		Name:      HeartbeatMetric,
+		Timestamp: e.clock.Now().Unix(),
+		Value:     1,
+	}
+	data, err := e.encode(p, e.metricName(p))
+	if err != nil {
+		return err
+	}
+
+	body := make([]byte, 0, len(seriesPrefix)+len(data)+len(seriesSuffix))
+	body = append(body, seriesPrefix...)
+	body = append(body, data...)
+	body = append(body, seriesSuffix...)
+
+	compressed, err := compress(body, e.compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress request body for datadog: %s", err)
+	}
+
+	if _, err := e.post(ctx, e.seriesURL(), compressed, e.compression); err != nil {
+		return fmt.Errorf("failed to send heartbeat: %s", err)
+	}
+
+	return nil
+}
+
+// send posts the given body to the given Datadog URL, compressed with the
+// given compression. Requests that fail with a network
+// error, a 5XX or a 429 are retried with exponential backoff until the max
+// attempts are reached or the context is done. A Retry-After header is used
+// instead of the backoff when present.
+func (e *Exporter) send(ctx context.Context, url string, body []byte, compression string) error {
+	compressed, err := compress(body, compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress request body for datadog: %s", err)
+	}
+
+	backoff := e.minBackoff
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := e.post(ctx, url, compressed, compression)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(permanentError); ok || attempt >= e.maxAttempts {
+			return err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		backoff *= 2
+		if backoff > e.maxBackoff {
+			backoff = e.maxBackoff
+		}
+
+		timer := e.clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C():
+		}
+	}
+}
+
+// post sends a single request to Datadog. It returns how long Datadog asked
+// to wait before retrying, if at all.
+func (e *Exporter) post(ctx context.Context, url string, body []byte, compression string) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, permanentError{fmt.Errorf("failed to build request to datadog: %s", err)}
+	}
+	req.Header.Set("DD-API-KEY", e.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if compression != CompressionNone {
+		req.Header.Set("Content-Encoding", compression)
+	}
+
+	response, err := e.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to post to datadog: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode > 299 || response.StatusCode < 200 {
+		respBody, _ := ioutil.ReadAll(response.Body)
+
+		err := fmt.Errorf(
+			"expected successful status code from Datadog, got %d: %s",
+			response.StatusCode,
+			respBody,
+		)
+		if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 {
+			return 0, permanentError{err}
+		}
+
+		return retryAfter(response.Header.Get("Retry-After")), err
+	}
+
+	return 0, nil
+}
+
+// seriesURL returns the URL of the series API.
+func (e *Exporter) seriesURL() string {
+	return e.apiURL(fmt.Sprintf("/api/%s/series", e.apiVersion))
+}
+
+// apiURL returns the URL of the given API path. The endpoint is used when it
+// is configured, otherwise the API of the configured site.
+func (e *Exporter) apiURL(path string) string {
+	base := e.endpoint
+	if base == "" {
+		base = "https://api." + e.site
+	}
+
+	return strings.TrimRight(base, "/") + path
+}
+
+// enqueue adds the given Point to the queue as a series with the given
+// metric name.
+func (e *Exporter) enqueue(p sink.Point, metric string) error {
+	data, err := e.encode(p, metric)
+	if err != nil {
+		return err
+	}
+	e.dropped += e.queue.push(data)
+
+	return nil
+}
+
+// encode returns the given Point as a JSON encoded series with the given
+// metric name.
+func (e *Exporter) encode(p sink.Point, metric string) ([]byte, error) {
+	var series interface{} = e.toPoint(p, metric)
+	if e.apiVersion == APIVersionV2 {
+		series = e.toSeriesV2(p, metric)
+	}
+
+	data, err := json.Marshal(series)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal point for datadog: %s", err)
+	}
+
+	return data, nil
+}
+
+// metricName returns the name of the metric for the given Point. The
+// configured metric name replaces the name of Points for applications and
+// the prefix is prepended to every name.
+func (e *Exporter) metricName(p sink.Point) string {
+	name := p.Name
+	if _, ok := p.Tags[sink.TagAppGUID]; ok && e.metric != "" {
+		name = e.metric
+	}
+
+	return e.metricPrefix + name
+}
+
+func (e *Exporter) toPoint(p sink.Point, metric string) Point {
+	return Point{
+		Metric: metric,
+		Points: [][]int64{[]int64{p.Timestamp, int64(p.Value)}},
+		Type:   "gauge",
+		Host:   e.host,
+		Tags:   e.tags(p),
+	}
+}
+
+func (e *Exporter) toSeriesV2(p sink.Point, metric string) SeriesV2 {
+	s := SeriesV2{
+		Metric: metric,
+		Type:   gaugeTypeV2,
+		Points: []PointV2{{Timestamp: p.Timestamp, Value: p.Value}},
+		Tags:   e.tags(p),
+		Unit:   e.units[p.Name],
+	}
+	if e.host != "" {
+		s.Resources = []Resource{{Name: e.host, Type: "host"}}
+	}
+
+	return s
+}
+
+// pointTags are the Point tags that are sent as Datadog tags, in order.
+var pointTags = []string{
+	sink.TagFoundation,
+	sink.TagOrg,
+	sink.TagSpace,
+	sink.TagApp,
+	sink.TagAppGUID,
+	sink.TagInstanceIndex,
+}
+
+// tags returns the Datadog tags for the given Point: a tag for each of its
+// foundation, org, space, app, app GUID and instance index, followed by the
+// global tags.
+// Unless disabled, points for application instances are also tagged with
+// application.instance:<org>.<space>.<app>/<index> or
+// application.instance:<app-guid>/<index> if the names are unknown.
+func (e *Exporter) tags(p sink.Point) []string {
+	t := make([]string, 0, len(pointTags)+len(e.globalTags)+1)
+	if e.legacyTag {
+		if lt, ok := legacyTag(p); ok {
+			t = append(t, lt)
+		}
+	}
+
+	for _, k := range pointTags {
+		if v, ok := p.Tags[k]; ok {
+			t = append(t, k+":"+v)
+		}
+	}
+
+	return append(t, e.globalTags...)
+}
+
+func legacyTag(p sink.Point) (string, bool) {
+	guid, ok := p.Tags[sink.TagAppGUID]
+	if !ok {
+		return "", false
+	}
+	index, ok := p.Tags[sink.TagInstanceIndex]
+	if !ok {
+		return "", false
+	}
+
+	name := guid
+	if app, ok := p.Tags[sink.TagApp]; ok {
+		name = fmt.Sprintf("%s.%s.%s", p.Tags[sink.TagOrg], p.Tags[sink.TagSpace], app)
+	}
+
+	return fmt.Sprintf("application.instance:%s/%s", name, index), true
+}
+
+// appAggregates returns a Point per app and timestamp with the sum of the
+// values of every instance of the app. The aggregates have the tags of the
+// instances except for the instance index.
+func appAggregates(points []sink.Point) []sink.Point {
+	type key struct {
+		name       string
+		ts         int64
+		foundation string
+		guid       string
+	}
+
+	var keys []key
+	aggregates := make(map[key]*sink.Point)
+	for _, p := range points {
+		guid, ok := p.Tags[sink.TagAppGUID]
+		if !ok {
+			continue
+		}
+
+		k := key{
+			name:       p.Name,
+			ts:         p.Timestamp,
+			foundation: p.Tags[sink.TagFoundation],
+			guid:       guid,
+		}
+		a, ok := aggregates[k]
+		if !ok {
+			tags := make(map[string]string, len(p.Tags))
+			for tk, tv := range p.Tags {
+				if tk != sink.TagInstanceIndex {
+					tags[tk] = tv
+				}
+			}
+
+			a = &sink.Point{Name: p.Name, Timestamp: p.Timestamp, Tags: tags}
+			aggregates[k] = a
+			keys = append(keys, k)
+		}
+		a.Value += p.Value
+	}
+
+	res := make([]sink.Point, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, *aggregates[k])
+	}
+
+	return res
+}
+
+// retryAfter parses the value of a Retry-After header, either a number of
+// seconds or an HTTP date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+func compress(body []byte, compression string) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch compression {
+	case CompressionNone:
+		return body, nil
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionDeflate:
+		// The deflate content encoding is the zlib format.
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// permanentError is an error that will not succeed when retried.
+type permanentError struct {
+	error
+}
+
+// ExporterOption is a func that is used to configure optional settings on an
+// Exporter.
+type ExporterOption func(*Exporter)
+
+// WithHost is an ExporterOption for configuring the host that is applied to
+// all metrics.
+func WithHost(host string) ExporterOption {
+	return func(e *Exporter) {
+		e.host = host
+	}
+}
+
+// WithSite returns an ExporterOption for configuring the Datadog site
+// metrics are sent to, e.g. datadoghq.eu. An empty site is ignored. Defaults
+// to DefaultSite.
+func WithSite(site string) ExporterOption {
+	return func(e *Exporter) {
+		if site != "" {
+			e.site = site
+		}
+	}
+}
+
+// WithEndpoint returns an ExporterOption for configuring the base URL of the
+// Datadog API, e.g. of a proxy. It takes precedence over the site.
+func WithEndpoint(endpoint string) ExporterOption {
+	return func(e *Exporter) {
+		e.endpoint = endpoint
+	}
+}
+
+// WithAPIVersion returns an ExporterOption for configuring the version of
+// the series API, either APIVersionV1 or APIVersionV2. Defaults to
+// APIVersionV1.
+func WithAPIVersion(version string) ExporterOption {
+	return func(e *Exporter) {
+		e.apiVersion = version
+	}
+}
+
+// WithUnits returns an ExporterOption for configuring the unit of each
+// metric by name. Units are only sent with the v2 series API. Defaults to
+// event for application.ingress.
+func WithUnits(units map[string]string) ExporterOption {
+	return func(e *Exporter) {
+		e.units = units
+	}
+}
+
+// WithMetricPrefix returns an ExporterOption for configuring a prefix that
+// is prepended to every metric name, e.g. "cf." for cf.application.ingress.
+func WithMetricPrefix(prefix string) ExporterOption {
+	return func(e *Exporter) {
+		e.metricPrefix = prefix
+	}
+}
+
+// WithMetricName returns an ExporterOption for configuring the name of the
+// metric reported for applications. Defaults to the name of the Points.
+func WithMetricName(name string) ExporterOption {
+	return func(e *Exporter) {
+		e.metric = name
+	}
+}
+
+// WithTags returns an ExporterOption for configuring static tags that are
+// added to every series and event, e.g. foundation:prod-east.
+func WithTags(tags []string) ExporterOption {
+	return func(e *Exporter) {
+		e.globalTags = tags
+	}
+}
+
+// WithLegacyTag returns an ExporterOption for configuring if series for
+// application instances have the application.instance tag. Defaults to
+// true.
+func WithLegacyTag(enabled bool) ExporterOption {
+	return func(e *Exporter) {
+		e.legacyTag = enabled
+	}
+}
+
+// WithAppAggregates returns an ExporterOption for enabling a series per app
+// with the sum of all its instances in addition to the series per instance.
+// The aggregate series have the metric name with a ".app" suffix.
+func WithAppAggregates(enabled bool) ExporterOption {
+	return func(e *Exporter) {
+		e.appAggregates = enabled
+	}
+}
+
+// WithHeartbeat returns an ExporterOption for enabling a reporter.heartbeat
+// gauge with the value 1 that is reported on every export, so that a
+// reporter that stopped reporting can be detected.
+func WithHeartbeat(enabled bool) ExporterOption {
+	return func(e *Exporter) {
+		e.heartbeat = enabled
+	}
+}
+
+// WithClock returns an ExporterOption for configuring the Clock that is used
+// to timestamp the heartbeat and to wait between attempts. Defaults to the
+// real time.
+func WithClock(c clock.Clock) ExporterOption {
+	return func(e *Exporter) {
+		e.clock = c
+	}
+}
+
+// WithHTTPClient returns an ExporterOption for configuring the HTTPClient to
+// be used for sending metrics via HTTP to Datadog.
+func WithHTTPClient(c HTTPClient) ExporterOption {
+	return func(e *Exporter) {
+		e.httpClient = c
+	}
+}
+
+// WithCompression returns an ExporterOption for configuring how request
+// bodies are compressed, one of CompressionGzip, CompressionDeflate or
+// CompressionNone. Defaults to CompressionGzip.
+func WithCompression(compression string) ExporterOption {
+	return func(e *Exporter) {
+		e.compression = compression
+	}
+}
+
+// WithMaxPayloadSize returns an ExporterOption for configuring the maximum
+// size of a request body before compression. Defaults to
+// DefaultMaxPayloadSize.
+func WithMaxPayloadSize(size int) ExporterOption {
+	return func(e *Exporter) {
+		e.maxPayloadSize = size
+	}
+}
+
+// WithQueueSize returns an ExporterOption for configuring the maximum number
+// of series that are queued while Datadog is unavailable. Once the queue is
+// full the oldest series are dropped. Non-positive sizes are ignored.
+// Defaults to 10000.
+func WithQueueSize(size int) ExporterOption {
+	return func(e *Exporter) {
+		if size > 0 {
+			e.queueSize = size
+		}
+	}
+}
+
+// WithRetry returns an ExporterOption for configuring how often a batch is
+// attempted and the backoff between attempts. The backoff starts at min and
+// doubles with every attempt up to max. Non-positive values are ignored.
+// Defaults to 5 attempts with a backoff between 1 and 30 seconds.
+func WithRetry(maxAttempts int, min, max time.Duration) ExporterOption {
+	return func(e *Exporter) {
+		if maxAttempts > 0 {
+			e.maxAttempts = maxAttempts
+		}
+		if min > 0 {
+			e.minBackoff = min
+		}
+		if max > 0 {
+			e.maxBackoff = max
+		}
+	}
+}
+
+// SeriesV2 is a single metric in the v2 series API.
+type SeriesV2 struct {
+	Metric    string     `json:"metric"`
+	Type      int        `json:"type"`
+	Points    []PointV2  `json:"points"`
+	Resources []Resource `json:"resources,omitempty"`
+	Tags      []string   `json:"tags"`
+	Unit      string     `json:"unit,omitempty"`
+}
+
+// PointV2 is a single value of a SeriesV2.
+type PointV2 struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Resource is a resource a SeriesV2 is reported for.
+type Resource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Point represents a single metric.
+type Point struct {
+	Metric string    `json:"metric"`
+	Points [][]int64 `json:"points"`
+	Type   string    `json:"type"`
+	Host   string    `json:"host"`
+	Tags   []string  `json:"tags"`
+}
+
+// HTTPClient is the interface used for sending HTTP requests to Datadog.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
@@ -0,0 +1,594 @@
+package datadog_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock/clocktest"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var points = []sink.Point{
+		{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     4321,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "app-id",
+				sink.TagInstanceIndex: "2",
+			},
+		},
+		{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     4321,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "app-id",
+				sink.TagInstanceIndex: "1",
+				sink.TagOrg:           "org",
+				sink.TagSpace:         "space",
+				sink.TagApp:           "app",
+			},
+		},
+	}
+
+	It("sends gzipped points to datadog", func() {
+		httpClient := &spyHTTPClient{}
+
+		exporter := datadog.NewExporter(
+			"api-key",
+			datadog.WithHost("abcdefg"),
+			datadog.WithHTTPClient(httpClient),
+		)
+
+		err := exporter.Export(context.Background(), points)
+		Expect(err).ToNot(HaveOccurred())
+
+		reqs := httpClient.requests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].method).To(Equal(http.MethodPost))
+		Expect(reqs[0].url).To(Equal("https://api.datadoghq.com/api/v1/series"))
+		Expect(reqs[0].apiKey).To(Equal("api-key"))
+		Expect(reqs[0].contentType).To(Equal("application/json"))
+		Expect(reqs[0].contentEncoding).To(Equal("gzip"))
+		Expect(reqs[0].body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "application.ingress",
+					"points": [[1234, 4321]],
+					"type": "gauge",
+					"host": "abcdefg",
+					"tags": [
+						"application.instance:app-id/2",
+						"app_guid:app-id",
+						"instance_index:2"
+					]
+				},
+				{
+					"metric": "application.ingress",
+					"points": [[1234, 4321]],
+					"type": "gauge",
+					"host": "abcdefg",
+					"tags": [
+						"application.instance:org.space.app/1",
+						"org:org",
+						"space:space",
+						"app:app",
+						"app_guid:app-id",
+						"instance_index:1"
+					]
+				}
+			]
+		}`))
+	})
+
+	It("sends points to the configured site", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithSite("datadoghq.eu"),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+		Expect(httpClient.requests()[0].url).To(Equal("https://api.datadoghq.eu/api/v1/series"))
+	})
+
+	It("ignores an empty site", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithSite(""),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+		Expect(httpClient.requests()[0].url).To(Equal("https://api.datadoghq.com/api/v1/series"))
+	})
+
+	It("sends points to the configured endpoint", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithSite("datadoghq.eu"),
+			datadog.WithEndpoint("https://proxy.example.com/datadog/"),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+		Expect(httpClient.requests()[0].url).To(Equal("https://proxy.example.com/datadog/api/v1/series"))
+	})
+
+	It("sends points with the v2 series API", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithHost("abcdefg"),
+			datadog.WithAPIVersion(datadog.APIVersionV2),
+		)
+
+		Expect(exporter.Export(context.Background(), points[1:])).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(reqs[0].url).To(Equal("https://api.datadoghq.com/api/v2/series"))
+		Expect(reqs[0].apiKey).To(Equal("api-key"))
+		Expect(reqs[0].body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "application.ingress",
+					"type": 3,
+					"points": [{"timestamp": 1234, "value": 4321}],
+					"resources": [{"name": "abcdefg", "type": "host"}],
+					"tags": [
+						"application.instance:org.space.app/1",
+						"org:org",
+						"space:space",
+						"app:app",
+						"app_guid:app-id",
+						"instance_index:1"
+					],
+					"unit": "event"
+				}
+			]
+		}`))
+	})
+
+	It("applies the metric prefix, metric name and global tags", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithMetricPrefix("cf."),
+			datadog.WithMetricName("app.logs"),
+			datadog.WithTags([]string{"foundation:prod-east"}),
+			datadog.WithLegacyTag(false),
+		)
+
+		Expect(exporter.Export(context.Background(), points[:1])).To(Succeed())
+
+		Expect(httpClient.requests()[0].body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "cf.app.logs",
+					"points": [[1234, 4321]],
+					"type": "gauge",
+					"host": "",
+					"tags": [
+						"app_guid:app-id",
+						"instance_index:2",
+						"foundation:prod-east"
+					]
+				}
+			]
+		}`))
+	})
+
+	It("tags series with their foundation", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithLegacyTag(false),
+		)
+
+		Expect(exporter.Export(context.Background(), []sink.Point{
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     10,
+				Tags: map[string]string{
+					sink.TagFoundation:    "prod-east",
+					sink.TagAppGUID:       "app-id",
+					sink.TagInstanceIndex: "0",
+				},
+			},
+		})).To(Succeed())
+
+		var b struct {
+			Series []datadog.Point `json:"series"`
+		}
+		Expect(json.Unmarshal([]byte(httpClient.requests()[0].body), &b)).To(Succeed())
+		Expect(b.Series[0].Tags).To(Equal([]string{
+			"foundation:prod-east",
+			"app_guid:app-id",
+			"instance_index:0",
+		}))
+	})
+
+	It("sends a series per app with the sum of its instances", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithLegacyTag(false),
+			datadog.WithAppAggregates(true),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+
+		var b struct {
+			Series []datadog.Point `json:"series"`
+		}
+		Expect(json.Unmarshal([]byte(httpClient.requests()[0].body), &b)).To(Succeed())
+		Expect(b.Series).To(HaveLen(3))
+		Expect(b.Series[2]).To(Equal(datadog.Point{
+			Metric: "application.ingress.app",
+			Points: [][]int64{{1234, 8642}},
+			Type:   "gauge",
+			Tags:   []string{"app_guid:app-id"},
+		}))
+	})
+
+	It("reports a heartbeat on every export", func() {
+		httpClient := &spyHTTPClient{}
+		clock := clocktest.New(time.Unix(1500000000, 0))
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithMetricPrefix("cf."),
+			datadog.WithTags([]string{"foundation:prod-east"}),
+			datadog.WithHeartbeat(true),
+			datadog.WithClock(clock),
+		)
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+
+		Expect(httpClient.requests()).To(HaveLen(2))
+		for _, r := range httpClient.requests() {
+			var b struct {
+				Series []datadog.Point `json:"series"`
+			}
+			Expect(json.Unmarshal([]byte(r.body), &b)).To(Succeed())
+			Expect(b.Series).To(HaveLen(1))
+			Expect(b.Series[0].Metric).To(Equal("cf.reporter.heartbeat"))
+			Expect(b.Series[0].Points[0][0]).To(Equal(int64(1500000000)))
+			Expect(b.Series[0].Points[0][1]).To(Equal(int64(1)))
+			Expect(b.Series[0].Tags).To(Equal([]string{"foundation:prod-east"}))
+		}
+	})
+
+	It("sends the heartbeat without retrying it with the queued series", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithHeartbeat(true),
+			datadog.WithRetry(1, time.Millisecond, time.Millisecond),
+		)
+
+		err := exporter.Export(context.Background(), points[:1])
+		Expect(err).To(MatchError(ContainSubstring("1 series queued")))
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(reqs).To(HaveLen(4))
+		Expect(reqs[2].body).To(ContainSubstring("reporter.heartbeat"))
+		Expect(reqs[3].body).ToNot(ContainSubstring("reporter.heartbeat"))
+		Expect(instanceTags(reqs[3].body)).To(Equal([]string{
+			"application.instance:app-id/2",
+		}))
+	})
+
+	It("compresses with deflate", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithCompression(datadog.CompressionDeflate),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(reqs[0].contentEncoding).To(Equal("deflate"))
+		Expect(reqs[0].body).To(ContainSubstring(`"series"`))
+	})
+
+	It("splits series into batches under the max payload size", func() {
+		httpClient := &spyHTTPClient{}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithCompression(datadog.CompressionNone),
+			datadog.WithMaxPayloadSize(400),
+		)
+
+		Expect(exporter.Export(context.Background(), manyPoints(10))).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(len(reqs)).To(BeNumerically(">", 1))
+
+		var series []string
+		for _, r := range reqs {
+			Expect(len(r.body)).To(BeNumerically("<=", 400))
+			Expect(r.contentEncoding).To(BeEmpty())
+			series = append(series, instanceTags(r.body)...)
+		}
+		Expect(series).To(HaveLen(10))
+		Expect(series[0]).To(Equal("application.instance:guid-0/0"))
+		Expect(series[9]).To(Equal("application.instance:guid-9/0"))
+	})
+
+	It("retries 5XX and 429 responses with backoff", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusServiceUnavailable},
+				{statusCode: http.StatusTooManyRequests, retryAfter: "0"},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(5, time.Millisecond, 10*time.Millisecond),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+		Expect(httpClient.requests()).To(HaveLen(3))
+	})
+
+	It("waits for the duration in the Retry-After header", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusTooManyRequests, retryAfter: "1"},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(5, time.Millisecond, time.Millisecond),
+		)
+
+		start := time.Now()
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+		Expect(httpClient.requests()).To(HaveLen(2))
+	})
+
+	It("does not retry other 4XX responses and drops the batch", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusForbidden},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(5, time.Millisecond, time.Millisecond),
+		)
+
+		err := exporter.Export(context.Background(), points)
+		Expect(err).To(MatchError(ContainSubstring("got 403")))
+		Expect(httpClient.requests()).To(HaveLen(1))
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+		Expect(httpClient.requests()).To(HaveLen(1))
+	})
+
+	It("queues series that could not be sent until the next export", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(2, time.Millisecond, time.Millisecond),
+		)
+
+		err := exporter.Export(context.Background(), points[:1])
+		Expect(err).To(MatchError(ContainSubstring("1 series queued, 0 dropped")))
+
+		Expect(exporter.Export(context.Background(), points[1:])).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(reqs).To(HaveLen(3))
+		Expect(instanceTags(reqs[2].body)).To(Equal([]string{
+			"application.instance:app-id/2",
+			"application.instance:org.space.app/1",
+		}))
+	})
+
+	It("drops the oldest series when the queue is full", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(1, time.Millisecond, time.Millisecond),
+			datadog.WithQueueSize(5),
+		)
+
+		err := exporter.Export(context.Background(), manyPoints(8))
+		Expect(err).To(MatchError(ContainSubstring("5 series queued, 3 dropped")))
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(instanceTags(reqs[1].body)).To(Equal([]string{
+			"application.instance:guid-3/0",
+			"application.instance:guid-4/0",
+			"application.instance:guid-5/0",
+			"application.instance:guid-6/0",
+			"application.instance:guid-7/0",
+		}))
+	})
+
+	It("ignores a non-positive queue size and number of attempts", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(0, time.Millisecond, time.Millisecond),
+			datadog.WithQueueSize(0),
+		)
+
+		Expect(exporter.Export(context.Background(), points)).To(Succeed())
+		Expect(httpClient.requests()).To(HaveLen(2))
+	})
+
+	It("stops retrying once the context is done", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(5, time.Hour, time.Hour),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		Expect(exporter.Export(ctx, points)).ToNot(Succeed())
+		Expect(httpClient.requests()).To(HaveLen(1))
+	})
+})
+
+func manyPoints(n int) []sink.Point {
+	var points []sink.Point
+	for i := 0; i < n; i++ {
+		points = append(points, sink.Point{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     float64(i),
+			Tags: map[string]string{
+				sink.TagAppGUID:       fmt.Sprintf("guid-%d", i),
+				sink.TagInstanceIndex: "0",
+			},
+		})
+	}
+
+	return points
+}
+
+// instanceTags returns the application.instance tag of every series.
+func instanceTags(body string) []string {
+	var b struct {
+		Series []datadog.Point `json:"series"`
+	}
+	Expect(json.Unmarshal([]byte(body), &b)).To(Succeed())
+
+	var tags []string
+	for _, s := range b.Series {
+		for _, t := range s.Tags {
+			if strings.HasPrefix(t, "application.instance:") {
+				tags = append(tags, t)
+			}
+		}
+	}
+
+	return tags
+}
+
+type spyResponse struct {
+	statusCode int
+	retryAfter string
+}
+
+type spyRequest struct {
+	method          string
+	url             string
+	apiKey          string
+	contentType     string
+	contentEncoding string
+	body            string
+}
+
+type spyHTTPClient struct {
+	mu sync.Mutex
+	// responses are returned in order, once they are exhausted every
+	// request succeeds.
+	responses []spyResponse
+	_requests []spyRequest
+}
+
+func (s *spyHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		body = gr
+	case "deflate":
+		zr, err := zlib.NewReader(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		body = zr
+	}
+
+	data, err := ioutil.ReadAll(body)
+	Expect(err).ToNot(HaveOccurred())
+
+	s._requests = append(s._requests, spyRequest{
+		method:          r.Method,
+		url:             r.URL.String(),
+		apiKey:          r.Header.Get("DD-API-KEY"),
+		contentType:     r.Header.Get("Content-Type"),
+		contentEncoding: r.Header.Get("Content-Encoding"),
+		body:            string(data),
+	})
+
+	resp := spyResponse{statusCode: http.StatusAccepted}
+	if len(s.responses) > 0 {
+		resp, s.responses = s.responses[0], s.responses[1:]
+	}
+
+	header := http.Header{}
+	if resp.retryAfter != "" {
+		header.Set("Retry-After", resp.retryAfter)
+	}
+
+	return &http.Response{
+		StatusCode: resp.statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func (s *spyHTTPClient) requests() []spyRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._requests
+}
@@ -0,0 +1,67 @@
+package datadog
+
+import "bytes"
+
+var (
+	seriesPrefix = []byte(`{"series":[`)
+	seriesSuffix = []byte(`]}`)
+)
+
+// queue is a bounded FIFO queue of JSON encoded series.
+type queue struct {
+	size   int
+	series [][]byte
+}
+
+func newQueue(size int) *queue {
+	return &queue{size: size}
+}
+
+// push adds the series to the queue. If the queue is full the oldest series
+// is dropped. It returns the number of dropped series.
+func (q *queue) push(s []byte) int {
+	q.series = append(q.series, s)
+	if len(q.series) <= q.size {
+		return 0
+	}
+
+	q.series = q.series[1:]
+	return 1
+}
+
+// batch returns the request body for the longest run of series from the
+// front of the queue that fits in maxSize, and the number of series in it.
+// A batch always contains at least one series.
+func (q *queue) batch(maxSize int) (int, []byte) {
+	var buf bytes.Buffer
+	buf.Write(seriesPrefix)
+
+	n := 0
+	for _, s := range q.series {
+		size := buf.Len() + len(s) + len(seriesSuffix)
+		if n > 0 {
+			size++
+		}
+		if n > 0 && size > maxSize {
+			break
+		}
+
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(s)
+		n++
+	}
+	buf.Write(seriesSuffix)
+
+	return n, buf.Bytes()
+}
+
+// pop removes the first n series from the queue.
+func (q *queue) pop(n int) {
+	q.series = q.series[n:]
+}
+
+func (q *queue) len() int {
+	return len(q.series)
+}
@@ -0,0 +1,133 @@
+package datadog_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/datadog"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Queue", func() {
+	It("keeps the newest series across exports when it overflows", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(1, time.Millisecond, time.Millisecond),
+			datadog.WithQueueSize(4),
+		)
+
+		err := exporter.Export(context.Background(), manyPoints(3))
+		Expect(err).To(MatchError(ContainSubstring("3 series queued, 0 dropped")))
+
+		err = exporter.Export(context.Background(), manyPoints(6)[3:])
+		Expect(err).To(MatchError(ContainSubstring("4 series queued, 2 dropped")))
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(reqs).To(HaveLen(3))
+		Expect(instanceTags(reqs[2].body)).To(Equal([]string{
+			"application.instance:guid-2/0",
+			"application.instance:guid-3/0",
+			"application.instance:guid-4/0",
+			"application.instance:guid-5/0",
+		}))
+	})
+
+	It("resets the number of dropped series once the queue is sent", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+				{statusCode: http.StatusAccepted},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(1, time.Millisecond, time.Millisecond),
+			datadog.WithQueueSize(2),
+		)
+
+		err := exporter.Export(context.Background(), manyPoints(3))
+		Expect(err).To(MatchError(ContainSubstring("2 series queued, 1 dropped")))
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+
+		err = exporter.Export(context.Background(), manyPoints(1))
+		Expect(err).To(MatchError(ContainSubstring("1 series queued, 0 dropped")))
+	})
+
+	It("keeps a batch queued after the max attempts and resends it", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusInternalServerError},
+				{statusCode: http.StatusBadGateway},
+				{statusCode: http.StatusServiceUnavailable},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithRetry(3, time.Millisecond, time.Millisecond),
+		)
+
+		err := exporter.Export(context.Background(), manyPoints(2))
+		Expect(err).To(MatchError(ContainSubstring("got 503")))
+		Expect(err).To(MatchError(ContainSubstring("2 series queued, 0 dropped")))
+		Expect(httpClient.requests()).To(HaveLen(3))
+
+		Expect(exporter.Export(context.Background(), nil)).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(reqs).To(HaveLen(5))
+		for _, r := range reqs[1:] {
+			Expect(r.body).To(Equal(reqs[0].body))
+		}
+	})
+
+	It("sends series in the order they were queued", func() {
+		httpClient := &spyHTTPClient{
+			responses: []spyResponse{
+				{statusCode: http.StatusAccepted},
+				{statusCode: http.StatusInternalServerError},
+			},
+		}
+		exporter := datadog.NewExporter("api-key",
+			datadog.WithHTTPClient(httpClient),
+			datadog.WithCompression(datadog.CompressionNone),
+			datadog.WithMaxPayloadSize(400),
+			datadog.WithRetry(1, time.Millisecond, time.Millisecond),
+		)
+
+		Expect(exporter.Export(context.Background(), manyPoints(10))).ToNot(Succeed())
+		Expect(exporter.Export(context.Background(), manyPoints(12)[10:])).To(Succeed())
+
+		reqs := httpClient.requests()
+		Expect(len(reqs)).To(BeNumerically(">", 3))
+
+		// The second request failed and its series were sent again at the
+		// front of the next export.
+		var series []string
+		for i, r := range reqs {
+			if i == 1 {
+				continue
+			}
+			series = append(series, instanceTags(r.body)...)
+		}
+
+		var expected []string
+		for i := 0; i < 12; i++ {
+			expected = append(expected, fmt.Sprintf("application.instance:guid-%d/0", i))
+		}
+		Expect(series).To(Equal(expected))
+	})
+})
@@ -0,0 +1,262 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// unknownSegment is used in place of the org and space for application
+// instances whose names could not be looked up.
+const unknownSegment = "unknown"
+
+// Exporter is a sink Exporter that writes Points to a carbon endpoint using
+// the Graphite plaintext protocol. Lines are buffered in memory while carbon
+// is unavailable and sent once a connection can be established again.
+type Exporter struct {
+	addr        string
+	prefix      string
+	bufferSize  int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	dialTimeout time.Duration
+
+	mu          sync.Mutex
+	conn        net.Conn
+	buffer      []string
+	dropped     int
+	backoff     time.Duration
+	nextAttempt time.Time
+}
+
+// NewExporter initializes and returns a new Exporter that writes to the
+// carbon endpoint at the given address.
+func NewExporter(addr string, opts ...ExporterOption) *Exporter {
+	e := &Exporter{
+		addr:        addr,
+		bufferSize:  10000,
+		minBackoff:  time.Second,
+		maxBackoff:  time.Minute,
+		dialTimeout: 5 * time.Second,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e
+}
+
+// Export satisfies the sink Exporter interface. The Points are added to the
+// buffer and the whole buffer is written to carbon. If carbon is unavailable
+// the lines are kept in the buffer until the next Export. When the buffer is
+// full the oldest lines are dropped.
+func (e *Exporter) Export(ctx context.Context, points []sink.Point) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, p := range points {
+		e.buffer = append(e.buffer, e.line(p))
+	}
+	if over := len(e.buffer) - e.bufferSize; over > 0 {
+		e.buffer = e.buffer[over:]
+		e.dropped += over
+	}
+
+	if e.conn == nil {
+		if wait := time.Until(e.nextAttempt); wait > 0 {
+			return fmt.Errorf(
+				"carbon is unavailable, retrying in %s with %d lines buffered and %d dropped",
+				wait.Round(time.Millisecond),
+				len(e.buffer),
+				e.dropped,
+			)
+		}
+
+		if err := e.connect(ctx); err != nil {
+			e.fail()
+			return fmt.Errorf("failed to connect to carbon: %s", err)
+		}
+	}
+
+	if err := e.flush(ctx); err != nil {
+		e.conn.Close()
+		e.conn = nil
+		e.fail()
+		return fmt.Errorf("failed to write to carbon: %s", err)
+	}
+
+	e.backoff = 0
+	e.dropped = 0
+
+	return nil
+}
+
+// Close closes the connection to carbon.
+func (e *Exporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+
+	err := e.conn.Close()
+	e.conn = nil
+
+	return err
+}
+
+func (e *Exporter) connect(ctx context.Context) error {
+	d := net.Dialer{Timeout: e.dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+
+	e.conn = conn
+	return nil
+}
+
+// flush writes the buffered lines to carbon. The buffer is only cleared once
+// every line has been written. Lines that were already written before a
+// failure are sent again, which is harmless as carbon keeps the last value
+// for a timestamp.
+func (e *Exporter) flush(ctx context.Context) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		e.conn.SetWriteDeadline(deadline)
+	} else {
+		e.conn.SetWriteDeadline(time.Time{})
+	}
+
+	w := bufio.NewWriter(e.conn)
+	for _, l := range e.buffer {
+		if _, err := w.WriteString(l); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	e.buffer = e.buffer[:0]
+
+	return nil
+}
+
+// fail doubles the backoff up to the max backoff and schedules the next
+// connection attempt.
+func (e *Exporter) fail() {
+	e.backoff *= 2
+	if e.backoff < e.minBackoff {
+		e.backoff = e.minBackoff
+	}
+	if e.backoff > e.maxBackoff {
+		e.backoff = e.maxBackoff
+	}
+
+	e.nextAttempt = time.Now().Add(e.backoff)
+}
+
+// line returns the plaintext line for the given Point. Application instances
+// are written as <prefix>.<org>.<space>.<app>.<index>.logs, with the
+// foundation after the prefix when it is set.
+func (e *Exporter) line(p sink.Point) string {
+	return fmt.Sprintf("%s %s %d\n",
+		e.path(p),
+		strconv.FormatFloat(p.Value, 'f', -1, 64),
+		p.Timestamp,
+	)
+}
+
+func (e *Exporter) path(p sink.Point) string {
+	var segments []string
+	if e.prefix != "" {
+		segments = append(segments, e.prefix)
+	}
+
+	guid, ok := p.Tags[sink.TagAppGUID]
+	if !ok {
+		for _, s := range strings.Split(p.Name, ".") {
+			segments = append(segments, sanitize(s))
+		}
+		return strings.Join(segments, ".")
+	}
+
+	if foundation, ok := p.Tags[sink.TagFoundation]; ok {
+		segments = append(segments, sanitize(foundation))
+	}
+
+	if app, ok := p.Tags[sink.TagApp]; ok {
+		segments = append(segments,
+			sanitize(p.Tags[sink.TagOrg]),
+			sanitize(p.Tags[sink.TagSpace]),
+			sanitize(app),
+		)
+	} else {
+		segments = append(segments, unknownSegment, unknownSegment, sanitize(guid))
+	}
+
+	segments = append(segments, sanitize(p.Tags[sink.TagInstanceIndex]), "logs")
+
+	return strings.Join(segments, ".")
+}
+
+var invalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// sanitize replaces every character that is not safe in a metric path
+// segment, including the dot separator, with an underscore.
+func sanitize(s string) string {
+	if s == "" {
+		return "_"
+	}
+
+	return invalidChars.ReplaceAllString(s, "_")
+}
+
+// ExporterOption is a func that is used to configure optional settings on an
+// Exporter.
+type ExporterOption func(*Exporter)
+
+// WithPrefix returns an ExporterOption for configuring the prefix of every
+// metric path.
+func WithPrefix(prefix string) ExporterOption {
+	return func(e *Exporter) {
+		e.prefix = strings.Trim(prefix, ".")
+	}
+}
+
+// WithBufferSize returns an ExporterOption for configuring the maximum number
+// of lines buffered while carbon is unavailable. Defaults to 10000.
+func WithBufferSize(size int) ExporterOption {
+	return func(e *Exporter) {
+		e.bufferSize = size
+	}
+}
+
+// WithBackoff returns an ExporterOption for configuring how long to wait
+// before reconnecting to carbon after a failure. The backoff starts at min
+// and doubles with every consecutive failure up to max. Defaults to 1 second
+// and 1 minute.
+func WithBackoff(min, max time.Duration) ExporterOption {
+	return func(e *Exporter) {
+		e.minBackoff = min
+		e.maxBackoff = max
+	}
+}
+
+// WithDialTimeout returns an ExporterOption for configuring the timeout for
+// connecting to carbon. Defaults to 5 seconds.
+func WithDialTimeout(d time.Duration) ExporterOption {
+	return func(e *Exporter) {
+		e.dialTimeout = d
+	}
+}
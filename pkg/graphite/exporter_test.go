@@ -0,0 +1,187 @@
+package graphite_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/graphite"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var points = []sink.Point{
+		{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     4321,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "app-guid",
+				sink.TagInstanceIndex: "1",
+				sink.TagOrg:           "my-org",
+				sink.TagSpace:         "dev space",
+				sink.TagApp:           "my.app",
+			},
+		},
+		{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     10,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "other-guid",
+				sink.TagInstanceIndex: "0",
+			},
+		},
+	}
+
+	It("writes points as plaintext lines", func() {
+		carbon := newFakeCarbon("127.0.0.1:0")
+		defer carbon.close()
+
+		e := graphite.NewExporter(carbon.addr(), graphite.WithPrefix("nn."))
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		Eventually(carbon.lines).Should(Equal([]string{
+			"nn.my-org.dev_space.my_app.1.logs 4321 1234",
+			"nn.unknown.unknown.other-guid.0.logs 10 1234",
+		}))
+	})
+
+	It("writes the foundation after the prefix", func() {
+		carbon := newFakeCarbon("127.0.0.1:0")
+		defer carbon.close()
+
+		e := graphite.NewExporter(carbon.addr(), graphite.WithPrefix("nn"))
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), []sink.Point{
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     10,
+				Tags: map[string]string{
+					sink.TagFoundation:    "prod.east",
+					sink.TagAppGUID:       "other-guid",
+					sink.TagInstanceIndex: "0",
+				},
+			},
+		})).To(Succeed())
+
+		Eventually(carbon.lines).Should(Equal([]string{
+			"nn.prod_east.unknown.unknown.other-guid.0.logs 10 1234",
+		}))
+	})
+
+	It("buffers points and reconnects once carbon is available", func() {
+		carbon := newFakeCarbon("127.0.0.1:0")
+		addr := carbon.addr()
+		carbon.close()
+
+		e := graphite.NewExporter(addr,
+			graphite.WithBackoff(10*time.Millisecond, 20*time.Millisecond),
+		)
+		defer e.Close()
+
+		err := e.Export(context.Background(), points[:1])
+		Expect(err).To(MatchError(ContainSubstring("failed to connect to carbon")))
+
+		err = e.Export(context.Background(), points[1:])
+		Expect(err).To(MatchError(ContainSubstring("2 lines buffered")))
+
+		carbon = newFakeCarbon(addr)
+		defer carbon.close()
+
+		Eventually(func() error {
+			return e.Export(context.Background(), nil)
+		}).Should(Succeed())
+
+		Eventually(carbon.lines).Should(Equal([]string{
+			"my-org.dev_space.my_app.1.logs 4321 1234",
+			"unknown.unknown.other-guid.0.logs 10 1234",
+		}))
+	})
+
+	It("drops the oldest points when the buffer is full", func() {
+		carbon := newFakeCarbon("127.0.0.1:0")
+		addr := carbon.addr()
+		carbon.close()
+
+		e := graphite.NewExporter(addr,
+			graphite.WithBufferSize(1),
+			graphite.WithBackoff(10*time.Millisecond, 10*time.Millisecond),
+		)
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), points)).ToNot(Succeed())
+
+		carbon = newFakeCarbon(addr)
+		defer carbon.close()
+
+		Eventually(func() error {
+			return e.Export(context.Background(), nil)
+		}).Should(Succeed())
+
+		Eventually(carbon.lines).Should(Equal([]string{
+			"unknown.unknown.other-guid.0.logs 10 1234",
+		}))
+	})
+})
+
+type fakeCarbon struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	_lines []string
+}
+
+func newFakeCarbon(addr string) *fakeCarbon {
+	l, err := net.Listen("tcp", addr)
+	Expect(err).ToNot(HaveOccurred())
+
+	c := &fakeCarbon{listener: l}
+	go c.accept()
+
+	return c
+}
+
+func (c *fakeCarbon) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			s := bufio.NewScanner(conn)
+			for s.Scan() {
+				c.mu.Lock()
+				c._lines = append(c._lines, s.Text())
+				c.mu.Unlock()
+			}
+		}()
+	}
+}
+
+func (c *fakeCarbon) addr() string {
+	return c.listener.Addr().String()
+}
+
+func (c *fakeCarbon) close() {
+	c.listener.Close()
+}
+
+func (c *fakeCarbon) lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c._lines
+}
@@ -0,0 +1,264 @@
+package influxdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// CountField is the field the value of every Point is written to.
+const CountField = "count"
+
+// Exporter is a sink Exporter that writes Points to InfluxDB using the line
+// protocol. Each Point is written with its tags as tags and its value as the
+// count field.
+type Exporter struct {
+	addr       string
+	httpClient HTTPClient
+	batchSize  int
+	gzip       bool
+
+	// InfluxDB 1.x
+	database        string
+	retentionPolicy string
+	username        string
+	password        string
+
+	// InfluxDB 2.x
+	org    string
+	bucket string
+	token  string
+}
+
+// NewExporter initializes and returns a new Exporter that writes to the
+// InfluxDB at the given address. By default the InfluxDB 1.x write API is
+// used, use WithV2 to write to InfluxDB 2.x.
+func NewExporter(addr string, opts ...ExporterOption) *Exporter {
+	e := &Exporter{
+		addr: strings.TrimRight(addr, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		batchSize: 5000,
+		gzip:      true,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e
+}
+
+// Export satisfies the sink Exporter interface. The Points are written in
+// batches of at most the configured batch size.
+func (e *Exporter) Export(ctx context.Context, points []sink.Point) error {
+	size := e.batchSize
+	if size < 1 {
+		size = len(points)
+	}
+
+	for start := 0; start < len(points); start += size {
+		end := start + size
+		if end > len(points) {
+			end = len(points)
+		}
+
+		if err := e.write(ctx, points[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Exporter) write(ctx context.Context, points []sink.Point) error {
+	body, err := e.body(points)
+	if err != nil {
+		return fmt.Errorf("failed to build request body for influxdb: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.writeURL(), body)
+	if err != nil {
+		return fmt.Errorf("failed to build request to influxdb: %s", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	switch {
+	case e.token != "":
+		req.Header.Set("Authorization", "Token "+e.token)
+	case e.username != "":
+		req.SetBasicAuth(e.username, e.password)
+	}
+
+	resp, err := e.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to write to influxdb: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 || resp.StatusCode < 200 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+
+		return fmt.Errorf(
+			"expected successful status code from InfluxDB, got %d: %s",
+			resp.StatusCode,
+			respBody,
+		)
+	}
+
+	return nil
+}
+
+func (e *Exporter) writeURL() string {
+	if e.bucket != "" {
+		query := url.Values{
+			"org":       []string{e.org},
+			"bucket":    []string{e.bucket},
+			"precision": []string{"s"},
+		}
+		return fmt.Sprintf("%s/api/v2/write?%s", e.addr, query.Encode())
+	}
+
+	query := url.Values{
+		"db":        []string{e.database},
+		"precision": []string{"s"},
+	}
+	if e.retentionPolicy != "" {
+		query.Set("rp", e.retentionPolicy)
+	}
+
+	return fmt.Sprintf("%s/write?%s", e.addr, query.Encode())
+}
+
+func (e *Exporter) body(points []sink.Point) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	for _, p := range points {
+		writeLine(&buf, p)
+	}
+
+	if !e.gzip {
+		return &buf, nil
+	}
+
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	if _, err := buf.WriteTo(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &compressed, nil
+}
+
+// writeLine writes the given Point in line protocol. Tags are sorted by key
+// as recommended by InfluxDB and tags with empty values are omitted as they
+// are not valid line protocol.
+func writeLine(buf *bytes.Buffer, p sink.Point) {
+	buf.WriteString(measurementEscaper.Replace(p.Name))
+
+	keys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		buf.WriteByte(',')
+		buf.WriteString(tagEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(tagEscaper.Replace(p.Tags[k]))
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(CountField)
+	buf.WriteByte('=')
+	buf.WriteString(strconv.FormatInt(int64(p.Value), 10))
+	buf.WriteString("i ")
+	buf.WriteString(strconv.FormatInt(p.Timestamp, 10))
+	buf.WriteByte('\n')
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// ExporterOption is a func that is used to configure optional settings on an
+// Exporter.
+type ExporterOption func(*Exporter)
+
+// WithDatabase returns an ExporterOption for configuring the InfluxDB 1.x
+// database and retention policy to write to. An empty retention policy
+// writes to the default retention policy of the database.
+func WithDatabase(database, retentionPolicy string) ExporterOption {
+	return func(e *Exporter) {
+		e.database = database
+		e.retentionPolicy = retentionPolicy
+	}
+}
+
+// WithBasicAuth returns an ExporterOption for configuring the credentials
+// used to authenticate with InfluxDB 1.x.
+func WithBasicAuth(username, password string) ExporterOption {
+	return func(e *Exporter) {
+		e.username = username
+		e.password = password
+	}
+}
+
+// WithV2 returns an ExporterOption for writing to the given org and bucket
+// with the InfluxDB 2.x write API.
+func WithV2(org, bucket, token string) ExporterOption {
+	return func(e *Exporter) {
+		e.org = org
+		e.bucket = bucket
+		e.token = token
+	}
+}
+
+// WithBatchSize returns an ExporterOption for configuring the maximum number
+// of Points written in a single request. Defaults to 5000.
+func WithBatchSize(size int) ExporterOption {
+	return func(e *Exporter) {
+		e.batchSize = size
+	}
+}
+
+// WithGzip returns an ExporterOption for configuring if requests are gzip
+// compressed. Defaults to true.
+func WithGzip(enabled bool) ExporterOption {
+	return func(e *Exporter) {
+		e.gzip = enabled
+	}
+}
+
+// WithHTTPClient returns an ExporterOption for configuring the HTTPClient
+// used to write to InfluxDB.
+func WithHTTPClient(c HTTPClient) ExporterOption {
+	return func(e *Exporter) {
+		e.httpClient = c
+	}
+}
+
+// HTTPClient is the interface used for sending HTTP requests to InfluxDB.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
@@ -0,0 +1,190 @@
+package influxdb_test
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/influxdb"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var (
+		server *fakeInfluxDB
+		points []sink.Point
+	)
+
+	BeforeEach(func() {
+		server = newFakeInfluxDB(http.StatusNoContent)
+
+		points = []sink.Point{
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     4321,
+				Tags: map[string]string{
+					sink.TagAppGUID:       "app-guid",
+					sink.TagInstanceIndex: "1",
+					sink.TagOrg:           "my org",
+					sink.TagSpace:         "space,1",
+					sink.TagApp:           "app=1",
+				},
+			},
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     10,
+				Tags: map[string]string{
+					sink.TagAppGUID:       "other-guid",
+					sink.TagInstanceIndex: "0",
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("writes gzipped line protocol to the v1 write API", func() {
+		e := influxdb.NewExporter(server.URL+"/",
+			influxdb.WithDatabase("noisy", "week"),
+			influxdb.WithBasicAuth("user", "pass"),
+		)
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		reqs := server.requests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].method).To(Equal(http.MethodPost))
+		Expect(reqs[0].path).To(Equal("/write"))
+		Expect(reqs[0].query).To(Equal("db=noisy&precision=s&rp=week"))
+		Expect(reqs[0].encoding).To(Equal("gzip"))
+		Expect(reqs[0].auth).To(Equal("Basic dXNlcjpwYXNz"))
+		Expect(reqs[0].body).To(Equal(
+			`application.ingress,app=app\=1,app_guid=app-guid,instance_index=1,org=my\ org,space=space\,1 count=4321i 1234` + "\n" +
+				"application.ingress,app_guid=other-guid,instance_index=0 count=10i 1234\n",
+		))
+	})
+
+	It("writes to the v2 write API with a token", func() {
+		e := influxdb.NewExporter(server.URL,
+			influxdb.WithV2("my-org", "my-bucket", "secret"),
+			influxdb.WithGzip(false),
+		)
+
+		Expect(e.Export(context.Background(), points[1:])).To(Succeed())
+
+		reqs := server.requests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].path).To(Equal("/api/v2/write"))
+		Expect(reqs[0].query).To(Equal("bucket=my-bucket&org=my-org&precision=s"))
+		Expect(reqs[0].encoding).To(BeEmpty())
+		Expect(reqs[0].auth).To(Equal("Token secret"))
+		Expect(reqs[0].body).To(Equal(
+			"application.ingress,app_guid=other-guid,instance_index=0 count=10i 1234\n",
+		))
+	})
+
+	It("writes points in batches", func() {
+		var many []sink.Point
+		for i := 0; i < 5; i++ {
+			many = append(many, sink.Point{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     float64(i),
+				Tags:      map[string]string{sink.TagAppGUID: fmt.Sprintf("guid-%d", i)},
+			})
+		}
+
+		e := influxdb.NewExporter(server.URL,
+			influxdb.WithDatabase("noisy", ""),
+			influxdb.WithBatchSize(2),
+		)
+
+		Expect(e.Export(context.Background(), many)).To(Succeed())
+
+		reqs := server.requests()
+		Expect(reqs).To(HaveLen(3))
+		Expect(strings.Count(reqs[0].body, "\n")).To(Equal(2))
+		Expect(strings.Count(reqs[1].body, "\n")).To(Equal(2))
+		Expect(reqs[2].body).To(Equal(
+			"application.ingress,app_guid=guid-4 count=4i 1234\n",
+		))
+	})
+
+	It("returns an error for a non 2XX status code", func() {
+		server.statusCode = http.StatusUnauthorized
+		e := influxdb.NewExporter(server.URL, influxdb.WithDatabase("noisy", ""))
+
+		err := e.Export(context.Background(), points)
+		Expect(err).To(MatchError(ContainSubstring("got 401")))
+	})
+})
+
+type influxRequest struct {
+	method   string
+	path     string
+	query    string
+	encoding string
+	auth     string
+	body     string
+}
+
+type fakeInfluxDB struct {
+	*httptest.Server
+	statusCode int
+
+	mu        sync.Mutex
+	_requests []influxRequest
+}
+
+func newFakeInfluxDB(statusCode int) *fakeInfluxDB {
+	f := &fakeInfluxDB{statusCode: statusCode}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeInfluxDB) handle(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+
+	var body []byte
+	var err error
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, gerr := gzip.NewReader(r.Body)
+		Expect(gerr).ToNot(HaveOccurred())
+		body, err = ioutil.ReadAll(gr)
+	} else {
+		body, err = ioutil.ReadAll(r.Body)
+	}
+	Expect(err).ToNot(HaveOccurred())
+
+	f.mu.Lock()
+	f._requests = append(f._requests, influxRequest{
+		method:   r.Method,
+		path:     r.URL.Path,
+		query:    r.URL.RawQuery,
+		encoding: r.Header.Get("Content-Encoding"),
+		auth:     r.Header.Get("Authorization"),
+		body:     string(body),
+	})
+	f.mu.Unlock()
+
+	w.WriteHeader(f.statusCode)
+}
+
+func (f *fakeInfluxDB) requests() []influxRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f._requests
+}
@@ -1,26 +1,49 @@
 package ingress
 
 import (
-	"log"
+	"context"
 
 	"code.cloudfoundry.org/go-diodes"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 	"github.com/cloudfoundry/sonde-go/events"
 )
 
 // Buffer is a simple wrapper around the go-diode for the events.Envelope type.
 type Buffer struct {
-	d *diodes.Poller
+	d      *diodes.Poller
+	cancel context.CancelFunc
+	logger *logging.Logger
 }
 
 // NewBuffer initializes and returns with given size.
-func NewBuffer(size int) *Buffer {
-	d := &Buffer{}
+func NewBuffer(size int, opts ...BufferOption) *Buffer {
+	d := &Buffer{
+		logger: logging.Default(),
+	}
+
+	for _, o := range opts {
+		o(d)
+	}
 
-	d.d = diodes.NewPoller(diodes.NewOneToOne(size, d))
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.d = diodes.NewPoller(diodes.NewOneToOne(size, d), diodes.WithPollingContext(ctx))
 
 	return d
 }
 
+// BufferOption is a func that is used to configure optional settings on a
+// Buffer.
+type BufferOption func(*Buffer)
+
+// WithLogger returns a BufferOption for configuring the Logger dropped
+// envelopes are written to.
+func WithLogger(l *logging.Logger) BufferOption {
+	return func(d *Buffer) {
+		d.logger = l
+	}
+}
+
 // Set adds an envelope to the buffer.
 func (d *Buffer) Set(e *events.Envelope) {
 	d.d.Set(diodes.GenericDataType(e))
@@ -39,15 +62,22 @@ func (d *Buffer) TryNext() (*events.Envelope, bool) {
 }
 
 // Next reads and returns the next envelope. This method will block until an
-// envelope is available.
+// envelope is available. Once the buffer is closed and every envelope has
+// been read it returns nil.
 func (d *Buffer) Next() *events.Envelope {
 	e := d.d.Next()
 
 	return (*events.Envelope)(e)
 }
 
+// Close closes the buffer. Envelopes that are already in the buffer can still
+// be read with Next. Envelopes should not be set after the buffer is closed.
+func (d *Buffer) Close() {
+	d.cancel()
+}
+
 // Alert is used by the internal diode. When envelopes are dropped we simply log
 // a message noting how many envelopes were dropped.
 func (d *Buffer) Alert(missed int) {
-	log.Printf("dropped %d envelopes", missed)
+	d.logger.Warn("dropped envelopes", "dropped", missed)
 }
@@ -0,0 +1,21 @@
+package ingress_test
+
+import (
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/ingress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buffer", func() {
+	It("drains the envelopes in the buffer once it is closed", func() {
+		b := ingress.NewBuffer(5)
+		b.Set(logMessage)
+		b.Set(rtrLogMessage)
+		b.Close()
+
+		Expect(b.Next()).To(Equal(logMessage))
+		Expect(b.Next()).To(Equal(rtrLogMessage))
+		Expect(b.Next()).To(BeNil())
+	})
+})
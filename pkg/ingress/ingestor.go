@@ -1,6 +1,8 @@
 package ingress
 
 import (
+	"context"
+
 	"github.com/cloudfoundry/sonde-go/events"
 )
 
@@ -23,9 +25,33 @@ func NewIngestor(msgs <-chan *events.Envelope, s Set) *Ingestor {
 
 // Run will start ingesting enveloeps off of the Ingestors message channel and
 // writing them to the setter func. This method will block until the messages
-// channel is closed.
-func (i *Ingestor) Run() {
-	for e := range i.msgs {
-		i.setter(e)
+// channel is closed or the given context is done.
+func (i *Ingestor) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-i.msgs:
+			if !ok {
+				return
+			}
+
+			i.setter(e)
+		}
+	}
+}
+
+// RoundRobin returns a Set that distributes envelopes evenly across the given
+// Sets. The returned Set is not safe for concurrent use and is intended to be
+// used by a single Ingestor.
+func RoundRobin(sets ...Set) Set {
+	if len(sets) == 1 {
+		return sets[0]
+	}
+
+	var next int
+	return func(e *events.Envelope) {
+		sets[next](e)
+		next = (next + 1) % len(sets)
 	}
 }
@@ -0,0 +1,55 @@
+package ingress_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/ingress"
+	"github.com/cloudfoundry/sonde-go/events"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ingestor", func() {
+	It("writes envelopes from the message channel to the setter", func() {
+		msgs := make(chan *events.Envelope, 2)
+		msgs <- logMessage
+		msgs <- rtrLogMessage
+		close(msgs)
+
+		var set []*events.Envelope
+		i := ingress.NewIngestor(msgs, func(e *events.Envelope) {
+			set = append(set, e)
+		})
+		i.Run(context.Background())
+
+		Expect(set).To(Equal([]*events.Envelope{logMessage, rtrLogMessage}))
+	})
+
+	It("stops when the context is done", func() {
+		msgs := make(chan *events.Envelope)
+		i := ingress.NewIngestor(msgs, func(e *events.Envelope) {})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		i.Run(ctx)
+	})
+
+	Describe("RoundRobin", func() {
+		It("distributes envelopes evenly across sets", func() {
+			var a, b []*events.Envelope
+			set := ingress.RoundRobin(
+				func(e *events.Envelope) { a = append(a, e) },
+				func(e *events.Envelope) { b = append(b, e) },
+			)
+
+			set(logMessage)
+			set(rtrLogMessage)
+			set(httpStartStop)
+
+			Expect(a).To(Equal([]*events.Envelope{logMessage, httpStartStop}))
+			Expect(b).To(Equal([]*events.Envelope{rtrLogMessage}))
+		})
+	})
+})
@@ -1,6 +1,8 @@
 package ingress_test
 
 import (
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -8,6 +10,7 @@ import (
 )
 
 func TestIngress(t *testing.T) {
+	logging.SetDefault(logging.New(GinkgoWriter, logging.LevelDebug))
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Ingress Suite")
 }
@@ -1,13 +1,15 @@
 package ingress
 
 import (
-	"fmt"
-
 	"github.com/cloudfoundry/sonde-go/events"
 )
 
 const (
 	sourceTypeRouter = "RTR"
+
+	// maxCachedKeys is the number of counter keys a Processor will cache
+	// before the cache is cleared.
+	maxCachedKeys = 50000
 )
 
 // Next is a func that reads an envelope off of a buffer.
@@ -21,6 +23,11 @@ type Processor struct {
 	next              Next
 	inc               Inc
 	includeRouterLogs bool
+
+	// keys caches the counter key for each app ID and source instance so
+	// that building a key does not allocate for every envelope.
+	keys       map[string]map[string]string
+	cachedKeys int
 }
 
 // NewProcessor initializes a new Processor.
@@ -29,15 +36,19 @@ func NewProcessor(n Next, i Inc, includeRouterLogs bool) *Processor {
 		next:              n,
 		inc:               i,
 		includeRouterLogs: includeRouterLogs,
+		keys:              make(map[string]map[string]string),
 	}
 }
 
 // Run will read events.Envelopes from the processors next func and increment
 // the counter for the Envelopes source instance. This is a blocking method that
-// will run indefinitely.
+// will run until the next func returns nil.
 func (p *Processor) Run() {
 	for {
 		e := p.next()
+		if e == nil {
+			return
+		}
 
 		if e.GetEventType() != events.Envelope_LogMessage {
 			continue
@@ -49,6 +60,32 @@ func (p *Processor) Run() {
 			continue
 		}
 
-		p.inc(fmt.Sprintf("%s/%s", l.GetAppId(), l.GetSourceInstance()))
+		p.inc(p.key(l.GetAppId(), l.GetSourceInstance()))
+	}
+}
+
+// key returns the counter key for the given app ID and source instance in the
+// format app-id/source-instance.
+func (p *Processor) key(appID, instance string) string {
+	instances, ok := p.keys[appID]
+	if !ok {
+		instances = make(map[string]string)
+		p.keys[appID] = instances
 	}
+
+	k, ok := instances[instance]
+	if ok {
+		return k
+	}
+
+	if p.cachedKeys >= maxCachedKeys {
+		p.keys = map[string]map[string]string{appID: instances}
+		p.cachedKeys = len(instances)
+	}
+
+	k = appID + "/" + instance
+	instances[instance] = k
+	p.cachedKeys++
+
+	return k
 }
@@ -0,0 +1,75 @@
+package ingress_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/ingress"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+func BenchmarkProcessor(b *testing.B) {
+	envelopes := make([]*events.Envelope, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		envelopes = append(envelopes, &events.Envelope{
+			EventType: events.Envelope_LogMessage.Enum(),
+			LogMessage: &events.LogMessage{
+				AppId:          proto.String(fmt.Sprintf("app-%d", i%250)),
+				SourceInstance: proto.String(fmt.Sprintf("%d", i%4)),
+			},
+		})
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			c := store.NewShardedCounter(workers, func() store.Shard {
+				return store.NewCounter()
+			})
+
+			var wg sync.WaitGroup
+			processors := make([]*ingress.Processor, workers)
+			for i := range processors {
+				processors[i] = ingress.NewProcessor(
+					nextN(envelopes, b.N/workers),
+					c.Shard(i).Inc,
+					false,
+				)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+
+			for _, p := range processors {
+				wg.Add(1)
+				go func(p *ingress.Processor) {
+					defer wg.Done()
+					p.Run()
+				}(p)
+			}
+			wg.Wait()
+
+			b.StopTimer()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "envelopes/s")
+		})
+	}
+}
+
+// nextN returns a Next func that cycles through the given envelopes n times
+// before returning nil.
+func nextN(envelopes []*events.Envelope, n int) ingress.Next {
+	var i int
+	return func() *events.Envelope {
+		if i >= n {
+			return nil
+		}
+
+		e := envelopes[i%len(envelopes)]
+		i++
+		return e
+	}
+}
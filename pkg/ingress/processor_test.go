@@ -73,6 +73,29 @@ var _ = Describe("Processor", func() {
 
 		Eventually(incIDs).Should(Receive(Equal("rtr-id/0")))
 	})
+
+	It("returns when the next func returns nil", func() {
+		envelopes := []*events.Envelope{logMessage, logMessage}
+		next := func() *events.Envelope {
+			if len(envelopes) == 0 {
+				return nil
+			}
+
+			e := envelopes[0]
+			envelopes = envelopes[1:]
+			return e
+		}
+
+		var incIDs []string
+		inc := func(id string) {
+			incIDs = append(incIDs, id)
+		}
+
+		p := ingress.NewProcessor(next, inc, false)
+		p.Run()
+
+		Expect(incIDs).To(Equal([]string{"app-id/0", "app-id/0"}))
+	})
 })
 
 var (
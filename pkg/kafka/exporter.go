@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// Message is a single Kafka message.
+type Message struct {
+	Topic string `json:"topic"`
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Producer publishes messages to Kafka. Send should only return once every
+// message has been acknowledged by the broker.
+type Producer interface {
+	Send(ctx context.Context, msgs []Message) error
+}
+
+// Exporter is a sink Exporter that publishes every completed rate bucket of
+// every app as a message keyed by the app GUID. Messages are published at
+// least once: rate buckets that cannot be published are spooled to the local
+// disk and published before any newer bucket once the broker is available.
+type Exporter struct {
+	producer Producer
+	topic    string
+	format   string
+	spool    spool
+	logger   *logging.Logger
+
+	mu            sync.Mutex
+	lastTimestamp int64
+}
+
+// NewExporter initializes and returns a new Exporter that publishes to the
+// given topic.
+func NewExporter(p Producer, topic string, opts ...ExporterOption) (*Exporter, error) {
+	e := &Exporter{
+		producer: p,
+		topic:    topic,
+		format:   FormatJSON,
+		spool: spool{
+			dir:        filepath.Join(os.TempDir(), "noisy-neighbor-kafka-spool"),
+			maxBuckets: 60,
+		},
+		logger: logging.Default(),
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	if e.format != FormatJSON && e.format != FormatAvro {
+		return nil, fmt.Errorf("unknown format %q, expected %s or %s", e.format, FormatJSON, FormatAvro)
+	}
+
+	return e, nil
+}
+
+// Export satisfies the sink Exporter interface. Rate buckets that were
+// already published or spooled are skipped so that exporting more often than
+// the rate interval does not publish the same bucket twice.
+func (e *Exporter) Export(ctx context.Context, points []sink.Point) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var (
+		ts   int64
+		msgs []Message
+	)
+	for _, b := range rateBuckets(points) {
+		if b.Timestamp <= e.lastTimestamp {
+			continue
+		}
+
+		value, err := encode(b, e.format)
+		if err != nil {
+			return err
+		}
+
+		msgs = append(msgs, Message{
+			Topic: e.topic,
+			Key:   []byte(b.AppGUID),
+			Value: value,
+		})
+		if b.Timestamp > ts {
+			ts = b.Timestamp
+		}
+	}
+
+	err := e.drainSpool(ctx)
+	if err == nil && len(msgs) > 0 {
+		err = e.producer.Send(ctx, msgs)
+	}
+
+	if err != nil && len(msgs) > 0 {
+		dropped, spoolErr := e.spool.add(ts, msgs)
+		if dropped > 0 {
+			e.logger.Warn("dropped oldest spooled rate buckets", "dropped", dropped, "dir", e.spool.dir)
+		}
+		if spoolErr != nil {
+			return fmt.Errorf("failed to publish to kafka: %s, failed to spool: %s", err, spoolErr)
+		}
+		e.lastTimestamp = ts
+
+		return fmt.Errorf("failed to publish to kafka, spooled %d messages: %s", len(msgs), err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish to kafka: %s", err)
+	}
+
+	if ts > 0 {
+		e.lastTimestamp = ts
+	}
+
+	return nil
+}
+
+// drainSpool publishes the spooled rate buckets, oldest first. A bucket is
+// only removed from the spool once it has been published.
+func (e *Exporter) drainSpool(ctx context.Context) error {
+	files, err := e.spool.files()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		msgs, err := e.spool.read(f)
+		if err != nil {
+			e.logger.Warn("dropped unreadable spooled rate bucket", "dropped", 1, "file", f, "error", err)
+			os.Remove(f)
+			continue
+		}
+
+		if err := e.producer.Send(ctx, msgs); err != nil {
+			return err
+		}
+
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExporterOption is a func that is used to configure optional settings on an
+// Exporter.
+type ExporterOption func(*Exporter)
+
+// WithFormat returns an ExporterOption for configuring the format messages
+// are encoded in, either FormatJSON or FormatAvro. Defaults to FormatJSON.
+func WithFormat(format string) ExporterOption {
+	return func(e *Exporter) {
+		e.format = format
+	}
+}
+
+// WithSpool returns an ExporterOption for configuring the directory rate
+// buckets are spooled to while the broker is unavailable and the maximum
+// number of buckets that are spooled. Once the spool is full the oldest
+// buckets are dropped. Defaults to a directory in the temporary directory
+// and 60 buckets.
+func WithSpool(dir string, maxBuckets int) ExporterOption {
+	return func(e *Exporter) {
+		e.spool = spool{dir: dir, maxBuckets: maxBuckets}
+	}
+}
+
+// WithLogger returns an ExporterOption for configuring the Logger dropped
+// rate buckets are written to.
+func WithLogger(l *logging.Logger) ExporterOption {
+	return func(e *Exporter) {
+		e.logger = l
+	}
+}
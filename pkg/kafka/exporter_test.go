@@ -0,0 +1,235 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/kafka"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var (
+		producer *spyProducer
+		spoolDir string
+	)
+
+	BeforeEach(func() {
+		producer = &spyProducer{}
+
+		var err error
+		spoolDir, err = ioutil.TempDir("", "kafka-spool")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(spoolDir)
+	})
+
+	newExporter := func(opts ...kafka.ExporterOption) *kafka.Exporter {
+		e, err := kafka.NewExporter(producer, "noise",
+			append([]kafka.ExporterOption{kafka.WithSpool(spoolDir, 2)}, opts...)...,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return e
+	}
+
+	It("publishes a JSON message for every app keyed by app GUID", func() {
+		e := newExporter()
+
+		Expect(e.Export(context.Background(), points(60))).To(Succeed())
+
+		msgs := producer.messages()
+		Expect(msgs).To(HaveLen(2))
+		Expect(msgs[0].Topic).To(Equal("noise"))
+		Expect(string(msgs[0].Key)).To(Equal("app-guid"))
+		Expect(msgs[0].Value).To(MatchJSON(`{
+			"timestamp": 60,
+			"app_guid": "app-guid",
+			"org": "org",
+			"space": "space",
+			"app": "app",
+			"total": 150,
+			"instances": {"0": 100, "1": 50}
+		}`))
+		Expect(string(msgs[1].Key)).To(Equal("other-guid"))
+		Expect(msgs[1].Value).To(MatchJSON(`{
+			"timestamp": 60,
+			"app_guid": "other-guid",
+			"org": "",
+			"space": "",
+			"app": "",
+			"total": 10,
+			"instances": {"3": 10}
+		}`))
+	})
+
+	It("publishes Avro messages with the single object encoding", func() {
+		e := newExporter(kafka.WithFormat(kafka.FormatAvro))
+
+		Expect(e.Export(context.Background(), points(60)[2:])).To(Succeed())
+
+		msgs := producer.messages()
+		Expect(msgs).To(HaveLen(1))
+
+		v := msgs[0].Value
+		Expect(v[:2]).To(Equal([]byte{0xC3, 0x01}))
+		v = v[10:]
+
+		var fields []interface{}
+		readLong := func() int64 {
+			n, l := binary.Varint(v)
+			Expect(l).To(BeNumerically(">", 0))
+			v = v[l:]
+			return n
+		}
+		readString := func() string {
+			l := readLong()
+			s := string(v[:l])
+			v = v[l:]
+			return s
+		}
+
+		fields = append(fields, readLong(), readString(), readString(), readString(), readString(), readLong())
+		Expect(fields).To(Equal([]interface{}{int64(60), "other-guid", "", "", "", int64(10)}))
+		Expect(readLong()).To(Equal(int64(1)))
+		Expect(readString()).To(Equal("3"))
+		Expect(readLong()).To(Equal(int64(10)))
+		Expect(readLong()).To(Equal(int64(0)))
+		Expect(readString()).To(Equal(""))
+		Expect(v).To(BeEmpty())
+	})
+
+	It("does not publish the same rate bucket twice", func() {
+		e := newExporter()
+
+		Expect(e.Export(context.Background(), points(60))).To(Succeed())
+		Expect(e.Export(context.Background(), points(60))).To(Succeed())
+
+		Expect(producer.messages()).To(HaveLen(2))
+	})
+
+	It("spools rate buckets while the broker is down", func() {
+		e := newExporter()
+
+		producer.setErr(errors.New("broker down"))
+		Expect(e.Export(context.Background(), points(60))).To(MatchError(ContainSubstring("spooled 2 messages")))
+		Expect(e.Export(context.Background(), points(120))).ToNot(Succeed())
+		Expect(producer.messages()).To(BeEmpty())
+
+		producer.setErr(nil)
+		Expect(e.Export(context.Background(), points(180))).To(Succeed())
+
+		var timestamps []string
+		for _, m := range producer.messages() {
+			timestamps = append(timestamps, string(m.Value[:len(`{"timestamp":60`)]))
+		}
+		Expect(timestamps).To(Equal([]string{
+			`{"timestamp":60`, `{"timestamp":60`,
+			`{"timestamp":12`, `{"timestamp":12`,
+			`{"timestamp":18`, `{"timestamp":18`,
+		}))
+
+		files, err := ioutil.ReadDir(spoolDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("drops the oldest rate buckets when the spool is full", func() {
+		e := newExporter()
+
+		producer.setErr(errors.New("broker down"))
+		e.Export(context.Background(), points(60))
+		e.Export(context.Background(), points(120))
+		e.Export(context.Background(), points(180))
+
+		producer.setErr(nil)
+		Expect(e.Export(context.Background(), nil)).To(Succeed())
+
+		msgs := producer.messages()
+		Expect(msgs).To(HaveLen(4))
+		Expect(string(msgs[0].Value)).To(HavePrefix(`{"timestamp":120`))
+	})
+
+	It("returns an error for an unknown format", func() {
+		_, err := kafka.NewExporter(producer, "noise", kafka.WithFormat("xml"))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func points(ts int64) []sink.Point {
+	return []sink.Point{
+		{
+			Name:      "application.ingress",
+			Timestamp: ts,
+			Value:     100,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "app-guid",
+				sink.TagInstanceIndex: "0",
+				sink.TagOrg:           "org",
+				sink.TagSpace:         "space",
+				sink.TagApp:           "app",
+			},
+		},
+		{
+			Name:      "application.ingress",
+			Timestamp: ts,
+			Value:     50,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "app-guid",
+				sink.TagInstanceIndex: "1",
+				sink.TagOrg:           "org",
+				sink.TagSpace:         "space",
+				sink.TagApp:           "app",
+			},
+		},
+		{
+			Name:      "application.ingress",
+			Timestamp: ts,
+			Value:     10,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "other-guid",
+				sink.TagInstanceIndex: "3",
+			},
+		},
+	}
+}
+
+type spyProducer struct {
+	mu        sync.Mutex
+	err       error
+	_messages []kafka.Message
+}
+
+func (s *spyProducer) Send(ctx context.Context, msgs []kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s._messages = append(s._messages, msgs...)
+	return nil
+}
+
+func (s *spyProducer) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+func (s *spyProducer) messages() []kafka.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._messages
+}
@@ -0,0 +1,19 @@
+package kafka_test
+
+import (
+	"log"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestKafka(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	logging.SetDefault(logging.New(GinkgoWriter, logging.LevelDebug))
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Kafka Suite")
+}
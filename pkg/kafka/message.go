@@ -0,0 +1,202 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// Formats that rate buckets can be encoded in.
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+// AvroSchema is the Avro schema of the messages encoded with FormatAvro. The
+// foundation field defaults to an empty string so that readers using this
+// schema can read messages written before the field was added.
+const AvroSchema = `{"name":"org.cloudfoundry.noisyneighbor.RateBucket","type":"record","fields":[` +
+	`{"name":"timestamp","type":"long"},` +
+	`{"name":"app_guid","type":"string"},` +
+	`{"name":"org","type":"string"},` +
+	`{"name":"space","type":"string"},` +
+	`{"name":"app","type":"string"},` +
+	`{"name":"total","type":"long"},` +
+	`{"name":"instances","type":{"type":"map","values":"long"}},` +
+	`{"name":"foundation","type":"string","default":""}]}`
+
+// avroCanonicalSchema is AvroSchema in parsing canonical form, which drops
+// the field defaults.
+const avroCanonicalSchema = `{"name":"org.cloudfoundry.noisyneighbor.RateBucket","type":"record","fields":[` +
+	`{"name":"timestamp","type":"long"},` +
+	`{"name":"app_guid","type":"string"},` +
+	`{"name":"org","type":"string"},` +
+	`{"name":"space","type":"string"},` +
+	`{"name":"app","type":"string"},` +
+	`{"name":"total","type":"long"},` +
+	`{"name":"instances","type":{"type":"map","values":"long"}},` +
+	`{"name":"foundation","type":"string"}]}`
+
+// RateBucket is the number of logs an app emitted during a single rate
+// interval. Every RateBucket is published as its own message.
+type RateBucket struct {
+	Timestamp  int64            `json:"timestamp"`
+	AppGUID    string           `json:"app_guid"`
+	Org        string           `json:"org"`
+	Space      string           `json:"space"`
+	App        string           `json:"app"`
+	Total      int64            `json:"total"`
+	Instances  map[string]int64 `json:"instances"`
+	Foundation string           `json:"foundation,omitempty"`
+}
+
+// rateBuckets groups the given Points by timestamp, foundation and app GUID. Points
+// without an app GUID are ignored. Buckets are returned in the order the
+// apps first appear.
+func rateBuckets(points []sink.Point) []RateBucket {
+	type key struct {
+		ts         int64
+		foundation string
+		guid       string
+	}
+
+	var keys []key
+	buckets := make(map[key]*RateBucket)
+	for _, p := range points {
+		guid, ok := p.Tags[sink.TagAppGUID]
+		if !ok {
+			continue
+		}
+
+		k := key{ts: p.Timestamp, foundation: p.Tags[sink.TagFoundation], guid: guid}
+		b, ok := buckets[k]
+		if !ok {
+			b = &RateBucket{
+				Timestamp:  p.Timestamp,
+				AppGUID:    guid,
+				Org:        p.Tags[sink.TagOrg],
+				Space:      p.Tags[sink.TagSpace],
+				App:        p.Tags[sink.TagApp],
+				Instances:  make(map[string]int64),
+				Foundation: p.Tags[sink.TagFoundation],
+			}
+			buckets[k] = b
+			keys = append(keys, k)
+		}
+
+		b.Total += int64(p.Value)
+		b.Instances[p.Tags[sink.TagInstanceIndex]] += int64(p.Value)
+	}
+
+	res := make([]RateBucket, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, *buckets[k])
+	}
+
+	return res
+}
+
+// encode encodes the RateBucket in the given format.
+func encode(b RateBucket, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.Marshal(b)
+	case FormatAvro:
+		return encodeAvro(b), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected %s or %s", format, FormatJSON, FormatAvro)
+	}
+}
+
+// encodeAvro encodes the RateBucket using the Avro single object encoding:
+// a two byte marker and the fingerprint of AvroSchema followed by the Avro
+// binary encoding of the record.
+func encodeAvro(b RateBucket) []byte {
+	buf := []byte{0xC3, 0x01}
+	var fp [8]byte
+	binary.LittleEndian.PutUint64(fp[:], avroFingerprint)
+	buf = append(buf, fp[:]...)
+
+	buf = appendAvroLong(buf, b.Timestamp)
+	buf = appendAvroString(buf, b.AppGUID)
+	buf = appendAvroString(buf, b.Org)
+	buf = appendAvroString(buf, b.Space)
+	buf = appendAvroString(buf, b.App)
+	buf = appendAvroLong(buf, b.Total)
+
+	if len(b.Instances) > 0 {
+		keys := make([]string, 0, len(b.Instances))
+		for k := range b.Instances {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return instanceLess(keys[i], keys[j])
+		})
+
+		buf = appendAvroLong(buf, int64(len(keys)))
+		for _, k := range keys {
+			buf = appendAvroString(buf, k)
+			buf = appendAvroLong(buf, b.Instances[k])
+		}
+	}
+
+	// End of map blocks
+	buf = appendAvroLong(buf, 0)
+
+	return appendAvroString(buf, b.Foundation)
+}
+
+// instanceLess orders instance indexes numerically.
+func instanceLess(a, b string) bool {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+	if aErr != nil || bErr != nil {
+		return a < b
+	}
+
+	return ai < bi
+}
+
+func appendAvroLong(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendAvroString(buf []byte, s string) []byte {
+	buf = appendAvroLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
+
+// avroFingerprint is the CRC-64-AVRO fingerprint of AvroSchema, computed
+// over its parsing canonical form.
+var avroFingerprint = fingerprint64([]byte(avroCanonicalSchema))
+
+const fingerprintEmpty uint64 = 0xc15d213aa4d7a795
+
+var fingerprintTable = func() [256]uint64 {
+	var t [256]uint64
+	for i := range t {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (fingerprintEmpty & -(fp & 1))
+		}
+		t[i] = fp
+	}
+	return t
+}()
+
+// fingerprint64 returns the Rabin fingerprint of the given bytes as
+// specified by the Avro specification.
+func fingerprint64(b []byte) uint64 {
+	fp := fingerprintEmpty
+	for _, c := range b {
+		fp = (fp >> 8) ^ fingerprintTable[byte(fp)^c]
+	}
+
+	return fp
+}
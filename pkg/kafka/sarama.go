@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// SaramaProducer is a Producer that publishes messages with a synchronous
+// sarama producer.
+type SaramaProducer struct {
+	producer sarama.SyncProducer
+}
+
+// NewSaramaProducer initializes and returns a new SaramaProducer connected
+// to the given brokers. Messages are only acknowledged once every in-sync
+// replica has received them.
+func NewSaramaProducer(brokers []string, cfg *sarama.Config) (*SaramaProducer, error) {
+	if cfg == nil {
+		cfg = sarama.NewConfig()
+	}
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+
+	p, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SaramaProducer{producer: p}, nil
+}
+
+// Send satisfies the Producer interface. The sarama producer does not
+// support cancellation so messages may still be published after the context
+// is done.
+func (p *SaramaProducer) Send(ctx context.Context, msgs []Message) error {
+	pms := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, m := range msgs {
+		pms = append(pms, &sarama.ProducerMessage{
+			Topic: m.Topic,
+			Key:   sarama.ByteEncoder(m.Key),
+			Value: sarama.ByteEncoder(m.Value),
+		})
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.producer.SendMessages(pms)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the underlying sarama producer.
+func (p *SaramaProducer) Close() error {
+	return p.producer.Close()
+}
@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const spoolSuffix = ".spool"
+
+// spool stores the messages of rate buckets that could not be published on
+// the local disk so they can be published once the broker is available. Each
+// rate bucket is stored in its own file named after its timestamp.
+type spool struct {
+	dir        string
+	maxBuckets int
+}
+
+// add writes the given messages to the spool. When the spool is full the
+// oldest buckets are removed and the number of removed buckets is returned.
+func (s spool) add(ts int64, msgs []Message) (int, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return 0, err
+	}
+
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file first so a partially written bucket is never
+	// published.
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", ts, spoolSuffix))
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return 0, err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	var dropped int
+	for len(files) > s.maxBuckets {
+		if err := os.Remove(files[0]); err != nil {
+			return dropped, err
+		}
+		files = files[1:]
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+// files returns the paths of the spooled buckets, oldest first.
+func (s spool) files() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), spoolSuffix) {
+			files = append(files, filepath.Join(s.dir, info.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// read returns the messages stored in the given spool file.
+func (s spool) read(path string) ([]Message, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []Message
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+
+	return msgs, nil
+}
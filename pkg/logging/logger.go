@@ -0,0 +1,219 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line. Lines below the level of a Logger are
+// not written.
+type Level int
+
+// Levels in increasing severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// String returns the name of the Level as written in log lines.
+func (l Level) String() string {
+	if n, ok := levelNames[l]; ok {
+		return n
+	}
+
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the Level with the given case insensitive name: debug,
+// info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for l, n := range levelNames {
+		if strings.EqualFold(s, n) {
+			return l, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+}
+
+// Logger writes log lines as JSON objects, one per line. Every line has a
+// timestamp, level and message followed by the fields of the Logger and the
+// fields given with the line:
+//
+//	{"timestamp":"2018-01-01T00:00:00Z","level":"warn","msg":"dropped envelopes","dropped":12}
+//
+// Fields are given as alternating keys and values. A Logger is safe for
+// concurrent use.
+type Logger struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  Level
+	fields []interface{}
+	now    func() time.Time
+}
+
+// New initializes and returns a new Logger that writes lines of the given
+// level and above to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{
+		mu:    &sync.Mutex{},
+		w:     w,
+		level: level,
+		now:   time.Now,
+	}
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultLogger = New(os.Stderr, LevelInfo)
+)
+
+// Default returns the Logger used by components that were not given a
+// Logger. It writes info lines and above to stderr unless it is replaced
+// with SetDefault.
+func Default() *Logger {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	return defaultLogger
+}
+
+// SetDefault replaces the Logger returned by Default.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultLogger = l
+}
+
+// With returns a Logger that adds the given fields to every line.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{
+		mu:     l.mu,
+		w:      l.w,
+		level:  l.level,
+		fields: fields,
+		now:    l.now,
+	}
+}
+
+// Enabled returns whether lines of the given level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug writes a debug line.
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+// Info writes an info line.
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+// Warn writes a warn line. It is used for events that lose data, such as
+// dropped envelopes, series or rates.
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, msg, kv)
+}
+
+// Error writes an error line.
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
+
+// Fatal writes an error line and exits the process.
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"timestamp":`)
+	writeValue(&buf, l.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, msg)
+	writeFields(&buf, l.fields)
+	writeFields(&buf, kv)
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// There is nowhere to report a failed write to.
+	_, _ = l.w.Write(buf.Bytes())
+}
+
+func writeFields(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var value interface{} = "MISSING"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+
+		buf.WriteByte(',')
+		writeValue(buf, key)
+		buf.WriteByte(':')
+		writeValue(buf, value)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, v interface{}) {
+	switch tv := v.(type) {
+	case error:
+		v = tv.Error()
+	case fmt.Stringer:
+		v = tv.String()
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+// StdWriter returns an io.Writer for the standard log package that writes
+// every line as an info line of the Logger. It is used so that the lines of
+// libraries that use the standard log package are structured as well. The
+// standard logger should be configured without flags.
+func (l *Logger) StdWriter() io.Writer {
+	return stdWriter{l: l}
+}
+
+type stdWriter struct {
+	l *Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.l.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,131 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var buf *bytes.Buffer
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+	})
+
+	lines := func() []map[string]interface{} {
+		var res []map[string]interface{}
+		for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if l == "" {
+				continue
+			}
+
+			var m map[string]interface{}
+			Expect(json.Unmarshal([]byte(l), &m)).To(Succeed())
+			res = append(res, m)
+		}
+
+		return res
+	}
+
+	It("writes lines as JSON with the given fields", func() {
+		l := logging.New(buf, logging.LevelDebug)
+
+		l.Warn("dropped envelopes", "dropped", 12, "error", errors.New("full"), "after", time.Second)
+
+		Expect(lines()).To(HaveLen(1))
+		line := lines()[0]
+		Expect(line).To(HaveKeyWithValue("level", "warn"))
+		Expect(line).To(HaveKeyWithValue("msg", "dropped envelopes"))
+		Expect(line).To(HaveKeyWithValue("dropped", BeNumerically("==", 12)))
+		Expect(line).To(HaveKeyWithValue("error", "full"))
+		Expect(line).To(HaveKeyWithValue("after", "1s"))
+
+		ts, err := time.Parse(time.RFC3339Nano, line["timestamp"].(string))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ts).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(buf.String()).To(HavePrefix(`{"timestamp":`))
+	})
+
+	It("does not write lines below its level", func() {
+		l := logging.New(buf, logging.LevelWarn)
+
+		l.Debug("debug")
+		l.Info("info")
+		l.Warn("warn")
+		l.Error("error")
+
+		Expect(lines()).To(HaveLen(2))
+		Expect(lines()[0]).To(HaveKeyWithValue("level", "warn"))
+		Expect(lines()[1]).To(HaveKeyWithValue("level", "error"))
+		Expect(l.Enabled(logging.LevelInfo)).To(BeFalse())
+	})
+
+	It("adds the fields of With to every line", func() {
+		l := logging.New(buf, logging.LevelInfo).With("component", "reporter")
+
+		l.Info("started", "port", 8080)
+		l.With("foundation", "prod-east").Error("failed")
+
+		Expect(lines()).To(HaveLen(2))
+		Expect(lines()[0]).To(HaveKeyWithValue("component", "reporter"))
+		Expect(lines()[0]).To(HaveKeyWithValue("port", BeNumerically("==", 8080)))
+		Expect(lines()[1]).To(HaveKeyWithValue("component", "reporter"))
+		Expect(lines()[1]).To(HaveKeyWithValue("foundation", "prod-east"))
+	})
+
+	It("writes a placeholder for a key without a value", func() {
+		logging.New(buf, logging.LevelInfo).Info("odd", "key")
+
+		Expect(lines()[0]).To(HaveKeyWithValue("key", "MISSING"))
+	})
+
+	It("structures the lines of the standard logger", func() {
+		l := logging.New(buf, logging.LevelInfo)
+		std := log.New(l.StdWriter(), "", 0)
+
+		std.Printf("legacy line %d", 1)
+
+		Expect(lines()).To(HaveLen(1))
+		Expect(lines()[0]).To(HaveKeyWithValue("level", "info"))
+		Expect(lines()[0]).To(HaveKeyWithValue("msg", "legacy line 1"))
+	})
+
+	It("replaces the default logger", func() {
+		original := logging.Default()
+		defer logging.SetDefault(original)
+
+		l := logging.New(buf, logging.LevelInfo)
+		logging.SetDefault(l)
+
+		Expect(logging.Default()).To(Equal(l))
+	})
+
+	Describe("ParseLevel", func() {
+		It("parses level names", func() {
+			for name, level := range map[string]logging.Level{
+				"debug": logging.LevelDebug,
+				"INFO":  logging.LevelInfo,
+				"warn":  logging.LevelWarn,
+				"Error": logging.LevelError,
+			} {
+				l, err := logging.ParseLevel(name)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(l).To(Equal(level))
+			}
+		})
+
+		It("returns an error for unknown levels", func() {
+			_, err := logging.ParseLevel("verbose")
+			Expect(err).To(MatchError(`unknown log level "verbose", expected debug, info, warn or error`))
+		})
+	})
+})
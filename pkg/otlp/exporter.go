@@ -0,0 +1,267 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	"golang.org/x/net/http2"
+)
+
+// Protocols that can be used to send metrics to an OTLP receiver.
+const (
+	ProtocolHTTP = "http/protobuf"
+	ProtocolGRPC = "grpc"
+)
+
+const (
+	httpMetricsPath = "/v1/metrics"
+	grpcExportPath  = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+)
+
+// Exporter is a sink Exporter that sends Points as OTLP gauge metrics. The
+// Point tags are sent as data point attributes.
+type Exporter struct {
+	endpoint      string
+	protocol      string
+	headers       map[string]string
+	resourceAttrs map[string]string
+	tlsConfig     *tls.Config
+	httpClient    HTTPClient
+}
+
+// NewExporter initializes and returns a new Exporter that sends metrics to
+// the OTLP receiver at the given endpoint. The endpoint is the base URL of
+// the receiver, e.g. http://localhost:4318 for HTTP or http://localhost:4317
+// for gRPC.
+func NewExporter(endpoint string, opts ...ExporterOption) (*Exporter, error) {
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse OTLP endpoint: %s", err)
+	}
+
+	e := &Exporter{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		protocol: ProtocolHTTP,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	switch e.protocol {
+	case ProtocolHTTP, ProtocolGRPC:
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q, expected %s or %s", e.protocol, ProtocolHTTP, ProtocolGRPC)
+	}
+
+	if e.httpClient == nil {
+		e.httpClient = e.defaultHTTPClient()
+	}
+
+	return e, nil
+}
+
+// defaultHTTPClient returns the client used when none is configured. gRPC
+// requires HTTP/2, which is negotiated via TLS for https endpoints and used
+// without upgrading (h2c) for http endpoints.
+func (e *Exporter) defaultHTTPClient() HTTPClient {
+	if e.protocol != ProtocolGRPC {
+		return &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: e.tlsConfig,
+			},
+		}
+	}
+
+	t := &http2.Transport{TLSClientConfig: e.tlsConfig}
+	if strings.HasPrefix(e.endpoint, "http://") {
+		t.AllowHTTP = true
+		t.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: t,
+	}
+}
+
+// Export satisfies the sink Exporter interface.
+func (e *Exporter) Export(ctx context.Context, points []sink.Point) error {
+	msg := encodeRequest(e.resourceAttrs, points)
+
+	if e.protocol == ProtocolGRPC {
+		return e.exportGRPC(ctx, msg)
+	}
+
+	return e.exportHTTP(ctx, msg)
+}
+
+func (e *Exporter) exportHTTP(ctx context.Context, msg []byte) error {
+	resp, err := e.post(ctx, e.endpoint+httpMetricsPath, "application/x-protobuf", msg)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 || resp.StatusCode < 200 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+
+		return fmt.Errorf(
+			"expected successful status code from OTLP receiver, got %d: %s",
+			resp.StatusCode,
+			respBody,
+		)
+	}
+
+	return nil
+}
+
+func (e *Exporter) exportGRPC(ctx context.Context, msg []byte) error {
+	// gRPC messages are prefixed with a compressed flag and the length of
+	// the message.
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	resp, err := e.post(ctx, e.endpoint+grpcExportPath, "application/grpc", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status code 200 from OTLP receiver, got %d", resp.StatusCode)
+	}
+
+	// Trailers are only available once the body has been read.
+	io.Copy(ioutil.Discard, resp.Body)
+
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// Responses without a message send the status in the headers.
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+
+	if status != "0" {
+		if m, err := url.PathUnescape(message); err == nil {
+			message = m
+		}
+		return fmt.Errorf("OTLP receiver returned gRPC status %s: %s", status, message)
+	}
+
+	return nil
+}
+
+func (e *Exporter) post(ctx context.Context, addr, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request to OTLP receiver: %s", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.protocol == ProtocolGRPC {
+		req.Header.Set("TE", "trailers")
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send metrics to OTLP receiver: %s", err)
+	}
+
+	return resp, nil
+}
+
+// ParseHeaders parses headers in the format of the
+// OTEL_EXPORTER_OTLP_HEADERS environment variable: a comma separated list of
+// key=value pairs with URL encoded values.
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+
+		v, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header value for %s: %s", kv[0], err)
+		}
+		headers[strings.TrimSpace(kv[0])] = v
+	}
+
+	return headers, nil
+}
+
+// ExporterOption is a func that is used to configure optional settings on an
+// Exporter.
+type ExporterOption func(*Exporter)
+
+// WithProtocol returns an ExporterOption for configuring the protocol used
+// to send metrics, either ProtocolHTTP or ProtocolGRPC. Defaults to
+// ProtocolHTTP.
+func WithProtocol(protocol string) ExporterOption {
+	return func(e *Exporter) {
+		e.protocol = protocol
+	}
+}
+
+// WithHeaders returns an ExporterOption for configuring headers that are
+// sent with every request, e.g. for authentication.
+func WithHeaders(headers map[string]string) ExporterOption {
+	return func(e *Exporter) {
+		e.headers = headers
+	}
+}
+
+// WithResourceAttributes returns an ExporterOption for configuring the
+// attributes of the resource every metric is reported for.
+func WithResourceAttributes(attrs map[string]string) ExporterOption {
+	return func(e *Exporter) {
+		e.resourceAttrs = attrs
+	}
+}
+
+// WithTLSConfig returns an ExporterOption for configuring the TLS config of
+// the default HTTPClient.
+func WithTLSConfig(c *tls.Config) ExporterOption {
+	return func(e *Exporter) {
+		e.tlsConfig = c
+	}
+}
+
+// WithHTTPClient returns an ExporterOption for configuring the HTTPClient
+// used to send metrics. The client must support HTTP/2 when using
+// ProtocolGRPC.
+func WithHTTPClient(c HTTPClient) ExporterOption {
+	return func(e *Exporter) {
+		e.httpClient = c
+	}
+}
+
+// HTTPClient is the interface used for sending HTTP requests to the OTLP
+// receiver.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
@@ -0,0 +1,151 @@
+package otlp_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/otlp"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var points = []sink.Point{
+		{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     4321,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "app-guid",
+				sink.TagInstanceIndex: "1",
+				sink.TagOrg:           "org",
+				sink.TagSpace:         "space",
+				sink.TagApp:           "app",
+			},
+		},
+		{
+			Name:      "application.ingress",
+			Timestamp: 1234,
+			Value:     10,
+			Tags: map[string]string{
+				sink.TagAppGUID:       "other-guid",
+				sink.TagInstanceIndex: "0",
+			},
+		},
+	}
+
+	var expectedMetrics = []metric{
+		{
+			name: "application.ingress",
+			dataPoints: []dataPoint{
+				{
+					timeUnixNano: 1234000000000,
+					asInt:        4321,
+					attrs: map[string]string{
+						"app_guid":       "app-guid",
+						"instance_index": "1",
+						"org":            "org",
+						"space":          "space",
+						"app":            "app",
+					},
+				},
+				{
+					timeUnixNano: 1234000000000,
+					asInt:        10,
+					attrs: map[string]string{
+						"app_guid":       "other-guid",
+						"instance_index": "0",
+					},
+				},
+			},
+		},
+	}
+
+	It("exports gauges over HTTP", func() {
+		r := newHTTPReceiver()
+		defer r.Close()
+
+		e, err := otlp.NewExporter(r.URL+"/",
+			otlp.WithResourceAttributes(map[string]string{"cf.foundation": "sys.example.com"}),
+			otlp.WithHeaders(map[string]string{"Authorization": "Bearer secret"}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		Expect(r.requests()).To(Equal([]exportRequest{
+			{
+				resourceAttrs: map[string]string{"cf.foundation": "sys.example.com"},
+				scope:         otlp.ScopeName,
+				metrics:       expectedMetrics,
+			},
+		}))
+		Expect(r.headers()[0].Get("Authorization")).To(Equal("Bearer secret"))
+	})
+
+	It("exports gauges over gRPC", func() {
+		r := newGRPCReceiver("0")
+		defer r.Close()
+
+		e, err := otlp.NewExporter(r.URL,
+			otlp.WithProtocol(otlp.ProtocolGRPC),
+			otlp.WithResourceAttributes(map[string]string{"cf.foundation": "sys.example.com"}),
+			otlp.WithHeaders(map[string]string{"Authorization": "Bearer secret"}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		Expect(r.requests()).To(Equal([]exportRequest{
+			{
+				resourceAttrs: map[string]string{"cf.foundation": "sys.example.com"},
+				scope:         otlp.ScopeName,
+				metrics:       expectedMetrics,
+			},
+		}))
+		Expect(r.headers()[0].Get("Authorization")).To(Equal("Bearer secret"))
+	})
+
+	It("returns an error for a non-zero gRPC status", func() {
+		r := newGRPCReceiver("7")
+		defer r.Close()
+
+		e, err := otlp.NewExporter(r.URL, otlp.WithProtocol(otlp.ProtocolGRPC))
+		Expect(err).ToNot(HaveOccurred())
+
+		err = e.Export(context.Background(), points)
+		Expect(err).To(MatchError("OTLP receiver returned gRPC status 7: permission denied"))
+	})
+
+	It("returns an error when the receiver is unreachable", func() {
+		r := newHTTPReceiver()
+		r.Close()
+
+		e, err := otlp.NewExporter(r.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(e.Export(context.Background(), points)).ToNot(Succeed())
+	})
+
+	It("returns an error for an unknown protocol", func() {
+		_, err := otlp.NewExporter("http://localhost:4318", otlp.WithProtocol("carrier-pigeon"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("ParseHeaders()", func() {
+		It("parses comma separated key value pairs", func() {
+			headers, err := otlp.ParseHeaders("Authorization=Bearer%20secret, x-tenant=a=b,")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(headers).To(Equal(map[string]string{
+				"Authorization": "Bearer secret",
+				"x-tenant":      "a=b",
+			}))
+		})
+
+		It("returns an error for invalid pairs", func() {
+			_, err := otlp.ParseHeaders("Authorization")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,135 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// The OTLP messages are encoded by hand to avoid depending on the generated
+// OpenTelemetry protobuf packages. Only the fields used by the Exporter are
+// encoded. Field numbers are from opentelemetry/proto/metrics/v1/metrics.proto
+// and opentelemetry/proto/common/v1/common.proto.
+
+const (
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// ScopeName is the name of the instrumentation scope metrics are reported
+// with.
+const ScopeName = "code.cloudfoundry.org/noisy-neighbor-nozzle"
+
+// encodeRequest encodes an ExportMetricsServiceRequest containing a gauge
+// for every metric name in the given Points.
+func encodeRequest(resourceAttrs map[string]string, points []sink.Point) []byte {
+	// Resource
+	var resource []byte
+	for _, k := range sortedKeys(resourceAttrs) {
+		resource = appendMessage(resource, 1, encodeKeyValue(k, resourceAttrs[k]))
+	}
+
+	// InstrumentationScope
+	scope := appendString(nil, 1, ScopeName)
+
+	// ScopeMetrics
+	scopeMetrics := appendMessage(nil, 1, scope)
+	for _, m := range encodeMetrics(points) {
+		scopeMetrics = appendMessage(scopeMetrics, 2, m)
+	}
+
+	// ResourceMetrics
+	resourceMetrics := appendMessage(nil, 1, resource)
+	resourceMetrics = appendMessage(resourceMetrics, 2, scopeMetrics)
+
+	// ExportMetricsServiceRequest
+	return appendMessage(nil, 1, resourceMetrics)
+}
+
+// encodeMetrics groups the Points by name and encodes each group as a Metric
+// with a Gauge. Metrics are returned in the order their names first appear.
+func encodeMetrics(points []sink.Point) [][]byte {
+	var names []string
+	dataPoints := make(map[string][]byte)
+	for _, p := range points {
+		if _, ok := dataPoints[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+
+		// Gauge.data_points
+		dataPoints[p.Name] = appendMessage(dataPoints[p.Name], 1, encodeDataPoint(p))
+	}
+
+	metrics := make([][]byte, 0, len(names))
+	for _, n := range names {
+		// Metric.name and Metric.gauge
+		m := appendString(nil, 1, n)
+		m = appendMessage(m, 5, dataPoints[n])
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+// encodeDataPoint encodes a NumberDataPoint. Values are counts so they are
+// encoded as integers.
+func encodeDataPoint(p sink.Point) []byte {
+	// NumberDataPoint.time_unix_nano
+	dp := appendFixed64(nil, 3, uint64(p.Timestamp)*uint64(1e9))
+	// NumberDataPoint.as_int
+	dp = appendFixed64(dp, 6, uint64(int64(p.Value)))
+	// NumberDataPoint.attributes
+	for _, k := range sortedKeys(p.Tags) {
+		dp = appendMessage(dp, 7, encodeKeyValue(k, p.Tags[k]))
+	}
+
+	return dp
+}
+
+// encodeKeyValue encodes a KeyValue with a string AnyValue.
+func encodeKeyValue(key, value string) []byte {
+	kv := appendString(nil, 1, key)
+	return appendMessage(kv, 2, appendString(nil, 1, value))
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendVarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendFixed64(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendMessage(b []byte, field int, msg []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
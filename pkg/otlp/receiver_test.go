@@ -0,0 +1,280 @@
+package otlp_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// receiver is an in-process OTLP receiver that decodes the metrics it
+// receives over HTTP or gRPC.
+type receiver struct {
+	*httptest.Server
+	grpcStatus string
+
+	mu        sync.Mutex
+	_requests []exportRequest
+	_headers  []http.Header
+}
+
+func newHTTPReceiver() *receiver {
+	r := &receiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.handleHTTP))
+	return r
+}
+
+func newGRPCReceiver(status string) *receiver {
+	r := &receiver{grpcStatus: status}
+	r.Server = httptest.NewServer(h2c.NewHandler(http.HandlerFunc(r.handleGRPC), &http2.Server{}))
+	return r
+}
+
+func (r *receiver) handleHTTP(w http.ResponseWriter, req *http.Request) {
+	defer GinkgoRecover()
+
+	Expect(req.URL.Path).To(Equal("/v1/metrics"))
+	Expect(req.Header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+
+	body, err := ioutil.ReadAll(req.Body)
+	Expect(err).ToNot(HaveOccurred())
+
+	r.record(req.Header, body)
+}
+
+func (r *receiver) handleGRPC(w http.ResponseWriter, req *http.Request) {
+	defer GinkgoRecover()
+
+	Expect(req.ProtoMajor).To(Equal(2))
+	Expect(req.URL.Path).To(Equal("/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"))
+	Expect(req.Header.Get("Content-Type")).To(Equal("application/grpc"))
+
+	body, err := ioutil.ReadAll(req.Body)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(len(body)).To(BeNumerically(">=", 5))
+	Expect(body[0]).To(Equal(byte(0)))
+	Expect(binary.BigEndian.Uint32(body[1:5])).To(Equal(uint32(len(body) - 5)))
+
+	r.record(req.Header, body[5:])
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	// Empty ExportMetricsServiceResponse
+	w.Write([]byte{0, 0, 0, 0, 0})
+	w.Header().Set("Grpc-Status", r.grpcStatus)
+	if r.grpcStatus != "0" {
+		w.Header().Set("Grpc-Message", "permission%20denied")
+	}
+}
+
+func (r *receiver) record(h http.Header, body []byte) {
+	req, err := decodeRequest(body)
+	Expect(err).ToNot(HaveOccurred())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r._requests = append(r._requests, req)
+	r._headers = append(r._headers, h)
+}
+
+func (r *receiver) requests() []exportRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r._requests
+}
+
+func (r *receiver) headers() []http.Header {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r._headers
+}
+
+type exportRequest struct {
+	resourceAttrs map[string]string
+	scope         string
+	metrics       []metric
+}
+
+type metric struct {
+	name       string
+	dataPoints []dataPoint
+}
+
+type dataPoint struct {
+	timeUnixNano uint64
+	asInt        int64
+	attrs        map[string]string
+}
+
+// decodeRequest decodes the subset of an ExportMetricsServiceRequest that is
+// written by the Exporter.
+func decodeRequest(b []byte) (exportRequest, error) {
+	var req exportRequest
+	err := decodeFields(b, func(field int, v []byte, _ uint64) error {
+		if field != 1 {
+			return nil
+		}
+
+		// ResourceMetrics
+		return decodeFields(v, func(field int, v []byte, _ uint64) error {
+			switch field {
+			case 1:
+				attrs, err := decodeAttributes(v, 1)
+				req.resourceAttrs = attrs
+				return err
+			case 2:
+				return decodeScopeMetrics(v, &req)
+			}
+			return nil
+		})
+	})
+
+	return req, err
+}
+
+func decodeScopeMetrics(b []byte, req *exportRequest) error {
+	return decodeFields(b, func(field int, v []byte, _ uint64) error {
+		switch field {
+		case 1:
+			return decodeFields(v, func(field int, v []byte, _ uint64) error {
+				if field == 1 {
+					req.scope = string(v)
+				}
+				return nil
+			})
+		case 2:
+			var m metric
+			err := decodeFields(v, func(field int, v []byte, _ uint64) error {
+				switch field {
+				case 1:
+					m.name = string(v)
+				case 5:
+					return decodeFields(v, func(field int, v []byte, _ uint64) error {
+						if field != 1 {
+							return nil
+						}
+						dp, err := decodeDataPoint(v)
+						m.dataPoints = append(m.dataPoints, dp)
+						return err
+					})
+				}
+				return nil
+			})
+			req.metrics = append(req.metrics, m)
+			return err
+		}
+		return nil
+	})
+}
+
+func decodeDataPoint(b []byte) (dataPoint, error) {
+	dp := dataPoint{attrs: map[string]string{}}
+	err := decodeFields(b, func(field int, v []byte, n uint64) error {
+		switch field {
+		case 3:
+			dp.timeUnixNano = n
+		case 6:
+			dp.asInt = int64(n)
+		case 7:
+			key, value, err := decodeKeyValue(v)
+			dp.attrs[key] = value
+			return err
+		}
+		return nil
+	})
+
+	return dp, err
+}
+
+func decodeAttributes(b []byte, field int) (map[string]string, error) {
+	attrs := map[string]string{}
+	err := decodeFields(b, func(f int, v []byte, _ uint64) error {
+		if f != field {
+			return nil
+		}
+		key, value, err := decodeKeyValue(v)
+		attrs[key] = value
+		return err
+	})
+
+	return attrs, err
+}
+
+func decodeKeyValue(b []byte) (string, string, error) {
+	var key, value string
+	err := decodeFields(b, func(field int, v []byte, _ uint64) error {
+		switch field {
+		case 1:
+			key = string(v)
+		case 2:
+			return decodeFields(v, func(field int, v []byte, _ uint64) error {
+				if field == 1 {
+					value = string(v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	return key, value, err
+}
+
+// decodeFields calls f for every field in the given message. Length
+// delimited fields are passed as bytes, varint and fixed64 fields as
+// numbers.
+func decodeFields(b []byte, f func(field int, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("invalid tag")
+		}
+		b = b[n:]
+
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint")
+			}
+			b = b[n:]
+			if err := f(field, nil, v); err != nil {
+				return err
+			}
+		case 1:
+			if len(b) < 8 {
+				return fmt.Errorf("invalid fixed64")
+			}
+			if err := f(field, nil, binary.LittleEndian.Uint64(b)); err != nil {
+				return err
+			}
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return fmt.Errorf("invalid length")
+			}
+			b = b[n:]
+			if err := f(field, b[:l], 0); err != nil {
+				return err
+			}
+			b = b[l:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", tag&7)
+		}
+	}
+
+	return nil
+}
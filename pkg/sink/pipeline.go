@@ -0,0 +1,295 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+)
+
+// Pipeline builds Points on an interval and exports them to every configured
+// Exporter. Each Exporter runs on its own interval with its own timeout so a
+// slow or failing Exporter does not affect the others.
+type Pipeline struct {
+	pointBuilder PointBuilder
+	rateInterval time.Duration
+	exporters    []exporter
+	logger       *logging.Logger
+	clock        clock.Clock
+
+	mu           sync.Mutex
+	cachedTS     int64
+	cachedPoints []Point
+	building     *buildCall
+
+	statsMu sync.Mutex
+	stats   map[string]*ExporterStats
+}
+
+// ExporterStats are the statistics of a single Exporter of a Pipeline.
+type ExporterStats struct {
+	Name string
+
+	// LastSuccess is the time of the last successful export. It is zero if
+	// no export has succeeded yet.
+	LastSuccess time.Time
+
+	// ConsecutiveFailures is the number of failed exports since the last
+	// successful export.
+	ConsecutiveFailures int
+
+	// PointsSent is the total number of Points that were exported
+	// successfully.
+	PointsSent uint64
+
+	// Failures is the total number of failed exports.
+	Failures uint64
+}
+
+type exporter struct {
+	name     string
+	exporter Exporter
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// NewPipeline initializes and returns a new Pipeline.
+func NewPipeline(pb PointBuilder, opts ...PipelineOption) *Pipeline {
+	p := &Pipeline{
+		pointBuilder: pb,
+		rateInterval: time.Minute,
+		stats:        make(map[string]*ExporterStats),
+		logger:       logging.Default(),
+		clock:        clock.New(),
+	}
+
+	for _, o := range opts {
+		o(p)
+	}
+
+	for _, e := range p.exporters {
+		p.stats[e.name] = &ExporterStats{Name: e.name}
+	}
+
+	return p
+}
+
+// Points returns the most recently built Points. It is empty until the first
+// export.
+func (p *Pipeline) Points() []Point {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cachedPoints
+}
+
+// Stats returns the statistics of every Exporter in the order they were
+// added.
+func (p *Pipeline) Stats() []ExporterStats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	stats := make([]ExporterStats, 0, len(p.exporters))
+	for _, e := range p.exporters {
+		stats = append(stats, *p.stats[e.name])
+	}
+
+	return stats
+}
+
+// Run starts exporting to every Exporter. This is a blocking method that
+// returns once the given context is done and every in flight export has
+// completed. In flight exports are not canceled, they are bound by the
+// timeout of their Exporter.
+func (p *Pipeline) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range p.exporters {
+		wg.Add(1)
+		go func(e exporter) {
+			defer wg.Done()
+			p.runExporter(ctx, e)
+		}(e)
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+}
+
+func (p *Pipeline) runExporter(ctx context.Context, e exporter) {
+	ticker := p.clock.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		n, err := p.export(e)
+		if err != nil {
+			p.logger.Error("failed to export points", "exporter", e.name, "points", n, "error", err)
+		}
+		p.record(e.name, n, err)
+	}
+}
+
+// export builds the most recent complete Points and exports them to the
+// given Exporter. It returns the number of Points that were exported.
+func (p *Pipeline) export(e exporter) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, fmt.Errorf("exporter panicked: %v", r)
+		}
+	}()
+
+	// Rates are only complete once the rate interval has passed so the rate
+	// from two intervals ago is exported.
+	ts := p.clock.Now().
+		Add(-2 * p.rateInterval).
+		Truncate(p.rateInterval).
+		Unix()
+
+	points, err := p.build(ts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build points: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	if err := e.exporter.Export(ctx, points); err != nil {
+		return 0, err
+	}
+
+	return len(points), nil
+}
+
+// record updates the statistics of the named Exporter with the result of an
+// export.
+func (p *Pipeline) record(name string, n int, err error) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	s := p.stats[name]
+	if err != nil {
+		s.ConsecutiveFailures++
+		s.Failures++
+		return
+	}
+
+	s.LastSuccess = p.clock.Now()
+	s.ConsecutiveFailures = 0
+	s.PointsSent += uint64(n)
+}
+
+// build returns the Points for the given timestamp. The Points for the most
+// recent timestamp are cached so that they are only built once for every
+// Exporter. Exporters that need the Points while they are being built wait
+// for that build instead of starting another one. The lock is not held while
+// building.
+func (p *Pipeline) build(ts int64) ([]Point, error) {
+	p.mu.Lock()
+	if p.cachedPoints != nil && p.cachedTS == ts {
+		points := p.cachedPoints
+		p.mu.Unlock()
+		return points, nil
+	}
+
+	if b := p.building; b != nil && b.ts == ts {
+		p.mu.Unlock()
+		<-b.done
+		return b.points, b.err
+	}
+
+	b := &buildCall{
+		ts:   ts,
+		done: make(chan struct{}),
+		err:  errors.New("point builder panicked"),
+	}
+	p.building = b
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		if b.err == nil && (p.cachedPoints == nil || ts >= p.cachedTS) {
+			p.cachedTS, p.cachedPoints = ts, b.points
+		}
+		if p.building == b {
+			p.building = nil
+		}
+		p.mu.Unlock()
+
+		close(b.done)
+	}()
+
+	points, err := p.pointBuilder.BuildPoints(ts)
+	if err != nil {
+		b.points, b.err = nil, err
+		return nil, err
+	}
+
+	if points == nil {
+		points = []Point{}
+	}
+	b.points, b.err = points, nil
+
+	return points, nil
+}
+
+// buildCall is a build of the Points for a single timestamp that is in
+// progress. The Points and error are set once done is closed.
+type buildCall struct {
+	ts     int64
+	done   chan struct{}
+	points []Point
+	err    error
+}
+
+// PipelineOption is a func that is used to configure optional settings on a
+// Pipeline.
+type PipelineOption func(*Pipeline)
+
+// WithExporter returns a PipelineOption that adds an Exporter to the
+// Pipeline. The Exporter is given the most recent complete Points every
+// interval and each export is canceled after the given timeout.
+func WithExporter(name string, e Exporter, interval, timeout time.Duration) PipelineOption {
+	return func(p *Pipeline) {
+		p.exporters = append(p.exporters, exporter{
+			name:     name,
+			exporter: e,
+			interval: interval,
+			timeout:  timeout,
+		})
+	}
+}
+
+// WithRateInterval returns a PipelineOption for configuring the interval
+// rates are stored for. It is used to determine the timestamp of the most
+// recent complete rate. Defaults to 1 minute.
+func WithRateInterval(d time.Duration) PipelineOption {
+	return func(p *Pipeline) {
+		p.rateInterval = d
+	}
+}
+
+// WithClock returns a PipelineOption for configuring the Clock that is used
+// to schedule exports and determine the timestamp of the most recent
+// complete rate. Defaults to the real time.
+func WithClock(c clock.Clock) PipelineOption {
+	return func(p *Pipeline) {
+		p.clock = c
+	}
+}
+
+// WithLogger returns a PipelineOption for configuring the Logger failed
+// exports are written to.
+func WithLogger(l *logging.Logger) PipelineOption {
+	return func(p *Pipeline) {
+		p.logger = l
+	}
+}
@@ -0,0 +1,292 @@
+package sink_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock/clocktest"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipeline", func() {
+	It("exports points to every exporter on an interval", func() {
+		pb := &spyPointBuilder{}
+		e1 := &spyExporter{}
+		e2 := &spyExporter{}
+		clock := clocktest.New(time.Date(2018, 1, 1, 10, 30, 0, 0, time.UTC))
+
+		p := sink.NewPipeline(pb,
+			sink.WithRateInterval(time.Hour),
+			sink.WithExporter("e1", e1, time.Minute, time.Second),
+			sink.WithExporter("e2", e2, 2*time.Minute, time.Second),
+			sink.WithClock(clock),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+		clock.BlockUntil(2)
+
+		clock.Advance(time.Minute)
+		Eventually(e1.exportCount).Should(Equal(1))
+		Expect(e2.exportCount()).To(BeZero())
+
+		clock.Advance(time.Minute)
+		Eventually(e1.exportCount).Should(Equal(2))
+		Eventually(e2.exportCount).Should(Equal(1))
+
+		// The rate from two intervals ago is the most recent complete rate.
+		ts := time.Date(2018, 1, 1, 8, 0, 0, 0, time.UTC).Unix()
+		Expect(pb.buildTimestamp()).To(Equal(ts))
+		Expect(e1.lastPoints()).To(Equal([]sink.Point{
+			{
+				Name:      "application.ingress",
+				Timestamp: ts,
+				Value:     1234,
+				Tags:      map[string]string{sink.TagAppGUID: "app-guid"},
+			},
+		}))
+		Eventually(func() time.Time {
+			return p.Stats()[1].LastSuccess
+		}).Should(Equal(time.Date(2018, 1, 1, 10, 32, 0, 0, time.UTC)))
+	})
+
+	It("builds points once per timestamp", func() {
+		pb := &spyPointBuilder{}
+		e1 := &spyExporter{}
+		e2 := &spyExporter{}
+
+		p := sink.NewPipeline(pb,
+			sink.WithRateInterval(time.Hour),
+			sink.WithExporter("e1", e1, 10*time.Millisecond, time.Second),
+			sink.WithExporter("e2", e2, 10*time.Millisecond, time.Second),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+
+		Eventually(e1.exportCount).Should(BeNumerically(">", 2))
+		Eventually(e2.exportCount).Should(BeNumerically(">", 2))
+		Expect(pb.buildCount()).To(Equal(1))
+	})
+
+	It("waits for points that are being built", func() {
+		pb := &spyPointBuilder{release: make(chan struct{})}
+		e1 := &spyExporter{}
+		e2 := &spyExporter{}
+
+		p := sink.NewPipeline(pb,
+			sink.WithRateInterval(time.Hour),
+			sink.WithExporter("e1", e1, 10*time.Millisecond, time.Second),
+			sink.WithExporter("e2", e2, 10*time.Millisecond, time.Second),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+
+		Eventually(pb.buildCount).Should(Equal(1))
+		Consistently(pb.buildCount).Should(Equal(1))
+
+		close(pb.release)
+		Eventually(e1.exportCount).Should(BeNumerically(">", 0))
+		Eventually(e2.exportCount).Should(BeNumerically(">", 0))
+		Expect(pb.buildCount()).To(Equal(1))
+	})
+
+	It("stops exporting once the context is done", func() {
+		pb := &spyPointBuilder{}
+		e := &spyExporter{}
+
+		p := sink.NewPipeline(pb,
+			sink.WithRateInterval(time.Hour),
+			sink.WithExporter("e", e, 10*time.Millisecond, time.Second),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.Run(ctx)
+		}()
+
+		Eventually(e.exportCount).Should(BeNumerically(">", 0))
+		cancel()
+		Eventually(done).Should(BeClosed())
+
+		count := e.exportCount()
+		Consistently(e.exportCount).Should(Equal(count))
+	})
+
+	It("retries building points that failed to build", func() {
+		pb := &spyPointBuilder{buildErr: errors.New("failed")}
+		e := &spyExporter{}
+
+		p := sink.NewPipeline(pb,
+			sink.WithRateInterval(time.Hour),
+			sink.WithExporter("e", e, 10*time.Millisecond, time.Second),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+
+		Eventually(pb.buildCount).Should(BeNumerically(">", 1))
+		Consistently(e.exportCount).Should(BeZero())
+	})
+
+	It("isolates failing and slow exporters", func() {
+		pb := &spyPointBuilder{}
+		failing := &spyExporter{exportErr: errors.New("failed")}
+		panicking := &spyExporter{panics: true}
+		slow := &spyExporter{block: true}
+		healthy := &spyExporter{}
+
+		p := sink.NewPipeline(pb,
+			sink.WithExporter("failing", failing, 10*time.Millisecond, time.Second),
+			sink.WithExporter("panicking", panicking, 10*time.Millisecond, time.Second),
+			sink.WithExporter("slow", slow, 10*time.Millisecond, 20*time.Millisecond),
+			sink.WithExporter("healthy", healthy, 10*time.Millisecond, time.Second),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+
+		Eventually(failing.exportCount).Should(BeNumerically(">", 1))
+		Eventually(panicking.exportCount).Should(BeNumerically(">", 1))
+		Eventually(slow.exportCount).Should(BeNumerically(">", 1))
+		Eventually(healthy.exportCount).Should(BeNumerically(">", 5))
+	})
+
+	It("keeps statistics for every exporter", func() {
+		pb := &spyPointBuilder{}
+		failing := &spyExporter{exportErr: errors.New("failed")}
+		panicking := &spyExporter{panics: true}
+		healthy := &spyExporter{}
+
+		p := sink.NewPipeline(pb,
+			sink.WithRateInterval(time.Hour),
+			sink.WithExporter("failing", failing, 10*time.Millisecond, time.Second),
+			sink.WithExporter("panicking", panicking, 10*time.Millisecond, time.Second),
+			sink.WithExporter("healthy", healthy, 10*time.Millisecond, time.Second),
+		)
+
+		stats := p.Stats()
+		Expect(stats).To(HaveLen(3))
+		Expect(stats[0]).To(Equal(sink.ExporterStats{Name: "failing"}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go p.Run(ctx)
+
+		Eventually(func() int {
+			return p.Stats()[0].ConsecutiveFailures
+		}).Should(BeNumerically(">", 1))
+		Eventually(func() int {
+			return p.Stats()[1].ConsecutiveFailures
+		}).Should(BeNumerically(">", 1))
+		Eventually(func() uint64 {
+			return p.Stats()[2].PointsSent
+		}).Should(BeNumerically(">", 1))
+
+		stats = p.Stats()
+		Expect(stats[0].Name).To(Equal("failing"))
+		Expect(stats[0].LastSuccess.IsZero()).To(BeTrue())
+		Expect(stats[0].Failures).To(BeNumerically(">=", stats[0].ConsecutiveFailures))
+		Expect(stats[0].PointsSent).To(BeZero())
+		Expect(stats[2].Name).To(Equal("healthy"))
+		Expect(stats[2].LastSuccess).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(stats[2].ConsecutiveFailures).To(BeZero())
+		Expect(stats[2].Failures).To(BeZero())
+	})
+})
+
+type spyPointBuilder struct {
+	mu        sync.Mutex
+	buildErr  error
+	release   chan struct{}
+	_builds   int
+	_buildsTS int64
+}
+
+func (s *spyPointBuilder) BuildPoints(ts int64) ([]sink.Point, error) {
+	s.mu.Lock()
+	s._builds++
+	s._buildsTS = ts
+	buildErr := s.buildErr
+	s.mu.Unlock()
+
+	if s.release != nil {
+		<-s.release
+	}
+
+	if buildErr != nil {
+		return nil, buildErr
+	}
+
+	return []sink.Point{
+		{
+			Name:      "application.ingress",
+			Timestamp: ts,
+			Value:     1234,
+			Tags:      map[string]string{sink.TagAppGUID: "app-guid"},
+		},
+	}, nil
+}
+
+func (s *spyPointBuilder) buildCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._builds
+}
+
+func (s *spyPointBuilder) buildTimestamp() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._buildsTS
+}
+
+type spyExporter struct {
+	mu        sync.Mutex
+	exportErr error
+	panics    bool
+	block     bool
+	_exports  int
+	_points   []sink.Point
+}
+
+func (s *spyExporter) Export(ctx context.Context, points []sink.Point) error {
+	s.mu.Lock()
+	s._exports++
+	s._points = points
+	s.mu.Unlock()
+
+	if s.panics {
+		panic("export failed")
+	}
+
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return s.exportErr
+}
+
+func (s *spyExporter) exportCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._exports
+}
+
+func (s *spyExporter) lastPoints() []sink.Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._points
+}
@@ -0,0 +1,35 @@
+package sink
+
+import "context"
+
+// Tags that are set on the Points built for application instances. The org,
+// space and app tags are only set when the app info could be looked up. The
+// foundation tag is only set when reporting on named foundations.
+const (
+	TagFoundation    = "foundation"
+	TagOrg           = "org"
+	TagSpace         = "space"
+	TagApp           = "app"
+	TagAppGUID       = "app_guid"
+	TagInstanceIndex = "instance_index"
+)
+
+// Point is a single measurement that is independent of any metrics backend.
+type Point struct {
+	Name      string
+	Timestamp int64
+	Value     float64
+	Tags      map[string]string
+}
+
+// PointBuilder builds the Points for a given timestamp.
+type PointBuilder interface {
+	BuildPoints(timestamp int64) ([]Point, error)
+}
+
+// Exporter sends Points to a metrics backend. Export should return once the
+// context is done. The Points are shared with other Exporters and must not be
+// modified.
+type Exporter interface {
+	Export(ctx context.Context, points []Point) error
+}
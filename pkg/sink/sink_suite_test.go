@@ -0,0 +1,19 @@
+package sink_test
+
+import (
+	"log"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSink(t *testing.T) {
+	log.SetOutput(GinkgoWriter)
+	logging.SetDefault(logging.New(GinkgoWriter, logging.LevelDebug))
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sink Suite")
+}
@@ -0,0 +1,307 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// DefaultMaxPacketSize is the largest payload that fits in a single UDP
+// packet on a network with a standard 1500 byte MTU once the IP and UDP
+// headers are accounted for.
+const DefaultMaxPacketSize = 1432
+
+// Names of the metrics the Exporter reports about itself.
+const (
+	HeartbeatMetric    = "reporter.heartbeat"
+	PointsMetric       = "reporter.points"
+	ExportErrorsMetric = "reporter.export_errors"
+)
+
+// Exporter is a sink Exporter that sends Points as gauges to a StatsD agent
+// over UDP.
+type Exporter struct {
+	conn          net.Conn
+	prefix        string
+	dogStatsD     bool
+	sampleRate    float64
+	maxPacketSize int
+	selfMetrics   bool
+
+	mu           sync.Mutex
+	exportErrors int
+}
+
+// NewExporter initializes and returns a new Exporter that sends metrics to
+// the StatsD agent at the given address.
+func NewExporter(addr string, opts ...ExporterOption) (*Exporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial statsd agent: %s", err)
+	}
+
+	e := &Exporter{
+		conn:          conn,
+		sampleRate:    1,
+		maxPacketSize: DefaultMaxPacketSize,
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	return e, nil
+}
+
+// Export satisfies the sink Exporter interface. It writes every Point as a
+// gauge, batching as many metrics into each packet as fit in the max packet
+// size.
+func (e *Exporter) Export(ctx context.Context, points []sink.Point) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		e.conn.SetWriteDeadline(deadline)
+	} else {
+		e.conn.SetWriteDeadline(time.Time{})
+	}
+
+	lines := make([]string, 0, len(points)+3)
+	for _, p := range points {
+		lines = append(lines, e.gauge(p.Name, p.Value, p.Tags))
+	}
+
+	if e.selfMetrics {
+		lines = append(lines, e.selfMetricLines(len(points))...)
+	}
+
+	for _, packet := range batch(lines, e.maxPacketSize) {
+		if err := ctx.Err(); err != nil {
+			e.exportErrors++
+			return err
+		}
+
+		if _, err := e.conn.Write(packet); err != nil {
+			e.exportErrors++
+			return fmt.Errorf("failed to write to statsd agent: %s", err)
+		}
+	}
+
+	e.exportErrors = 0
+
+	return nil
+}
+
+// Close closes the connection to the StatsD agent.
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+// selfMetricLines returns the metrics the Exporter reports about itself. The
+// export errors are the number of consecutive failed exports before this one.
+func (e *Exporter) selfMetricLines(points int) []string {
+	var lines []string
+	if line, ok := e.counter(HeartbeatMetric, 1); ok {
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, e.gauge(PointsMetric, float64(points), nil))
+
+	if e.exportErrors > 0 {
+		if line, ok := e.counter(ExportErrorsMetric, e.exportErrors); ok {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func (e *Exporter) gauge(name string, value float64, tags map[string]string) string {
+	return e.line(name, strconv.FormatFloat(value, 'f', -1, 64), "g", "", tags)
+}
+
+// counter returns the line for the given counter. Counters are sampled at the
+// configured sample rate, false is returned if the counter was not sampled.
+func (e *Exporter) counter(name string, value int) (string, bool) {
+	if e.sampleRate < 1 {
+		if rand.Float64() >= e.sampleRate {
+			return "", false
+		}
+
+		rate := "@" + strconv.FormatFloat(e.sampleRate, 'f', -1, 64)
+		return e.line(name, strconv.Itoa(value), "c", rate, nil), true
+	}
+
+	return e.line(name, strconv.Itoa(value), "c", "", nil), true
+}
+
+// line formats a single metric. Without DogStatsD tags the tags are encoded
+// in the metric name so that every application instance has its own metric.
+func (e *Exporter) line(name, value, metricType, rate string, tags map[string]string) string {
+	var buf bytes.Buffer
+	buf.WriteString(e.prefix)
+	buf.WriteString(sanitizeName(name))
+	if !e.dogStatsD {
+		for _, t := range nameTags(tags) {
+			buf.WriteByte('.')
+			buf.WriteString(sanitizeSegment(t))
+		}
+	}
+
+	buf.WriteByte(':')
+	buf.WriteString(value)
+	buf.WriteByte('|')
+	buf.WriteString(metricType)
+
+	if rate != "" {
+		buf.WriteByte('|')
+		buf.WriteString(rate)
+	}
+
+	if e.dogStatsD && len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("|#")
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(sanitizeTag(k))
+			buf.WriteByte(':')
+			buf.WriteString(sanitizeTag(tags[k]))
+		}
+	}
+
+	return buf.String()
+}
+
+// nameTags returns the tag values that identify an application instance in
+// the order they are appended to a metric name. The org, space and app names
+// are used when they are known, otherwise the app GUID is used. The
+// foundation comes first when it is set.
+func nameTags(tags map[string]string) []string {
+	guid, ok := tags[sink.TagAppGUID]
+	if !ok {
+		return nil
+	}
+
+	var segments []string
+	if foundation, ok := tags[sink.TagFoundation]; ok {
+		segments = append(segments, foundation)
+	}
+
+	if app, ok := tags[sink.TagApp]; ok {
+		return append(segments, tags[sink.TagOrg], tags[sink.TagSpace], app, tags[sink.TagInstanceIndex])
+	}
+
+	return append(segments, guid, tags[sink.TagInstanceIndex])
+}
+
+// batch joins the given lines into packets no larger than maxSize. Lines
+// larger than maxSize are sent in a packet of their own.
+func batch(lines []string, maxSize int) [][]byte {
+	var (
+		packets [][]byte
+		buf     bytes.Buffer
+	)
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(l) > maxSize {
+			packets = append(packets, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(l)
+	}
+
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+
+	return packets
+}
+
+var (
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", " ", "_", "\n", "_")
+	tagReplacer  = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_", "\n", "_")
+)
+
+// sanitizeSegment sanitizes a single segment of a metric name. Dots are
+// replaced so that names containing them do not add levels to the metric
+// hierarchy.
+func sanitizeSegment(s string) string {
+	return strings.Replace(sanitizeName(s), ".", "_", -1)
+}
+
+func sanitizeName(s string) string {
+	return nameReplacer.Replace(s)
+}
+
+func sanitizeTag(s string) string {
+	return tagReplacer.Replace(s)
+}
+
+// ExporterOption is a func that is used to configure optional settings on an
+// Exporter.
+type ExporterOption func(*Exporter)
+
+// WithPrefix returns an ExporterOption for configuring a prefix that is
+// prepended to every metric name.
+func WithPrefix(prefix string) ExporterOption {
+	return func(e *Exporter) {
+		prefix = strings.TrimRight(prefix, ".")
+		if prefix != "" {
+			prefix += "."
+		}
+		e.prefix = prefix
+	}
+}
+
+// WithDogStatsDTags returns an ExporterOption for sending tags with the
+// DogStatsD tag extension. When disabled, the default, the tags that
+// identify an application instance are appended to the metric name instead.
+func WithDogStatsDTags(enabled bool) ExporterOption {
+	return func(e *Exporter) {
+		e.dogStatsD = enabled
+	}
+}
+
+// WithSampleRate returns an ExporterOption for configuring the rate counters
+// are sampled at. Gauges are always sent. Defaults to 1.
+func WithSampleRate(rate float64) ExporterOption {
+	return func(e *Exporter) {
+		e.sampleRate = rate
+	}
+}
+
+// WithMaxPacketSize returns an ExporterOption for configuring the maximum
+// size of a packet. Defaults to DefaultMaxPacketSize.
+func WithMaxPacketSize(size int) ExporterOption {
+	return func(e *Exporter) {
+		e.maxPacketSize = size
+	}
+}
+
+// WithSelfMetrics returns an ExporterOption for enabling metrics about the
+// reporter itself: a heartbeat counter, the number of points exported and
+// the number of consecutive failed exports.
+func WithSelfMetrics(enabled bool) ExporterOption {
+	return func(e *Exporter) {
+		e.selfMetrics = enabled
+	}
+}
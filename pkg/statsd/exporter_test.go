@@ -0,0 +1,191 @@
+package statsd_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/statsd"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exporter", func() {
+	var (
+		listener net.PacketConn
+		points   []sink.Point
+	)
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		points = []sink.Point{
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     4321,
+				Tags: map[string]string{
+					sink.TagAppGUID:       "app-guid",
+					sink.TagInstanceIndex: "1",
+					sink.TagOrg:           "org",
+					sink.TagSpace:         "space",
+					sink.TagApp:           "my.app",
+				},
+			},
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     1.5,
+				Tags: map[string]string{
+					sink.TagAppGUID:       "other-guid",
+					sink.TagInstanceIndex: "0",
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	readPackets := func() []string {
+		var packets []string
+		buf := make([]byte, 65536)
+		for {
+			listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := listener.ReadFrom(buf)
+			if err != nil {
+				return packets
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}
+
+	newExporter := func(opts ...statsd.ExporterOption) *statsd.Exporter {
+		e, err := statsd.NewExporter(listener.LocalAddr().String(), opts...)
+		Expect(err).ToNot(HaveOccurred())
+		return e
+	}
+
+	It("sends points as gauges with the instance in the metric name", func() {
+		e := newExporter(statsd.WithPrefix("nn."))
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		Expect(readPackets()).To(Equal([]string{
+			"nn.application.ingress.org.space.my_app.1:4321|g\n" +
+				"nn.application.ingress.other-guid.0:1.5|g",
+		}))
+	})
+
+	It("sends the foundation before the instance in the metric name", func() {
+		e := newExporter()
+		defer e.Close()
+
+		points[0].Tags[sink.TagFoundation] = "prod-east"
+		points[1].Tags[sink.TagFoundation] = "prod-west"
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		Expect(readPackets()).To(Equal([]string{
+			"application.ingress.prod-east.org.space.my_app.1:4321|g\n" +
+				"application.ingress.prod-west.other-guid.0:1.5|g",
+		}))
+	})
+
+	It("sends tags with the DogStatsD extension", func() {
+		e := newExporter(statsd.WithDogStatsDTags(true))
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		Expect(readPackets()).To(Equal([]string{
+			"application.ingress:4321|g|#app:my.app,app_guid:app-guid,instance_index:1,org:org,space:space\n" +
+				"application.ingress:1.5|g|#app_guid:other-guid,instance_index:0",
+		}))
+	})
+
+	It("batches metrics into packets under the max packet size", func() {
+		var many []sink.Point
+		for i := 0; i < 100; i++ {
+			many = append(many, sink.Point{
+				Name:  "application.ingress",
+				Value: float64(i),
+				Tags: map[string]string{
+					sink.TagAppGUID:       fmt.Sprintf("guid-%d", i),
+					sink.TagInstanceIndex: "0",
+				},
+			})
+		}
+
+		e := newExporter(statsd.WithMaxPacketSize(512))
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), many)).To(Succeed())
+
+		packets := readPackets()
+		Expect(len(packets)).To(BeNumerically(">", 1))
+
+		var lines []string
+		for _, p := range packets {
+			Expect(len(p)).To(BeNumerically("<=", 512))
+			lines = append(lines, strings.Split(p, "\n")...)
+		}
+		Expect(lines).To(HaveLen(100))
+		Expect(lines[0]).To(Equal("application.ingress.guid-0.0:0|g"))
+		Expect(lines[99]).To(Equal("application.ingress.guid-99.0:99|g"))
+	})
+
+	It("sends metrics about itself", func() {
+		e := newExporter(statsd.WithSelfMetrics(true), statsd.WithPrefix("nn"))
+		defer e.Close()
+
+		Expect(e.Export(context.Background(), points)).To(Succeed())
+
+		lines := strings.Split(strings.Join(readPackets(), "\n"), "\n")
+		Expect(lines).To(ContainElement("nn.reporter.heartbeat:1|c"))
+		Expect(lines).To(ContainElement("nn.reporter.points:2|g"))
+	})
+
+	It("annotates sampled counters with the sample rate", func() {
+		e := newExporter(statsd.WithSelfMetrics(true), statsd.WithSampleRate(0.5))
+		defer e.Close()
+
+		for i := 0; i < 20; i++ {
+			Expect(e.Export(context.Background(), nil)).To(Succeed())
+		}
+
+		lines := strings.Split(strings.Join(readPackets(), "\n"), "\n")
+		Expect(lines).To(ContainElement("reporter.points:0|g"))
+
+		var heartbeats int
+		for _, l := range lines {
+			if strings.HasPrefix(l, statsd.HeartbeatMetric) {
+				Expect(l).To(Equal("reporter.heartbeat:1|c|@0.5"))
+				heartbeats++
+			}
+		}
+		Expect(heartbeats).To(BeNumerically("<", 20))
+	})
+
+	It("returns an error when the context is done", func() {
+		e := newExporter()
+		defer e.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(e.Export(ctx, points)).ToNot(Succeed())
+	})
+
+	It("returns an error for an invalid address", func() {
+		_, err := statsd.NewExporter("not-an-address")
+		Expect(err).To(HaveOccurred())
+	})
+})
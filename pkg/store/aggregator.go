@@ -2,10 +2,13 @@ package store
 
 import (
 	"container/ring"
+	"context"
 	"errors"
 	"sort"
 	"sync"
 	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock"
 )
 
 var (
@@ -26,6 +29,8 @@ type Aggregator struct {
 	counter         RateCounter
 	pollingInterval time.Duration
 	maxRateBuckets  int
+	broadcaster     *Broadcaster
+	clock           clock.Clock
 }
 
 // NewAggregator will return an initialized Aggregator
@@ -34,6 +39,7 @@ func NewAggregator(c RateCounter, opts ...AggregatorOption) *Aggregator {
 		counter:         c,
 		pollingInterval: time.Minute,
 		maxRateBuckets:  10,
+		clock:           clock.New(),
 	}
 
 	for _, o := range opts {
@@ -44,26 +50,54 @@ func NewAggregator(c RateCounter, opts ...AggregatorOption) *Aggregator {
 	return a
 }
 
-// Run starts the aggregator. This method will block indefinitely.
-func (a *Aggregator) Run() {
+// Run starts the aggregator. This method will block until the given context
+// is done. The counts of the current polling interval are not stored when
+// Run returns, see Flush.
+func (a *Aggregator) Run(ctx context.Context) {
 	for {
-		now := time.Now()
+		now := a.clock.Now()
 		wait := now.Add(a.pollingInterval).
 			Truncate(a.pollingInterval).
 			Sub(now)
-		time.Sleep(wait)
-
-		ts := time.Now().Truncate(a.pollingInterval)
-		counts := a.counter.Reset()
 
-		a.mu.Lock()
-		a.data = a.data.Next()
-		a.data.Value = Rate{
-			Timestamp: ts.Unix(),
-			Counts:    counts,
+		timer := a.clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
 		}
-		a.mu.Unlock()
+
+		a.store(a.clock.Now().Truncate(a.pollingInterval))
+	}
+}
+
+// Flush stores and publishes the counts of the current, partial polling
+// interval as the rate of that interval and returns it. It is used on
+// shutdown so that the counts since the last complete interval are not lost.
+// Flush should not be called while the Aggregator is running.
+func (a *Aggregator) Flush() Rate {
+	return a.store(a.clock.Now().Add(a.pollingInterval).Truncate(a.pollingInterval))
+}
+
+// store resets the counter and stores and publishes its counts as the rate
+// for the given timestamp.
+func (a *Aggregator) store(ts time.Time) Rate {
+	rate := Rate{
+		Timestamp: ts.Unix(),
+		Counts:    a.counter.Reset(),
 	}
+
+	a.mu.Lock()
+	a.data = a.data.Next()
+	a.data.Value = rate
+	a.mu.Unlock()
+
+	if a.broadcaster != nil {
+		a.broadcaster.Publish(rate)
+	}
+
+	return rate
 }
 
 // Rates returns the current state of the aggregator.
@@ -106,6 +140,21 @@ func (a *Aggregator) Rate(timestamp int64) (Rate, error) {
 	return rate, err
 }
 
+// Range returns the rates with a timestamp between start and end, inclusive,
+// sorted by timestamp.
+func (a *Aggregator) Range(start, end int64) ([]Rate, error) {
+	var rates []Rate
+	for _, r := range a.Rates() {
+		if r.Timestamp < start || r.Timestamp > end {
+			continue
+		}
+
+		rates = append(rates, r)
+	}
+
+	return rates, nil
+}
+
 // AggregatorOption are funcs that can be used to configure an Aggregator at
 // initialization.
 type AggregatorOption func(a *Aggregator)
@@ -128,3 +177,19 @@ func WithMaxRateBuckets(n int) AggregatorOption {
 		a.maxRateBuckets = n
 	}
 }
+
+// WithBroadcaster returns an AggregatorOption to configure a Broadcaster. Each
+// Rate will be published to the Broadcaster as soon as it is complete.
+func WithBroadcaster(b *Broadcaster) AggregatorOption {
+	return func(a *Aggregator) {
+		a.broadcaster = b
+	}
+}
+
+// WithClock returns an AggregatorOption to configure the Clock that is used
+// to align rates to the polling interval. Defaults to the real time.
+func WithClock(c clock.Clock) AggregatorOption {
+	return func(a *Aggregator) {
+		a.clock = c
+	}
+}
@@ -1,8 +1,10 @@
 package store_test
 
 import (
+	"context"
 	"time"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/clock/clocktest"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 
 	. "github.com/onsi/ginkgo"
@@ -10,60 +12,213 @@ import (
 )
 
 var _ = Describe("Aggregator", func() {
+	var (
+		start  time.Time
+		clock  *clocktest.Clock
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2018, 1, 1, 10, 0, 30, 0, time.UTC)
+		clock = clocktest.New(start)
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	run := func(a *store.Aggregator) {
+		go a.Run(ctx)
+		clock.BlockUntil(1)
+	}
+
+	// advance moves the clock forward and waits for the Aggregator to wait
+	// for the next interval.
+	advance := func(d time.Duration) {
+		clock.Advance(d)
+		clock.BlockUntil(1)
+	}
+
 	Describe("Rates", func() {
-		It("pulls and stores data from a counter on a given interval", func() {
+		It("pulls and stores data from a counter at the end of every interval", func() {
+			a := store.NewAggregator(stubRateCounter{},
+				store.WithPollingInterval(time.Minute),
+				store.WithClock(clock),
+			)
+			run(a)
+
+			advance(29 * time.Second)
+			Expect(a.Rates()).To(BeEmpty())
+
+			advance(time.Second)
+			Expect(a.Rates()).To(Equal(store.Rates{
+				{
+					Timestamp: time.Date(2018, 1, 1, 10, 1, 0, 0, time.UTC).Unix(),
+					Counts: map[string]uint64{
+						"id-1": uint64(5),
+						"id-2": uint64(5),
+					},
+				},
+			}))
+		})
+
+		It("prunes older rates", func() {
 			a := store.NewAggregator(stubRateCounter{},
-				store.WithPollingInterval(time.Second),
+				store.WithPollingInterval(time.Minute),
+				store.WithMaxRateBuckets(2),
+				store.WithClock(clock),
 			)
+			run(a)
 
-			go a.Run()
+			advance(30 * time.Second)
+			advance(time.Minute)
+			advance(time.Minute)
 
-			var rates []store.Rate
-			f := func() []store.Rate {
-				rates = a.Rates()
-				return rates
-			}
-			Eventually(f).ShouldNot(BeEmpty())
+			rates := a.Rates()
+			Expect(rates).To(HaveLen(2))
+			Expect(rates[0].Timestamp).To(Equal(time.Date(2018, 1, 1, 10, 2, 0, 0, time.UTC).Unix()))
+			Expect(rates[1].Timestamp).To(Equal(time.Date(2018, 1, 1, 10, 3, 0, 0, time.UTC).Unix()))
+		})
 
-			Expect(rates).To(HaveLen(1))
-			Expect(rates[0].Timestamp).To(BeNumerically("~", time.Now().Unix(), 1))
-			Expect(rates[0].Counts).To(Equal(map[string]uint64{
-				"id-1": uint64(5),
-				"id-2": uint64(5),
+		It("counts data received after the end of an interval in the next rate", func() {
+			c := store.NewCounter()
+			a := store.NewAggregator(c,
+				store.WithPollingInterval(time.Minute),
+				store.WithClock(clock),
+			)
+			run(a)
+
+			c.Inc("id-1")
+			advance(30 * time.Second)
+			c.Inc("id-1")
+			c.Inc("id-1")
+			advance(time.Minute)
+
+			Expect(a.Rates()).To(Equal(store.Rates{
+				{
+					Timestamp: time.Date(2018, 1, 1, 10, 1, 0, 0, time.UTC).Unix(),
+					Counts:    map[string]uint64{"id-1": 1},
+				},
+				{
+					Timestamp: time.Date(2018, 1, 1, 10, 2, 0, 0, time.UTC).Unix(),
+					Counts:    map[string]uint64{"id-1": 2},
+				},
 			}))
 		})
 
-		It("prunes older rates", func() {
+		It("stops when the context is done", func() {
 			a := store.NewAggregator(stubRateCounter{},
-				store.WithPollingInterval(1*time.Millisecond),
-				store.WithMaxRateBuckets(2),
+				store.WithClock(clock),
 			)
 
-			go a.Run()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				a.Run(ctx)
+			}()
 
-			Eventually(a.Rates).Should(HaveLen(2))
-			Consistently(a.Rates).Should(HaveLen(2))
+			clock.BlockUntil(1)
+			cancel()
+			Eventually(done).Should(BeClosed())
+			Expect(clock.Waiters()).To(BeZero())
 		})
 	})
 
-	Describe("Rate", func() {
-		It("returns a the rates for a single timestamp", func() {
+	Describe("Flush", func() {
+		It("stores and publishes the partial interval", func() {
+			b := store.NewBroadcaster()
+			rates, cancel := b.Subscribe()
+			defer cancel()
+
 			a := store.NewAggregator(stubRateCounter{},
-				store.WithPollingInterval(20*time.Millisecond),
+				store.WithPollingInterval(time.Hour),
+				store.WithBroadcaster(b),
+				store.WithClock(clock),
+			)
+
+			flushed := a.Flush()
+
+			ts := time.Date(2018, 1, 1, 11, 0, 0, 0, time.UTC).Unix()
+			var rate store.Rate
+			Expect(rates).To(Receive(&rate))
+			Expect(rate.Timestamp).To(Equal(ts))
+			Expect(flushed).To(Equal(rate))
+			Expect(a.Rate(ts)).To(Equal(rate))
+		})
+	})
+
+	Describe("Range", func() {
+		It("returns the rates between start and end", func() {
+			a := store.NewAggregator(stubRateCounter{},
+				store.WithPollingInterval(time.Minute),
+				store.WithMaxRateBuckets(5),
+				store.WithClock(clock),
+			)
+			run(a)
+
+			advance(30 * time.Second)
+			for i := 0; i < 4; i++ {
+				advance(time.Minute)
+			}
+
+			r, err := a.Range(
+				time.Date(2018, 1, 1, 10, 2, 0, 0, time.UTC).Unix(),
+				time.Date(2018, 1, 1, 10, 4, 0, 0, time.UTC).Unix(),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r).To(HaveLen(3))
+			Expect(r[0].Timestamp).To(Equal(time.Date(2018, 1, 1, 10, 2, 0, 0, time.UTC).Unix()))
+			Expect(r[2].Timestamp).To(Equal(time.Date(2018, 1, 1, 10, 4, 0, 0, time.UTC).Unix()))
+		})
+
+		It("returns nothing when no rates are in range", func() {
+			a := store.NewAggregator(stubRateCounter{})
+
+			r, err := a.Range(0, time.Now().Unix())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r).To(BeEmpty())
+		})
+	})
+
+	Describe("Broadcaster", func() {
+		It("publishes each completed rate", func() {
+			b := store.NewBroadcaster()
+			rates, cancel := b.Subscribe()
+			defer cancel()
+
+			a := store.NewAggregator(stubRateCounter{},
+				store.WithPollingInterval(time.Minute),
+				store.WithBroadcaster(b),
+				store.WithClock(clock),
 			)
+			run(a)
 
-			go a.Run()
+			advance(30 * time.Second)
 
-			ts := time.Now().Truncate(20 * time.Millisecond).Unix()
 			var rate store.Rate
-			Eventually(func() error {
-				var err error
-				rate, err = a.Rate(ts)
+			Expect(rates).To(Receive(&rate))
+			Expect(rate.Counts).To(Equal(map[string]uint64{
+				"id-1": uint64(5),
+				"id-2": uint64(5),
+			}))
+			Expect(a.Rate(rate.Timestamp)).To(Equal(rate))
+		})
+	})
+
+	Describe("Rate", func() {
+		It("returns a the rates for a single timestamp", func() {
+			a := store.NewAggregator(stubRateCounter{},
+				store.WithPollingInterval(time.Minute),
+				store.WithClock(clock),
+			)
+			run(a)
 
-				return err
-			}).Should(Succeed())
+			advance(30 * time.Second)
 
-			Expect(rate).To(Equal(store.Rate{
+			ts := time.Date(2018, 1, 1, 10, 1, 0, 0, time.UTC).Unix()
+			Expect(a.Rate(ts)).To(Equal(store.Rate{
 				Timestamp: ts,
 				Counts: map[string]uint64{
 					"id-1": uint64(5),
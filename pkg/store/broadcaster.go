@@ -0,0 +1,67 @@
+package store
+
+import (
+	"sync"
+)
+
+// subscriptionBufferSize is the number of Rates that may be queued for a
+// single subscriber before new Rates are dropped for that subscriber.
+const subscriptionBufferSize = 10
+
+// Broadcaster publishes Rates to any number of subscribers.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Rate]struct{}
+}
+
+// NewBroadcaster returns an initialized Broadcaster.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan Rate]struct{}),
+	}
+}
+
+// Publish sends the given Rate to all current subscribers. Publish will not
+// block on slow subscribers, if a subscriber is not keeping up the Rate is
+// dropped for that subscriber.
+func (b *Broadcaster) Publish(r Rate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		select {
+		case s <- r:
+		default:
+		}
+	}
+}
+
+// Subscribers returns the number of current subscribers.
+func (b *Broadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// Subscribe returns a channel that will receive every published Rate and a
+// func to cancel the subscription. The channel is closed when the
+// subscription is canceled.
+func (b *Broadcaster) Subscribe() (<-chan Rate, func()) {
+	s := make(chan Rate, subscriptionBufferSize)
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return s, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, s)
+			b.mu.Unlock()
+
+			close(s)
+		})
+	}
+}
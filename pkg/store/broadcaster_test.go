@@ -0,0 +1,67 @@
+package store_test
+
+import (
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broadcaster", func() {
+	It("publishes rates to all subscribers", func() {
+		b := store.NewBroadcaster()
+		s1, cancel1 := b.Subscribe()
+		defer cancel1()
+		s2, cancel2 := b.Subscribe()
+		defer cancel2()
+
+		rate := store.Rate{
+			Timestamp: 60,
+			Counts:    map[string]uint64{"id-1": 5},
+		}
+		b.Publish(rate)
+
+		Expect(s1).To(Receive(Equal(rate)))
+		Expect(s2).To(Receive(Equal(rate)))
+	})
+
+	It("stops publishing to canceled subscriptions", func() {
+		b := store.NewBroadcaster()
+		s, cancel := b.Subscribe()
+		cancel()
+		cancel()
+
+		b.Publish(store.Rate{Timestamp: 60})
+
+		Expect(s).To(BeClosed())
+	})
+
+	It("counts the current subscribers", func() {
+		b := store.NewBroadcaster()
+		Expect(b.Subscribers()).To(BeZero())
+
+		_, cancel1 := b.Subscribe()
+		_, cancel2 := b.Subscribe()
+		defer cancel2()
+		Expect(b.Subscribers()).To(Equal(2))
+
+		cancel1()
+		Expect(b.Subscribers()).To(Equal(1))
+	})
+
+	It("does not block on slow subscribers", func() {
+		b := store.NewBroadcaster()
+		_, cancel := b.Subscribe()
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				b.Publish(store.Rate{Timestamp: int64(i)})
+			}
+		}()
+
+		Eventually(done).Should(BeClosed())
+	})
+})
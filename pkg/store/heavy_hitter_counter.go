@@ -0,0 +1,123 @@
+package store
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// HeavyHitterCounter stores an approximation of the number of logs emitted per
+// application using the Space-Saving algorithm. Unlike Counter, it never
+// tracks more than a fixed number of IDs, so memory usage stays bounded no
+// matter how many distinct IDs are seen during a polling interval.
+//
+// For N increments within a polling interval and a capacity of k:
+//   - every ID with a true count greater than N/k is guaranteed to be
+//     reported,
+//   - a reported count is never lower than the true count, and
+//   - a reported count overestimates the true count by at most N/k.
+//
+// IDs that are not reported were seen at most N/k times.
+type HeavyHitterCounter struct {
+	mu       sync.Mutex
+	capacity int
+	data     *heavyHitters
+}
+
+// NewHeavyHitterCounter returns an initialized HeavyHitterCounter that tracks
+// at most capacity IDs.
+func NewHeavyHitterCounter(capacity int) *HeavyHitterCounter {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &HeavyHitterCounter{
+		capacity: capacity,
+		data:     newHeavyHitters(capacity),
+	}
+}
+
+// Inc increments the value for a given ID. If the counter is full and the ID
+// is not already tracked, the ID with the lowest count is evicted and the new
+// ID inherits its count.
+func (c *HeavyHitterCounter) Inc(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := c.data
+	if i, ok := h.index[id]; ok {
+		h.entries[i].count++
+		heap.Fix(h, i)
+		return
+	}
+
+	if len(h.entries) < c.capacity {
+		heap.Push(h, heavyHitter{id: id, count: 1})
+		return
+	}
+
+	min := h.entries[0]
+	delete(h.index, min.id)
+	h.entries[0] = heavyHitter{id: id, count: min.count + 1}
+	h.index[id] = 0
+	heap.Fix(h, 0)
+}
+
+// Reset returns the current counts while replacing the current counts with an
+// empty set.
+func (c *HeavyHitterCounter) Reset() map[string]uint64 {
+	c.mu.Lock()
+	h := c.data
+	c.data = newHeavyHitters(c.capacity)
+	c.mu.Unlock()
+
+	d := make(map[string]uint64, len(h.entries))
+	for _, e := range h.entries {
+		d[e.id] = e.count
+	}
+
+	return d
+}
+
+type heavyHitter struct {
+	id    string
+	count uint64
+}
+
+// heavyHitters is a min-heap of heavyHitter ordered by count. It keeps an
+// index of each ID's position in the heap so that counts can be updated in
+// place.
+type heavyHitters struct {
+	entries []heavyHitter
+	index   map[string]int
+}
+
+func newHeavyHitters(capacity int) *heavyHitters {
+	return &heavyHitters{
+		entries: make([]heavyHitter, 0, capacity),
+		index:   make(map[string]int, capacity),
+	}
+}
+
+func (h *heavyHitters) Len() int           { return len(h.entries) }
+func (h *heavyHitters) Less(i, j int) bool { return h.entries[i].count < h.entries[j].count }
+
+func (h *heavyHitters) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].id] = i
+	h.index[h.entries[j].id] = j
+}
+
+func (h *heavyHitters) Push(x interface{}) {
+	e := x.(heavyHitter)
+	h.index[e.id] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *heavyHitters) Pop() interface{} {
+	n := len(h.entries)
+	e := h.entries[n-1]
+	h.entries = h.entries[:n-1]
+	delete(h.index, e.id)
+
+	return e
+}
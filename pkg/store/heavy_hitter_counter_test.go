@@ -0,0 +1,68 @@
+package store_test
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HeavyHitterCounter", func() {
+	Describe("Reset", func() {
+		It("returns exact counts when under capacity", func() {
+			c := store.NewHeavyHitterCounter(10)
+
+			repeat(func() { c.Inc("id-1") }, 1)
+			repeat(func() { c.Inc("id-2") }, 2)
+			repeat(func() { c.Inc("id-3") }, 3)
+
+			Expect(c.Reset()).To(Equal(map[string]uint64{
+				"id-1": 1,
+				"id-2": 2,
+				"id-3": 3,
+			}))
+		})
+
+		It("never stores more IDs than its capacity", func() {
+			c := store.NewHeavyHitterCounter(5)
+
+			for i := 0; i < 1000; i++ {
+				c.Inc(fmt.Sprintf("id-%d", i))
+			}
+
+			Expect(c.Reset()).To(HaveLen(5))
+		})
+
+		It("keeps the heavy hitters within the error bound", func() {
+			c := store.NewHeavyHitterCounter(10)
+
+			var total uint64
+			for i := 0; i < 100; i++ {
+				c.Inc("noisy-1")
+				c.Inc("noisy-2")
+				c.Inc(fmt.Sprintf("quiet-%d", i))
+				total += 3
+			}
+
+			counts := c.Reset()
+			maxErr := total / 10
+			Expect(counts).To(HaveKey("noisy-1"))
+			Expect(counts).To(HaveKey("noisy-2"))
+			Expect(counts["noisy-1"]).To(BeNumerically(">=", 100))
+			Expect(counts["noisy-1"]).To(BeNumerically("<=", 100+maxErr))
+			Expect(counts["noisy-2"]).To(BeNumerically(">=", 100))
+			Expect(counts["noisy-2"]).To(BeNumerically("<=", 100+maxErr))
+		})
+
+		It("resets the current counts", func() {
+			c := store.NewHeavyHitterCounter(10)
+
+			repeat(func() { c.Inc("id-1") }, 1)
+
+			_ = c.Reset()
+			Expect(c.Reset()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package store
+
+// Shard is a RateCounter that can be incremented. Both Counter and
+// HeavyHitterCounter satisfy this interface.
+type Shard interface {
+	RateCounter
+	Inc(id string)
+}
+
+// ShardedCounter is a RateCounter made up of several independent shards. Each
+// shard is intended to be incremented by a single ingress processor so that
+// processors never contend for the same lock. The counts from every shard are
+// merged when the ShardedCounter is reset.
+type ShardedCounter struct {
+	shards []Shard
+}
+
+// NewShardedCounter returns a ShardedCounter with n shards. Each shard is
+// created with the given func.
+func NewShardedCounter(n int, newShard func() Shard) *ShardedCounter {
+	if n < 1 {
+		n = 1
+	}
+
+	shards := make([]Shard, n)
+	for i := range shards {
+		shards[i] = newShard()
+	}
+
+	return &ShardedCounter{
+		shards: shards,
+	}
+}
+
+// Shard returns the shard at the given index.
+func (s *ShardedCounter) Shard(i int) Shard {
+	return s.shards[i]
+}
+
+// Reset resets every shard and returns the sum of their counts.
+func (s *ShardedCounter) Reset() map[string]uint64 {
+	if len(s.shards) == 1 {
+		return s.shards[0].Reset()
+	}
+
+	d := make(map[string]uint64)
+	for _, shard := range s.shards {
+		for id, count := range shard.Reset() {
+			d[id] += count
+		}
+	}
+
+	return d
+}
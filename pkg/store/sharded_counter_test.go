@@ -0,0 +1,49 @@
+package store_test
+
+import (
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ShardedCounter", func() {
+	newShard := func() store.Shard {
+		return store.NewCounter()
+	}
+
+	Describe("Reset", func() {
+		It("merges the counts of all shards", func() {
+			c := store.NewShardedCounter(3, newShard)
+
+			repeat(func() { c.Shard(0).Inc("id-1") }, 1)
+			repeat(func() { c.Shard(1).Inc("id-1") }, 2)
+			repeat(func() { c.Shard(2).Inc("id-2") }, 3)
+
+			Expect(c.Reset()).To(Equal(map[string]uint64{
+				"id-1": 3,
+				"id-2": 3,
+			}))
+		})
+
+		It("resets every shard", func() {
+			c := store.NewShardedCounter(2, newShard)
+
+			c.Shard(0).Inc("id-1")
+			c.Shard(1).Inc("id-2")
+
+			_ = c.Reset()
+			Expect(c.Reset()).To(BeEmpty())
+		})
+
+		It("always has at least one shard", func() {
+			c := store.NewShardedCounter(0, newShard)
+
+			c.Shard(0).Inc("id-1")
+
+			Expect(c.Reset()).To(Equal(map[string]uint64{
+				"id-1": 1,
+			}))
+		})
+	})
+})
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+)
+
+// requestIDHeaders are the headers a request ID is read from, in order. The
+// GoRouter sets X-Vcap-Request-Id for every request it routes.
+var requestIDHeaders = []string{"X-Vcap-Request-Id", "X-Request-Id"}
+
+// AccessLogMiddleware will return HTTP middleware that writes an info line to
+// the given Logger for every request. The line has the request ID, method,
+// path, status, latency, bytes written, remote address and the client ID of
+// the caller's token. Requests without a request ID are given one and the
+// request ID is returned in the X-Request-Id response header.
+func AccessLogMiddleware(l *logging.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := requestID(r)
+			w.Header().Set("X-Request-Id", id)
+
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(rw, r)
+
+			l.Info("request",
+				"request_id", id,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.status,
+				"latency", time.Since(start).Seconds(),
+				"bytes", rw.bytes,
+				"remote_addr", r.RemoteAddr,
+				"client_id", clientID(r),
+			)
+		})
+	}
+}
+
+func requestID(r *http.Request) string {
+	for _, h := range requestIDHeaders {
+		if id := r.Header.Get(h); id != "" {
+			return id
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// clientID returns the client_id claim of the bearer token of the request.
+// The token is not verified, it is only decoded so that requests can be
+// attributed to a client. It returns an empty string if the request has no
+// token or the token can not be decoded.
+func clientID(r *http.Request) string {
+	items := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(items) != 2 {
+		return ""
+	}
+
+	segments := strings.Split(items[1], ".")
+	if len(segments) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		ClientID string `json:"client_id"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	return claims.ClientID
+}
+
+// responseWriter records the status and number of bytes written to a
+// http.ResponseWriter. It is a http.Flusher so that rates can still be
+// streamed through it.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += n
+
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,95 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AccessLogMiddleware", func() {
+	var (
+		buf     *bytes.Buffer
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("hello"))
+		})
+		handler = web.AccessLogMiddleware(logging.New(buf, logging.LevelInfo))(stub)
+	})
+
+	It("logs the request with the client ID of the token", func() {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"client_id":"noisy-reporter"}`))
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/rates/1234", nil)
+		req.Header.Add("Authorization", "Bearer header."+payload+".signature")
+		req.Header.Add("X-Vcap-Request-Id", "some-request-id")
+
+		handler.ServeHTTP(recorder, req)
+
+		Expect(recorder.Code).To(Equal(http.StatusTeapot))
+		Expect(recorder.Header().Get("X-Request-Id")).To(Equal("some-request-id"))
+
+		line := decodeLine(buf)
+		Expect(line).To(HaveKeyWithValue("level", "info"))
+		Expect(line).To(HaveKeyWithValue("msg", "request"))
+		Expect(line).To(HaveKeyWithValue("request_id", "some-request-id"))
+		Expect(line).To(HaveKeyWithValue("method", "GET"))
+		Expect(line).To(HaveKeyWithValue("path", "/rates/1234"))
+		Expect(line).To(HaveKeyWithValue("status", float64(http.StatusTeapot)))
+		Expect(line).To(HaveKeyWithValue("bytes", float64(5)))
+		Expect(line).To(HaveKeyWithValue("client_id", "noisy-reporter"))
+		Expect(line).To(HaveKey("latency"))
+		Expect(line).To(HaveKey("remote_addr"))
+	})
+
+	It("generates a request ID if the request has none", func() {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer opaque-token")
+
+		handler.ServeHTTP(recorder, req)
+
+		id := recorder.Header().Get("X-Request-Id")
+		Expect(id).To(HaveLen(32))
+
+		line := decodeLine(buf)
+		Expect(line).To(HaveKeyWithValue("request_id", id))
+		Expect(line).To(HaveKeyWithValue("client_id", ""))
+	})
+
+	It("can flush streamed responses", func() {
+		var flushed bool
+		stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f, ok := w.(http.Flusher)
+			Expect(ok).To(BeTrue())
+			f.Flush()
+			flushed = true
+		})
+		handler = web.AccessLogMiddleware(logging.New(buf, logging.LevelInfo))(stub)
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/rates/stream", nil))
+
+		Expect(flushed).To(BeTrue())
+		Expect(recorder.Flushed).To(BeTrue())
+	})
+})
+
+func decodeLine(buf *bytes.Buffer) map[string]interface{} {
+	var line map[string]interface{}
+	Expect(json.Unmarshal(buf.Bytes(), &line)).To(Succeed())
+
+	return line
+}
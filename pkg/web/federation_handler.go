@@ -0,0 +1,47 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+)
+
+// UpstreamStatusSource is the interface from which the server gets the
+// availability of the upstreams of a federated accumulator.
+type UpstreamStatusSource interface {
+	Status() []collector.UpstreamStatus
+}
+
+type upstreamStatus struct {
+	Foundation          string `json:"foundation"`
+	Addr                string `json:"addr"`
+	Available           bool   `json:"available"`
+	LastSuccess         int64  `json:"last_success"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// FederationStatus renders the availability of every upstream of a federated
+// accumulator as JSON. The last success is a unix timestamp that is zero if
+// no request to the upstream has succeeded yet.
+func FederationStatus(s UpstreamStatusSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := []upstreamStatus{}
+		for _, us := range s.Status() {
+			statuses = append(statuses, upstreamStatus{
+				Foundation:          us.Foundation,
+				Addr:                us.Addr,
+				Available:           us.Available,
+				LastSuccess:         unix(us.LastSuccess),
+				ConsecutiveFailures: us.ConsecutiveFailures,
+				LastError:           us.LastError,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Encode will never fail with known data.
+		_ = json.NewEncoder(w).Encode(statuses)
+	})
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// ReporterStats are the statistics of the reporter rendered by the Health
+// and Metrics handlers.
+type ReporterStats struct {
+	Exporters []sink.ExporterStats
+	Cache     collector.CacheStats
+}
+
+// StatsSource is the interface from which the Health and Metrics handlers
+// get the statistics of the reporter.
+type StatsSource interface {
+	Stats() ReporterStats
+}
+
+type exporterHealth struct {
+	Name                string `json:"name"`
+	Healthy             bool   `json:"healthy"`
+	LastSuccess         int64  `json:"last_success"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	PointsSent          uint64 `json:"points_sent"`
+	Failures            uint64 `json:"failures"`
+}
+
+type cacheHealth struct {
+	Hits         uint64  `json:"hits"`
+	Misses       uint64  `json:"misses"`
+	HitRate      float64 `json:"hit_rate"`
+	LookupErrors uint64  `json:"lookup_errors"`
+}
+
+type health struct {
+	Healthy   bool             `json:"healthy"`
+	Exporters []exporterHealth `json:"exporters"`
+	Cache     cacheHealth      `json:"cache"`
+}
+
+// Health renders the statistics of the reporter as JSON. An exporter is
+// reported as unhealthy once it failed maxFailures consecutive times. The
+// response is always a 200 as long as the reporter is serving: restarting
+// the reporter does not help an unavailable backend and throws away the
+// series that are queued for retry. The last success is a unix timestamp
+// that is zero if the exporter has not succeeded yet.
+func Health(ss StatsSource, maxFailures int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := ss.Stats()
+
+		h := health{
+			Healthy:   true,
+			Exporters: make([]exporterHealth, 0, len(stats.Exporters)),
+			Cache: cacheHealth{
+				Hits:         stats.Cache.Hits,
+				Misses:       stats.Cache.Misses,
+				HitRate:      stats.Cache.HitRate(),
+				LookupErrors: stats.Cache.LookupErrors,
+			},
+		}
+
+		for _, e := range stats.Exporters {
+			eh := exporterHealth{
+				Name:                e.Name,
+				Healthy:             e.ConsecutiveFailures < maxFailures,
+				LastSuccess:         unix(e.LastSuccess),
+				ConsecutiveFailures: e.ConsecutiveFailures,
+				PointsSent:          e.PointsSent,
+				Failures:            e.Failures,
+			}
+			h.Healthy = h.Healthy && eh.Healthy
+			h.Exporters = append(h.Exporters, eh)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Encode will never fail with known data.
+		_ = json.NewEncoder(w).Encode(h)
+	})
+}
+
+// Metrics renders the statistics of the reporter in the Prometheus text
+// exposition format.
+func Metrics(ss StatsSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := ss.Stats()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		exporterMetric := func(name, typ, help string, value func(sink.ExporterStats) float64) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+			for _, e := range stats.Exporters {
+				fmt.Fprintf(w, "%s{exporter=%q} %v\n", name, e.Name, value(e))
+			}
+		}
+		metric := func(name, typ, help string, value float64) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+		}
+
+		exporterMetric(
+			"reporter_last_success_timestamp_seconds", "gauge",
+			"Unix time of the last successful export.",
+			func(e sink.ExporterStats) float64 { return float64(unix(e.LastSuccess)) },
+		)
+		exporterMetric(
+			"reporter_consecutive_failures", "gauge",
+			"Number of failed exports since the last successful export.",
+			func(e sink.ExporterStats) float64 { return float64(e.ConsecutiveFailures) },
+		)
+		exporterMetric(
+			"reporter_points_sent_total", "counter",
+			"Number of points exported successfully.",
+			func(e sink.ExporterStats) float64 { return float64(e.PointsSent) },
+		)
+		exporterMetric(
+			"reporter_export_failures_total", "counter",
+			"Number of failed exports.",
+			func(e sink.ExporterStats) float64 { return float64(e.Failures) },
+		)
+
+		metric(
+			"reporter_capi_lookup_errors_total", "counter",
+			"Number of failed app info lookups against CAPI.",
+			float64(stats.Cache.LookupErrors),
+		)
+		metric(
+			"reporter_app_info_cache_hits_total", "counter",
+			"Number of app GUIDs found in the app info cache.",
+			float64(stats.Cache.Hits),
+		)
+		metric(
+			"reporter_app_info_cache_misses_total", "counter",
+			"Number of app GUIDs not found in the app info cache.",
+			float64(stats.Cache.Misses),
+		)
+		metric(
+			"reporter_app_info_cache_hit_rate", "gauge",
+			"Fraction of app GUIDs found in the app info cache.",
+			stats.Cache.HitRate(),
+		)
+	})
+}
+
+// unix returns the unix timestamp of the given time or zero for the zero
+// time.
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
@@ -0,0 +1,130 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HealthHandlers", func() {
+	var stats web.ReporterStats
+
+	BeforeEach(func() {
+		stats = web.ReporterStats{
+			Exporters: []sink.ExporterStats{
+				{
+					Name:        "datadog",
+					LastSuccess: time.Unix(1500000000, 0),
+					PointsSent:  100,
+					Failures:    1,
+				},
+				{
+					Name:                "statsd",
+					ConsecutiveFailures: 2,
+					Failures:            2,
+				},
+			},
+			Cache: collector.CacheStats{
+				Hits:         3,
+				Misses:       1,
+				LookupErrors: 1,
+			},
+		}
+	})
+
+	Describe("Health", func() {
+		It("renders the stats of the reporter", func() {
+			h := web.Health(&statsSource{stats: stats}, 3)
+
+			r, err := http.NewRequest(http.MethodGet, "/health", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(MatchJSON(`{
+				"healthy": true,
+				"exporters": [
+					{
+						"name": "datadog",
+						"healthy": true,
+						"last_success": 1500000000,
+						"consecutive_failures": 0,
+						"points_sent": 100,
+						"failures": 1
+					},
+					{
+						"name": "statsd",
+						"healthy": true,
+						"last_success": 0,
+						"consecutive_failures": 2,
+						"points_sent": 0,
+						"failures": 2
+					}
+				],
+				"cache": {
+					"hits": 3,
+					"misses": 1,
+					"hit_rate": 0.75,
+					"lookup_errors": 1
+				}
+			}`))
+		})
+
+		It("reports an exporter that failed too many times without failing", func() {
+			h := web.Health(&statsSource{stats: stats}, 2)
+
+			r, err := http.NewRequest(http.MethodGet, "/health", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(ContainSubstring(`"healthy":false`))
+		})
+	})
+
+	Describe("Metrics", func() {
+		It("renders the stats in the prometheus format", func() {
+			h := web.Metrics(&statsSource{stats: stats})
+
+			r, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(ContainSubstring(
+				"# TYPE reporter_points_sent_total counter\n" +
+					"reporter_points_sent_total{exporter=\"datadog\"} 100\n" +
+					"reporter_points_sent_total{exporter=\"statsd\"} 0\n",
+			))
+			Expect(w.Body.String()).To(ContainSubstring(
+				"reporter_last_success_timestamp_seconds{exporter=\"datadog\"} 1.5e+09\n",
+			))
+			Expect(w.Body.String()).To(ContainSubstring(
+				"reporter_consecutive_failures{exporter=\"statsd\"} 2\n",
+			))
+			Expect(w.Body.String()).To(ContainSubstring("reporter_capi_lookup_errors_total 1\n"))
+			Expect(w.Body.String()).To(ContainSubstring("reporter_app_info_cache_hit_rate 0.75\n"))
+		})
+	})
+})
+
+type statsSource struct {
+	stats web.ReporterStats
+}
+
+func (s *statsSource) Stats() web.ReporterStats {
+	return s.stats
+}
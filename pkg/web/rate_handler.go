@@ -2,11 +2,15 @@ package web
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 	"github.com/gorilla/mux"
 )
 
@@ -40,3 +44,181 @@ func RatesShow(store RateStore, rateInterval time.Duration) http.Handler {
 		_ = json.NewEncoder(w).Encode(rate)
 	})
 }
+
+// RatesIndex gets and renders all Rates with a timestamp between the start and
+// end query parameters, inclusive. If start is not given, all rates up to end
+// are rendered. If end is not given, all rates since start are rendered.
+func RatesIndex(rs RateStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, err := int64Param(r, "start", 0)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		end, err := int64Param(r, "end", math.MaxInt64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rates, err := rs.Range(start, end)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if rates == nil {
+			rates = []store.Rate{}
+		}
+
+		// Encode will never fail with known data.
+		_ = json.NewEncoder(w).Encode(rates)
+	})
+}
+
+const (
+	defaultDiffWindow = 5 * time.Minute
+	defaultDiffFrom   = 30 * time.Minute
+)
+
+// RatesDiff renders the change in the number of logs produced by each app
+// between two windows. Each window ends at the from and to query parameters
+// and is window seconds long. By default the last 5 minutes are compared with
+// the 5 minutes before 30 minutes ago.
+func RatesDiff(rs RateStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		to, err := int64Param(r, "to", time.Now().Unix())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		from, err := int64Param(r, "from", to-int64(defaultDiffFrom/time.Second))
+		if err != nil || from > to {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		window, err := int64Param(r, "window", int64(defaultDiffWindow/time.Second))
+		if err != nil || window <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		order, err := collector.ParseDiffOrder(r.URL.Query().Get("order"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		before := diffWindow{Start: from - window, End: from}
+		after := diffWindow{Start: to - window, End: to}
+
+		beforeRates, err := rs.Range(before.Start, before.End-1)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		afterRates, err := rs.Range(after.Start, after.End-1)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Encode will never fail with known data.
+		_ = json.NewEncoder(w).Encode(diffResponse{
+			Before: before,
+			After:  after,
+			Order:  order,
+			Apps:   collector.Diff(beforeRates, afterRates, order),
+		})
+	})
+}
+
+// diffWindow is the window a diff summed rates over. The start is inclusive
+// and the end is exclusive.
+type diffWindow struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type diffResponse struct {
+	Before diffWindow           `json:"before"`
+	After  diffWindow           `json:"after"`
+	Order  collector.DiffOrder  `json:"order"`
+	Apps   []collector.AppDelta `json:"apps"`
+}
+
+func int64Param(r *http.Request, name string, defaultValue int64) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// streamKeepAliveInterval is how often a comment is written to idle rate
+// streams so that proxies do not close the connection.
+const streamKeepAliveInterval = 30 * time.Second
+
+// RatesStream streams every completed Rate to the client as Server-Sent
+// Events. Each event is named "rate", has the Rate's timestamp as its ID and
+// the JSON encoded Rate as its data.
+func RatesStream(s RateSubscriber) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		rates, cancel := s.Subscribe()
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		f.Flush()
+
+		ticker := time.NewTicker(streamKeepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				// Rates that were published before the server began shutting
+				// down, such as the final partial rate of a nozzle, are still
+				// streamed.
+				for {
+					select {
+					case rate, ok := <-rates:
+						if !ok {
+							return
+						}
+						writeRate(w, f, rate)
+					default:
+						return
+					}
+				}
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				f.Flush()
+			case rate, ok := <-rates:
+				if !ok {
+					return
+				}
+				writeRate(w, f, rate)
+			}
+		}
+	})
+}
+
+func writeRate(w http.ResponseWriter, f http.Flusher, rate store.Rate) {
+	// Marshal will never fail with known data.
+	data, _ := json.Marshal(rate)
+	fmt.Fprintf(w, "event: rate\nid: %d\ndata: %s\n\n", rate.Timestamp, data)
+	f.Flush()
+}
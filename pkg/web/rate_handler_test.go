@@ -2,10 +2,12 @@ package web_test
 
 import (
 	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"time"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
 	"github.com/gorilla/mux"
 
@@ -97,4 +99,167 @@ var _ = Describe("RateHandlers", func() {
 			})
 		})
 	})
+
+	Describe("RatesIndex", func() {
+		It("passes the start and end to the store", func() {
+			rs := &rateStore{}
+			h := web.RatesIndex(rs)
+
+			r, err := http.NewRequest(http.MethodGet, "/rates?start=60&end=120", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(rs.rangeStart).To(Equal(int64(60)))
+			Expect(rs.rangeEnd).To(Equal(int64(120)))
+		})
+
+		It("defaults to all rates", func() {
+			rs := &rateStore{}
+			h := web.RatesIndex(rs)
+
+			r, err := http.NewRequest(http.MethodGet, "/rates", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(rs.rangeStart).To(Equal(int64(0)))
+			Expect(rs.rangeEnd).To(Equal(int64(math.MaxInt64)))
+		})
+
+		It("returns a 400 when start or end is not a number", func() {
+			h := web.RatesIndex(&rateStore{})
+
+			r, err := http.NewRequest(http.MethodGet, "/rates?start=abc", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+			r, err = http.NewRequest(http.MethodGet, "/rates?end=abc", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("returns a 500 when the store fails", func() {
+			h := web.RatesIndex(&rateStore{rangeError: errors.New("failed")})
+
+			r, err := http.NewRequest(http.MethodGet, "/rates", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Describe("RatesDiff", func() {
+		var rs *rateStore
+
+		BeforeEach(func() {
+			rs = &rateStore{
+				rangeRates: []store.Rate{
+					{Timestamp: 600, Counts: map[string]uint64{"app-1/0": 100, "app-2/0": 500}},
+					{Timestamp: 660, Counts: map[string]uint64{"app-1/1": 100}},
+					{Timestamp: 1800, Counts: map[string]uint64{"app-1/0": 1000, "app-3/0": 50}},
+					{Timestamp: 1860, Counts: map[string]uint64{"app-1/1": 200}},
+				},
+			}
+		})
+
+		It("renders the change of each app between the windows", func() {
+			h := web.RatesDiff(rs)
+
+			r, err := http.NewRequest(http.MethodGet, "/rates/diff?from=720&to=1920&window=120", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(MatchJSON(`{
+				"before": {"start": 600, "end": 720},
+				"after": {"start": 1800, "end": 1920},
+				"order": "absolute",
+				"apps": [
+					{"app_guid": "app-1", "before": 200, "after": 1200, "change": 1000, "relative_change": 5, "new": false},
+					{"app_guid": "app-3", "before": 0, "after": 50, "change": 50, "relative_change": 0, "new": true},
+					{"app_guid": "app-2", "before": 500, "after": 0, "change": -500, "relative_change": -1, "new": false}
+				]
+			}`))
+		})
+
+		It("ranks by relative change", func() {
+			h := web.RatesDiff(rs)
+
+			r, err := http.NewRequest(http.MethodGet, "/rates/diff?from=720&to=1920&window=120&order=relative", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(ContainSubstring(`"order":"relative"`))
+			Expect(w.Body.String()).To(MatchRegexp(`app-3.*app-1.*app-2`))
+		})
+
+		It("defaults to the last 5 minutes compared with 30 minutes ago", func() {
+			h := web.RatesDiff(rs)
+
+			r, err := http.NewRequest(http.MethodGet, "/rates/diff", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			now := time.Now().Unix()
+			Expect(rs.rangeEnd).To(BeNumerically("~", now-1, 1))
+			Expect(rs.rangeStart).To(BeNumerically("~", now-300, 1))
+		})
+
+		It("returns a 400 when the parameters are invalid", func() {
+			h := web.RatesDiff(rs)
+
+			for _, q := range []string{
+				"from=abc",
+				"to=abc",
+				"window=abc",
+				"window=0",
+				"from=200&to=100",
+				"order=sideways",
+			} {
+				r, err := http.NewRequest(http.MethodGet, "/rates/diff?"+q, nil)
+				Expect(err).ToNot(HaveOccurred())
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				Expect(w.Code).To(Equal(http.StatusBadRequest), q)
+			}
+		})
+
+		It("returns a 500 when the store fails", func() {
+			h := web.RatesDiff(&rateStore{rangeError: errors.New("failed")})
+
+			r, err := http.NewRequest(http.MethodGet, "/rates/diff", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
 })
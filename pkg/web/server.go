@@ -3,15 +3,12 @@ package web
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
 	"net"
 	"net/http"
-	"os"
 	"time"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
@@ -19,13 +16,22 @@ import (
 // rendered via HTTP in JSON.
 type RateStore interface {
 	Rate(int64) (store.Rate, error)
+	Range(start, end int64) ([]store.Rate, error)
+}
+
+// RateSubscriber is the interface from which the server will receive each
+// completed rate to be streamed to clients.
+type RateSubscriber interface {
+	Subscribe() (<-chan store.Rate, func())
 }
 
 // Server handles setting up an HTTP server and servicing HTTP requests.
 type Server struct {
-	lis       net.Listener
-	server    *http.Server
-	logWriter io.Writer
+	lis              net.Listener
+	server           *http.Server
+	logger           *logging.Logger
+	rateStream       RateSubscriber
+	federationStatus UpstreamStatusSource
 }
 
 // NewServer opens a TCP listener and returns an initialized Server.
@@ -36,32 +42,52 @@ func NewServer(
 	rateInterval time.Duration,
 	opts ...ServerOption,
 ) *Server {
+	s := &Server{
+		logger: logging.Default(),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
-		log.Fatalf("failed to start listener: %d", port)
+		s.logger.Fatal("failed to start listener", "port", port, "error", err)
 	}
+	s.lis = lis
 
-	log.Printf("Server bound to %s", lis.Addr().String())
+	s.logger.Info("server bound", "addr", lis.Addr().String())
 
 	router := mux.NewRouter()
 
+	router.Handle("/rates", RatesIndex(rs)).
+		Methods(http.MethodGet)
+	router.Handle("/rates/diff", RatesDiff(rs)).
+		Methods(http.MethodGet)
 	router.Handle("/rates/{timestamp:[0-9]+}", RatesShow(rs, rateInterval)).
 		Methods(http.MethodGet)
 
-	authMiddleware := AdminAuthMiddleware(ct)
-
-	s := &Server{
-		lis:       lis,
-		logWriter: os.Stdout,
+	if s.rateStream != nil {
+		router.Handle("/rates/stream", RatesStream(s.rateStream)).
+			Methods(http.MethodGet)
 	}
 
-	for _, o := range opts {
-		o(s)
+	if s.federationStatus != nil {
+		router.Handle("/federation/status", FederationStatus(s.federationStatus)).
+			Methods(http.MethodGet)
 	}
 
+	authMiddleware := AdminAuthMiddleware(ct)
+	accessLogMiddleware := AccessLogMiddleware(s.logger)
+
+	// Long lived requests such as rate streams are canceled as soon as the
+	// server begins shutting down.
+	ctx, cancel := context.WithCancel(context.Background())
 	s.server = &http.Server{
-		Handler: handlers.LoggingHandler(s.logWriter, authMiddleware(router)),
+		Handler:     accessLogMiddleware(authMiddleware(router)),
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
+	s.server.RegisterOnShutdown(cancel)
 
 	return s
 }
@@ -74,7 +100,9 @@ func (s *Server) Addr() string {
 // Serve serves the HTTP server on the servers Listener. This is a blocking
 // method.
 func (s *Server) Serve() {
-	log.Println(s.server.Serve(s.lis))
+	if err := s.server.Serve(s.lis); err != nil && err != http.ErrServerClosed {
+		s.logger.Error("server stopped", "error", err)
+	}
 }
 
 // Stop will perform a graceful shutdown of the HTTP server.
@@ -82,16 +110,35 @@ func (s *Server) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	log.Println(s.server.Shutdown(ctx))
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Error("failed to shut down server", "error", err)
+	}
 }
 
 // ServerOption is a function that can be passed to the server initializer to
 // configure optional settings.
 type ServerOption func(*Server)
 
-// WithLogWriter will override the logger used for HTTP logs.
-func WithLogWriter(w io.Writer) ServerOption {
+// WithLogger will override the Logger used for HTTP access logs and server
+// errors.
+func WithLogger(l *logging.Logger) ServerOption {
 	return func(s *Server) {
-		s.logWriter = w
+		s.logger = l
+	}
+}
+
+// WithRateStream will enable the /rates/stream endpoint. Every rate received
+// from the given RateSubscriber will be streamed to clients.
+func WithRateStream(rs RateSubscriber) ServerOption {
+	return func(s *Server) {
+		s.rateStream = rs
+	}
+}
+
+// WithFederationStatus will enable the /federation/status endpoint which
+// renders the availability of every upstream of a federated accumulator.
+func WithFederationStatus(s UpstreamStatusSource) ServerOption {
+	return func(srv *Server) {
+		srv.federationStatus = s
 	}
 }
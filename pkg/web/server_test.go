@@ -1,11 +1,15 @@
 package web_test
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/collector"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/store"
 	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
 
@@ -17,7 +21,7 @@ var _ = Describe("Server", func() {
 	Describe("/rates/:timestamp", func() {
 		It("returns rates from the collector", func() {
 			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
-				web.WithLogWriter(GinkgoWriter),
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
 			)
 			go server.Serve()
 			defer server.Stop()
@@ -52,7 +56,7 @@ var _ = Describe("Server", func() {
 
 		It("returns a 401 if check token fails", func() {
 			server := web.NewServer(0, checkTokenFailure, &rateStore{}, time.Minute,
-				web.WithLogWriter(GinkgoWriter),
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
 			)
 			go server.Serve()
 			defer server.Stop()
@@ -73,11 +77,253 @@ var _ = Describe("Server", func() {
 			Expect(resp.StatusCode).To(Equal(401))
 		})
 	})
+
+	Describe("/rates", func() {
+		It("returns a range of rates from the collector", func() {
+			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
+			)
+			go server.Serve()
+			defer server.Stop()
+
+			req, err := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf("http://%s/rates?start=1200&end=1260", server.Addr()),
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			req.Header.Add("Authorization", "Bearer some-token")
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(200))
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(body).To(MatchJSON(`[
+				{
+					"timestamp": 1200,
+					"counts": {"id-1": 1111}
+				},
+				{
+					"timestamp": 1260,
+					"counts": {"id-1": 2222}
+				}
+			]`))
+		})
+	})
+
+	Describe("/rates/stream", func() {
+		It("streams published rates as server-sent events", func() {
+			b := store.NewBroadcaster()
+			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
+				web.WithRateStream(b),
+			)
+			go server.Serve()
+			defer server.Stop()
+
+			req, err := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf("http://%s/rates/stream", server.Addr()),
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			req.Header.Add("Authorization", "Bearer some-token")
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+			b.Publish(store.Rate{
+				Timestamp: 1234,
+				Counts: map[string]uint64{
+					"id-1": 9999,
+				},
+			})
+
+			var lines []string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line == "" {
+					break
+				}
+				lines = append(lines, line)
+			}
+
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(Equal("event: rate"))
+			Expect(lines[1]).To(Equal("id: 1234"))
+			Expect(strings.TrimPrefix(lines[2], "data: ")).To(MatchJSON(`{
+				"timestamp": 1234,
+				"counts": {
+					"id-1": 9999
+				}
+			}`))
+		})
+
+		It("streams rates published before the server stops", func() {
+			b := store.NewBroadcaster()
+			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
+				web.WithRateStream(b),
+			)
+			go server.Serve()
+
+			req, err := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf("http://%s/rates/stream", server.Addr()),
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			req.Header.Add("Authorization", "Bearer some-token")
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			b.Publish(store.Rate{Timestamp: 1234})
+			server.Stop()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring("id: 1234"))
+		})
+
+		It("is not available without a rate stream", func() {
+			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
+			)
+			go server.Serve()
+			defer server.Stop()
+
+			req, err := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf("http://%s/rates/stream", server.Addr()),
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			req.Header.Add("Authorization", "Bearer some-token")
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(404))
+		})
+	})
+
+	Describe("/federation/status", func() {
+		It("renders the status of every upstream", func() {
+			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
+				web.WithFederationStatus(&upstreamStatusSource{
+					statuses: []collector.UpstreamStatus{
+						{
+							Foundation:  "prod-west",
+							Addr:        "https://west.example.com",
+							Available:   true,
+							LastSuccess: time.Unix(1234, 0),
+						},
+						{
+							Foundation:          "prod-north",
+							Addr:                "https://north.example.com",
+							ConsecutiveFailures: 2,
+							LastError:           "uaa unavailable",
+						},
+					},
+				}),
+			)
+			go server.Serve()
+			defer server.Stop()
+
+			req, err := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf("http://%s/federation/status", server.Addr()),
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			req.Header.Add("Authorization", "Bearer some-token")
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(MatchJSON(`[
+				{
+					"foundation": "prod-west",
+					"addr": "https://west.example.com",
+					"available": true,
+					"last_success": 1234,
+					"consecutive_failures": 0
+				},
+				{
+					"foundation": "prod-north",
+					"addr": "https://north.example.com",
+					"available": false,
+					"last_success": 0,
+					"consecutive_failures": 2,
+					"last_error": "uaa unavailable"
+				}
+			]`))
+		})
+
+		It("is not available without federation", func() {
+			server := web.NewServer(0, checkToken, &rateStore{}, time.Minute,
+				web.WithLogger(logging.New(GinkgoWriter, logging.LevelDebug)),
+			)
+			go server.Serve()
+			defer server.Stop()
+
+			req, err := http.NewRequest(
+				http.MethodGet,
+				fmt.Sprintf("http://%s/federation/status", server.Addr()),
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			req.Header.Add("Authorization", "Bearer some-token")
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(404))
+		})
+	})
 })
 
+type upstreamStatusSource struct {
+	statuses []collector.UpstreamStatus
+}
+
+func (s *upstreamStatusSource) Status() []collector.UpstreamStatus {
+	return s.statuses
+}
+
 type rateStore struct {
 	rateError     error
 	rateTimestamp int64
+
+	rangeError error
+	rangeStart int64
+	rangeEnd   int64
+	rangeRates []store.Rate
 }
 
 func (f *rateStore) Rate(ts int64) (store.Rate, error) {
@@ -93,6 +339,42 @@ func (f *rateStore) Rate(ts int64) (store.Rate, error) {
 	}, f.rateError
 }
 
+func (f *rateStore) Range(start, end int64) ([]store.Rate, error) {
+	f.rangeStart = start
+	f.rangeEnd = end
+
+	if f.rangeError != nil {
+		return nil, f.rangeError
+	}
+
+	rates := f.rangeRates
+	if rates == nil {
+		rates = []store.Rate{
+			{
+				Timestamp: 1200,
+				Counts: map[string]uint64{
+					"id-1": uint64(1111),
+				},
+			},
+			{
+				Timestamp: 1260,
+				Counts: map[string]uint64{
+					"id-1": uint64(2222),
+				},
+			},
+		}
+	}
+
+	var res []store.Rate
+	for _, r := range rates {
+		if r.Timestamp >= start && r.Timestamp <= end {
+			res = append(res, r)
+		}
+	}
+
+	return res, nil
+}
+
 func checkToken(_, _ string) bool {
 	return true
 }
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+)
+
+// PointSource is the interface from which the Top handler gets the most
+// recently reported Points.
+type PointSource interface {
+	Points() []sink.Point
+}
+
+// TopInstance is a single application instance rendered by the Top handler.
+type TopInstance struct {
+	Foundation    string `json:"foundation,omitempty"`
+	Org           string `json:"org,omitempty"`
+	Space         string `json:"space,omitempty"`
+	App           string `json:"app,omitempty"`
+	AppGUID       string `json:"app_guid"`
+	InstanceIndex string `json:"instance_index"`
+	Timestamp     int64  `json:"timestamp"`
+	Count         uint64 `json:"count"`
+}
+
+// defaultTopLimit is the number of instances rendered by the Top handler
+// when the limit query parameter is not given.
+const defaultTopLimit = 10
+
+// Top renders the noisiest application instances of the most recent report
+// across every foundation, noisiest first. The limit query parameter sets
+// the number of instances (default 10) and the foundation query parameter
+// restricts them to a single foundation.
+func Top(ps PointSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultTopLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		foundation := r.URL.Query().Get("foundation")
+
+		top := []TopInstance{}
+		for _, p := range ps.Points() {
+			guid, ok := p.Tags[sink.TagAppGUID]
+			if !ok {
+				continue
+			}
+			if foundation != "" && p.Tags[sink.TagFoundation] != foundation {
+				continue
+			}
+
+			top = append(top, TopInstance{
+				Foundation:    p.Tags[sink.TagFoundation],
+				Org:           p.Tags[sink.TagOrg],
+				Space:         p.Tags[sink.TagSpace],
+				App:           p.Tags[sink.TagApp],
+				AppGUID:       guid,
+				InstanceIndex: p.Tags[sink.TagInstanceIndex],
+				Timestamp:     p.Timestamp,
+				Count:         uint64(p.Value),
+			})
+		}
+
+		sort.SliceStable(top, func(i, j int) bool {
+			return top[i].Count > top[j].Count
+		})
+		if len(top) > limit {
+			top = top[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Encode will never fail with known data.
+		_ = json.NewEncoder(w).Encode(top)
+	})
+}
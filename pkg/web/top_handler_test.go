@@ -0,0 +1,137 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/sink"
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/web"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Top", func() {
+	var ps *pointSource
+
+	BeforeEach(func() {
+		ps = &pointSource{points: []sink.Point{
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     10,
+				Tags: map[string]string{
+					sink.TagFoundation:    "prod-east",
+					sink.TagOrg:           "org",
+					sink.TagSpace:         "space",
+					sink.TagApp:           "app",
+					sink.TagAppGUID:       "app-1",
+					sink.TagInstanceIndex: "0",
+				},
+			},
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     30,
+				Tags: map[string]string{
+					sink.TagFoundation:    "prod-west",
+					sink.TagAppGUID:       "app-2",
+					sink.TagInstanceIndex: "1",
+				},
+			},
+			{
+				Name:      "application.ingress",
+				Timestamp: 1234,
+				Value:     20,
+				Tags: map[string]string{
+					sink.TagFoundation:    "prod-east",
+					sink.TagAppGUID:       "app-3",
+					sink.TagInstanceIndex: "0",
+				},
+			},
+			{
+				Name:      "reporter.heartbeat",
+				Timestamp: 1234,
+				Value:     1,
+			},
+		}}
+	})
+
+	It("renders the noisiest instances across foundations", func() {
+		w := serveTop(ps, "/top?limit=2")
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`[
+			{
+				"foundation": "prod-west",
+				"app_guid": "app-2",
+				"instance_index": "1",
+				"timestamp": 1234,
+				"count": 30
+			},
+			{
+				"foundation": "prod-east",
+				"app_guid": "app-3",
+				"instance_index": "0",
+				"timestamp": 1234,
+				"count": 20
+			}
+		]`))
+	})
+
+	It("renders the instances of a single foundation", func() {
+		w := serveTop(ps, "/top?foundation=prod-east")
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`[
+			{
+				"foundation": "prod-east",
+				"app_guid": "app-3",
+				"instance_index": "0",
+				"timestamp": 1234,
+				"count": 20
+			},
+			{
+				"foundation": "prod-east",
+				"org": "org",
+				"space": "space",
+				"app": "app",
+				"app_guid": "app-1",
+				"instance_index": "0",
+				"timestamp": 1234,
+				"count": 10
+			}
+		]`))
+	})
+
+	It("renders an empty list before the first report", func() {
+		w := serveTop(&pointSource{}, "/top")
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`[]`))
+	})
+
+	It("returns a 400 for an invalid limit", func() {
+		w := serveTop(ps, "/top?limit=-1")
+
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+})
+
+func serveTop(ps web.PointSource, url string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest(http.MethodGet, url, nil)
+	Expect(err).ToNot(HaveOccurred())
+
+	w := httptest.NewRecorder()
+	web.Top(ps).ServeHTTP(w, r)
+
+	return w
+}
+
+type pointSource struct {
+	points []sink.Point
+}
+
+func (s *pointSource) Points() []sink.Point {
+	return s.points
+}
@@ -4,12 +4,15 @@ import (
 	"log"
 	"testing"
 
+	"code.cloudfoundry.org/noisy-neighbor-nozzle/pkg/logging"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 func TestWeb(t *testing.T) {
 	log.SetOutput(GinkgoWriter)
+	logging.SetDefault(logging.New(GinkgoWriter, logging.LevelDebug))
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Web Suite")
 }